@@ -4,7 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
@@ -12,25 +15,55 @@ import (
 
 var DB *sql.DB
 
+// Open the connection and apply pending migrations
 func Init() {
+	Connect()
+
+	// Bring the schema up to date unless migrations are run separately (`go run . migrate`)
+	if strings.EqualFold(os.Getenv("DB_AUTO_MIGRATE"), "false") {
+		fmt.Printf("Successfully connected to %s database, automatic migrations are disabled\n", Driver)
+		return
+	}
+	applied, err := Migrate()
+	if err != nil {
+		log.Fatalf("Failed to migrate the database: %v", err)
+	}
+
+	fmt.Printf("Successfully connected to %s database and applied %d migration(s)\n", Driver, len(applied))
+}
+
+// Open and ping the connection without touching the schema
+func Connect() {
 	// Load environment variables from .env file, if available
 	err := godotenv.Load()
 	if err != nil {
 		log.Println("Warning: .env file not found or couldn't be loaded. Proceeding with system environment variables.")
 	}
 
-	// Build the MySQL DSN string from environment variables
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
+	dialect, err := ParseDialect(os.Getenv("DB_DRIVER"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	Driver = dialect
 
 	// Open database connection
 	var errOpen error
-	DB, errOpen = sql.Open("mysql", dsn)
+	switch Driver {
+	case Postgres:
+		DB, errOpen = sql.Open(postgresDriverName, postgresDSN())
+	case SQLite:
+		DB, errOpen = sql.Open(sqliteDriverName, sqliteDSN())
+	default:
+		// Build the MySQL DSN string from environment variables
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			os.Getenv("DB_USER"),
+			os.Getenv("DB_PASSWORD"),
+			os.Getenv("DB_HOST"),
+			os.Getenv("DB_PORT"),
+			os.Getenv("DB_NAME"),
+		)
+		DB, errOpen = sql.Open("mysql", dsn)
+	}
 	if errOpen != nil {
 		log.Fatalf("Failed to connect to the database: %v", errOpen)
 	}
@@ -39,51 +72,30 @@ func Init() {
 	if err := DB.Ping(); err != nil {
 		log.Fatalf("Failed to ping the database: %v", err)
 	}
+}
 
-	// Create 'users' table if it does not exist
-	queryUsers := `
-	CREATE TABLE IF NOT EXISTS users (
-    id INT AUTO_INCREMENT PRIMARY KEY,
-    username VARCHAR(50) NOT NULL UNIQUE,
-    email VARCHAR(100) NOT NULL UNIQUE,
-    password VARCHAR(255) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-	);
-	`
-
-	_, err = DB.Exec(queryUsers)
-	if err != nil {
-		log.Fatalf("Failed to create users table: %v", err)
+// PostgreSQL connection string from the same variables as MySQL, DB_SSLMODE defaults to disable
+func postgresDSN() string {
+	sslMode := os.Getenv("DB_SSLMODE")
+	if sslMode == "" {
+		sslMode = "disable"
 	}
-
-	// Create 'urls' table if it does not exist, with foreign key referencing users
-	queryUrls := `
-	CREATE TABLE IF NOT EXISTS urls (
-    id INT AUTO_INCREMENT PRIMARY KEY,
-    user_id INT NOT NULL,
-    url VARCHAR(2048) NOT NULL,
-    status ENUM('queued', 'running', 'done', 'error') DEFAULT 'queued',
-	should_pause BOOLEAN DEFAULT FALSE,
-    title VARCHAR(255),
-    html_version VARCHAR(50),
-    heading_counts JSON,
-    internal_links_count INT DEFAULT 0,
-    external_links_count INT DEFAULT 0,
-    has_login_form BOOLEAN DEFAULT FALSE,
-    inaccessible_links_count INT DEFAULT 0,
-    inaccessible_links JSON,
-    internal_links JSON,
-    external_links JSON,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-	`
-
-	_, err = DB.Exec(queryUrls)
-	if err != nil {
-		log.Fatalf("Failed to create urls table: %v", err)
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD")),
+		Host:     net.JoinHostPort(os.Getenv("DB_HOST"), os.Getenv("DB_PORT")),
+		Path:     "/" + os.Getenv("DB_NAME"),
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
 	}
+	return dsn.String()
+}
 
-	fmt.Println("Successfully connected to MySQL database and ensured tables (users, urls) exists")
+// SQLite database file from DB_PATH (default web-crawler.db). Foreign keys are off in SQLite unless asked for, WAL lets
+// readers work during a write and transactions take the write lock up front so they wait for each other instead of failing
+func sqliteDSN() string {
+	path := os.Getenv("DB_PATH")
+	if path == "" {
+		path = "web-crawler.db"
+	}
+	return "file:" + path + "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=10000&_txlock=immediate"
 }
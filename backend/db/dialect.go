@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// SQL flavor of the database, chosen with DB_DRIVER
+type Dialect string
+
+const (
+	MySQL    Dialect = "mysql"
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// Dialect of DB, set by Connect
+var Driver = MySQL
+
+// The dialect named by DB_DRIVER, MySQL when it is empty. postgresql and sqlite3 are accepted too
+func ParseDialect(name string) (Dialect, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "mysql":
+		return MySQL, nil
+	case "postgres", "postgresql":
+		return Postgres, nil
+	case "sqlite", "sqlite3":
+		return SQLite, nil
+	}
+	return "", fmt.Errorf("unknown DB_DRIVER %q, use mysql, postgres or sqlite", name)
+}
+
+// Name of the dialect for messages
+func (d Dialect) String() string {
+	switch d {
+	case Postgres:
+		return "PostgreSQL"
+	case SQLite:
+		return "SQLite"
+	}
+	return "MySQL"
+}
+
+// Turn an "INSERT INTO ..." statement into one that skips rows repeating a unique key
+func (d Dialect) InsertIgnore(insert string) string {
+	switch d {
+	case Postgres:
+		return insert + " ON CONFLICT DO NOTHING"
+	case SQLite:
+		return strings.Replace(insert, "INSERT INTO", "INSERT OR IGNORE INTO", 1)
+	}
+	return strings.Replace(insert, "INSERT INTO", "INSERT IGNORE INTO", 1)
+}
+
+// Clause that turns an INSERT repeating the unique key into an update, followed by the assignments:
+// ON DUPLICATE KEY UPDATE for MySQL, ON CONFLICT (key) DO UPDATE SET for the others
+func (d Dialect) OnConflictUpdate(key string) string {
+	if d == MySQL {
+		return " ON DUPLICATE KEY UPDATE "
+	}
+	return " ON CONFLICT (" + key + ") DO UPDATE SET "
+}
+
+// The value the INSERT tried to write to column, in the assignments of OnConflictUpdate
+func (d Dialect) Excluded(column string) string {
+	if d == MySQL {
+		return "VALUES(" + column + ")"
+	}
+	return "excluded." + column
+}
+
+// Condition matching column against a LIKE pattern without case, with \ escaping % and _ like MySQL does by default
+func (d Dialect) ILike(column string) string {
+	switch d {
+	case Postgres:
+		return column + " ILIKE ?"
+	case SQLite:
+		return column + ` LIKE ? ESCAPE '\'`
+	}
+	return column + " LIKE ?"
+}
+
+// Something that runs statements, a *sql.DB, *sql.Tx or *sql.Conn
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Run an INSERT into a table with an id column and return the id of the new row. PostgreSQL has no LastInsertId,
+// the id comes back with RETURNING
+func (d Dialect) InsertID(execer Execer, query string, args ...interface{}) (int64, error) {
+	ctx := context.Background()
+	if d == Postgres {
+		var id int64
+		err := execer.QueryRowContext(ctx, query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+	res, err := execer.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// Whether err is the database refusing a row that repeats a unique key
+func IsDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	// The SQLite error type only exists in cgo builds, its message is stable
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// Take the named lock on conn, waiting up to timeout (0 tries once). Returns false when another session holds it.
+// MySQL and PostgreSQL locks are server wide, so two instances of the server never hold the same one. An SQLite file
+// belongs to one server, there is nothing to lock
+func (d Dialect) Lock(ctx context.Context, conn *sql.Conn, name string, timeout time.Duration) (bool, error) {
+	switch d {
+	case MySQL:
+		var locked sql.NullInt64
+		if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, int(timeout/time.Second)).Scan(&locked); err != nil {
+			return false, err
+		}
+		return locked.Valid && locked.Int64 == 1, nil
+	case Postgres:
+		deadline := time.Now().Add(timeout)
+		for {
+			var locked bool
+			if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(?)", advisoryLockKey(name)).Scan(&locked); err != nil {
+				return false, err
+			}
+			if locked || !time.Now().Before(deadline) {
+				return locked, nil
+			}
+			time.Sleep(500 * time.Millisecond)
+		}
+	}
+	return true, nil
+}
+
+// Release a lock taken with Lock on the same connection
+func (d Dialect) Unlock(ctx context.Context, conn *sql.Conn, name string) error {
+	var err error
+	switch d {
+	case MySQL:
+		_, err = conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", name)
+	case Postgres:
+		_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock(?)", advisoryLockKey(name))
+	}
+	return err
+}
+
+// PostgreSQL advisory locks are numbered, the number of a lock is the hash of its name
+func advisoryLockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
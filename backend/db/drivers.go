@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Names of the PostgreSQL and SQLite drivers the queries go through. The code writes ? placeholders like MySQL takes
+// them, the PostgreSQL driver wraps lib/pq and numbers them ($1, $2, ...) the way PostgreSQL wants. The SQLite driver
+// wraps go-sqlite3 and stores times as UTC text in the format of CURRENT_TIMESTAMP, see timeToUTC
+const (
+	postgresDriverName = "postgres-placeholders"
+	sqliteDriverName   = "sqlite3-utc"
+)
+
+func init() {
+	sql.Register(postgresDriverName, wrappedDriver{Driver: &pq.Driver{}, rewrite: numberPlaceholders, convert: nilBytesToNull})
+	sql.Register(sqliteDriverName, wrappedDriver{Driver: &sqlite3.SQLiteDriver{}, rewrite: func(query string) string { return query }, convert: timeToUTC})
+}
+
+// A driver whose connections rewrite every statement and convert every argument before the wrapped driver sees them
+type wrappedDriver struct {
+	driver.Driver
+	rewrite func(query string) string
+	convert func(value driver.Value) driver.Value
+}
+
+func (d wrappedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return wrappedConn{conn, d}, nil
+}
+
+// lib/pq and go-sqlite3 connections implement the context interfaces the methods below forward to
+type wrappedConn struct {
+	driver.Conn
+	driver wrappedDriver
+}
+
+func (c wrappedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(c.driver.rewrite(query))
+}
+
+func (c wrappedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, c.driver.rewrite(query))
+}
+
+func (c wrappedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, c.driver.rewrite(query), args)
+}
+
+func (c wrappedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, c.driver.rewrite(query), args)
+}
+
+func (c wrappedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c wrappedConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c wrappedConn) CheckNamedValue(value *driver.NamedValue) error {
+	converted, err := driver.DefaultParameterConverter.ConvertValue(value.Value)
+	if err != nil {
+		return err
+	}
+	value.Value = c.driver.convert(converted)
+	return nil
+}
+
+// A nil []byte is NULL, like the MySQL and SQLite drivers store it. lib/pq would send an empty value, which is not valid JSON
+func nilBytesToNull(value driver.Value) driver.Value {
+	if b, ok := value.([]byte); ok && b == nil {
+		return nil
+	}
+	return value
+}
+
+// SQLite has no time type and compares times as text, so every time has to be stored in one format: the one of
+// CURRENT_TIMESTAMP, which the column defaults write. go-sqlite3 would write its own with fractions and an offset,
+// which sorts apart from it
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+func timeToUTC(value driver.Value) driver.Value {
+	if t, ok := value.(time.Time); ok {
+		return t.UTC().Format(sqliteTimeFormat)
+	}
+	return value
+}
+
+// Replace the ? placeholders of query with $1, $2, ... Question marks in quoted strings and identifiers are left alone
+func numberPlaceholders(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"':
+			quote = ch
+		case ch == '?':
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String()
+}
@@ -0,0 +1,393 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/migrations"
+)
+
+// A numbered schema change read from the embedded migrations directory
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State of one migration in the database
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt *time.Time
+}
+
+// Name of the lock held while migrating, see Dialect.Lock. Two instances never migrate at once
+const migrationLockName = "go-react-crawler:schema_migrations"
+
+// How long an instance waits for another one to finish migrating
+const migrationLockTimeout = 60 * time.Second
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Read and pair the up and down files, ordered by version
+func loadMigrations(files fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s does not match NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(files, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has files with different names (%s and %s)", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", migration.Version, migration.Name)
+		}
+		list = append(list, *migration)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Split a migration file into statements. Statements end with a semicolon at the end of a line, lines starting with -- are comments
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// Run fn on a dedicated connection that holds the migration lock, with the schema_migrations table in place
+func withMigrationLock(fn func(ctx context.Context, conn *sql.Conn, list []Migration) error) error {
+	// Every dialect has its own directory of migrations
+	files, err := fs.Sub(migrations.Files, string(Driver))
+	if err != nil {
+		return err
+	}
+	list, err := loadMigrations(files)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	// MySQL and PostgreSQL locks belong to the session, so everything runs on one connection
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	locked, err := Driver.Lock(ctx, conn, migrationLockName, migrationLockTimeout)
+	if err != nil {
+		return err
+	}
+	if !locked {
+		return fmt.Errorf("another instance is migrating the database, gave up after %s", migrationLockTimeout)
+	}
+	defer Driver.Unlock(ctx, conn, migrationLockName)
+
+	// dirty marks a migration that started but did not finish. MySQL commits DDL implicitly, so a failed migration
+	// can leave part of its changes behind and needs a look by hand before anything else runs
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		dirty BOOLEAN NOT NULL DEFAULT FALSE,
+		applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations table: %v", err)
+	}
+
+	return fn(ctx, conn, list)
+}
+
+// Versions recorded in schema_migrations with their dirty flag and time
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var status MigrationStatus
+		var appliedAt time.Time
+		if err := rows.Scan(&status.Version, &status.Name, &status.Dirty, &appliedAt); err != nil {
+			return nil, err
+		}
+		status.Applied = true
+		status.AppliedAt = &appliedAt
+		applied[status.Version] = status
+	}
+	return applied, rows.Err()
+}
+
+func checkNotDirty(applied map[int]MigrationStatus) error {
+	for _, status := range applied {
+		if status.Dirty {
+			return fmt.Errorf("migration %d_%s did not finish, fix the schema by hand and record the last complete version with `migrate force VERSION`", status.Version, status.Name)
+		}
+	}
+	return nil
+}
+
+// Apply every pending migration in order. Returns the versions that were applied
+func Migrate() ([]int, error) {
+	var done []int
+	err := withMigrationLock(func(ctx context.Context, conn *sql.Conn, list []Migration) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkNotDirty(applied); err != nil {
+			return err
+		}
+
+		// MySQL databases created before migrations existed already have the tables, bring their columns up to the first migrations
+		if len(applied) == 0 && Driver == MySQL {
+			if err := upgradeLegacySchema(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		for _, migration := range list {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			done = append(done, migration.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Revert the newest applied migrations, steps of them. Returns the versions that were rolled back
+func Rollback(steps int) ([]int, error) {
+	var done []int
+	err := withMigrationLock(func(ctx context.Context, conn *sql.Conn, list []Migration) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := checkNotDirty(applied); err != nil {
+			return err
+		}
+
+		for i := len(list) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := list[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down file and cannot be rolled back", migration.Version, migration.Name)
+			}
+			if err := runMigration(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			done = append(done, migration.Version)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Every known migration with its state, plus versions recorded in the database that this binary does not know
+func MigrationStatuses() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := withMigrationLock(func(ctx context.Context, conn *sql.Conn, list []Migration) error {
+		applied, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range list {
+			status, ok := applied[migration.Version]
+			if !ok {
+				status = MigrationStatus{Version: migration.Version, Name: migration.Name}
+			}
+			delete(applied, migration.Version)
+			statuses = append(statuses, status)
+		}
+		for _, status := range applied {
+			status.Name += " (unknown to this build)"
+			statuses = append(statuses, status)
+		}
+		sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+		return nil
+	})
+	return statuses, err
+}
+
+// Record the schema as migrated up to version and clear the dirty flag, for recovering from a failed migration by hand.
+// Versions above it are forgotten, versions up to it are marked applied
+func ForceVersion(version int) error {
+	return withMigrationLock(func(ctx context.Context, conn *sql.Conn, list []Migration) error {
+		if _, err := conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version > ?", version); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = FALSE"); err != nil {
+			return err
+		}
+		for _, migration := range list {
+			if migration.Version > version {
+				break
+			}
+			_, err := conn.ExecContext(ctx, Driver.InsertIgnore("INSERT INTO schema_migrations (version, name) VALUES (?, ?)"), migration.Version, migration.Name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Apply (up) or revert one migration. The version is marked dirty while its statements run
+func runMigration(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	script, direction := migration.Up, "up"
+	if !up {
+		script, direction = migration.Down, "down"
+	}
+
+	var err error
+	if up {
+		_, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, TRUE)", migration.Version, migration.Name)
+	} else {
+		_, err = conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = TRUE WHERE version = ?", migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range splitStatements(script) {
+		if _, err := conn.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("migration %d_%s (%s) failed: %v", migration.Version, migration.Name, direction, err)
+		}
+	}
+
+	if up {
+		_, err = conn.ExecContext(ctx, "UPDATE schema_migrations SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = ?", migration.Version)
+	} else {
+		_, err = conn.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Migration %d_%s %s", migration.Version, migration.Name, direction)
+	return nil
+}
+
+// Columns the urls and snapshots tables gained before migrations existed. A database from that time has the tables
+// but maybe not these columns, the first migrations only create missing tables
+func upgradeLegacySchema(ctx context.Context, conn *sql.Conn) error {
+	var tables int
+	err := conn.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'urls'
+	`).Scan(&tables)
+	if err != nil || tables == 0 {
+		return err
+	}
+
+	columns := []struct{ table, column, definition string }{
+		{"urls", "response_meta", "JSON"},
+		{"urls", "security_audit", "JSON"},
+		{"urls", "technologies", "JSON"},
+		{"urls", "resources", "JSON"},
+		{"urls", "content_analysis", "JSON"},
+		{"urls", "meta_description", "VARCHAR(1024)"},
+		{"urls", "content_simhash", "CHAR(16)"},
+		{"urls", "extracted_data", "JSON"},
+		{"urls", "charset_report", "JSON"},
+		{"urls", "broken_anchors_count", "INT DEFAULT 0"},
+		{"urls", "broken_anchors", "JSON"},
+		{"urls", "result_kind", "VARCHAR(16)"},
+		{"urls", "document_info", "JSON"},
+		{"urls", "rendered_result", "JSON"},
+		{"snapshots", "warc", "LONGBLOB"},
+		{"snapshots", "har", "JSON"},
+	}
+	for _, c := range columns {
+		if err := ensureColumn(ctx, conn, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add a column to an existing table if it does not have it yet, a missing table is left for the migrations to create
+func ensureColumn(ctx context.Context, conn *sql.Conn, table, column, definition string) error {
+	var tableCount, columnCount int
+	err := conn.QueryRowContext(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?),
+			(SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?)
+	`, table, table, column).Scan(&tableCount, &columnCount)
+	if err != nil {
+		return fmt.Errorf("inspect %s table: %v", table, err)
+	}
+	if tableCount == 0 || columnCount > 0 {
+		return nil
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("add column %s to %s table: %v", column, table, err)
+	}
+	return nil
+}
@@ -1,21 +1,42 @@
 package main
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/cors" // CORS middleware
 	"github.com/gin-gonic/gin"
 	"github.com/kiwiscode/go-react-crawler/db"
 	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/repository"
 	"github.com/kiwiscode/go-react-crawler/routes"
+	"github.com/kiwiscode/go-react-crawler/utils"
 )
 
 func main() {
+	// `go run . migrate [up|down [N]|status|force VERSION]` manages the schema without starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
 
-	// Initialize the database connection and ensure tables(users, urls) exist
+	// Initialize the database connection and apply pending schema migrations
 	db.Init()
+	// The handlers read and write everything through the repositories of the database chosen with DB_DRIVER
+	repos := repository.NewSQL(db.DB, db.Driver)
+	routes.UseRepositories(repos)
+	// Analyses stored before URLs were normalized get their normalized URL, so they are found again when submitted
+	if filled, err := repos.Analyses.BackfillNormalizedURLs(utils.NormalizeURLFromEnv); err != nil {
+		log.Printf("Could not normalize the URLs of existing analyses: %v", err)
+	} else if filled > 0 {
+		log.Printf("Normalized the URLs of %d existing analyses", filled)
+	}
+	// Prune the runs and snapshots the retention policies no longer keep, in the background
+	routes.StartRetentionJanitor()
 
 	// Create a Gin router with default middleware (logger and recovery)
 	r := gin.Default()
@@ -46,11 +67,85 @@ func main() {
 		})
 	})
 
-	// Register routes for auth, profile and analyze features
+	// Register routes for auth, profile, analyze, extraction, snapshot, run history, link, search, project, tag and retention features
 	routes.AuthRoutes(r)
 	routes.ProfileRoutes(r)
 	routes.AnalyzeRoutes(r)
+	routes.ExtractionRoutes(r)
+	routes.SnapshotRoutes(r)
+	routes.RunRoutes(r)
+	routes.LinkRoutes(r)
+	routes.SearchRoutes(r)
+	routes.ProjectRoutes(r)
+	routes.TagRoutes(r)
+	routes.RetentionRoutes(r)
 
 	// Start the HTTP server on default port 8080
 	r.Run(":8080")
 }
+
+// Migrate subcommand: up applies pending migrations (the default), down reverts the last N (default 1),
+// status lists every migration and force records a version after a failed migration was fixed by hand
+func runMigrate(args []string) {
+	db.Connect()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := db.Migrate()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				log.Fatalf("Invalid number of steps: %s", args[1])
+			}
+			steps = n
+		}
+		reverted, err := db.Rollback(steps)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+	case "status":
+		statuses, err := db.MigrationStatuses()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.Dirty {
+				state = "dirty"
+			} else if status.Applied {
+				state = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, state)
+		}
+	case "force":
+		if len(args) < 2 {
+			log.Fatal("Usage: migrate force VERSION")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			log.Fatalf("Invalid version: %s", args[1])
+		}
+		if err := db.ForceVersion(version); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Schema version set to %d\n", version)
+	default:
+		log.Fatalf("Unknown migrate command %q, use up, down [N], status or force VERSION", command)
+	}
+}
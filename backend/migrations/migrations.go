@@ -0,0 +1,14 @@
+// Package migrations holds the numbered schema migrations, embedded in the binary, in one directory per database
+// dialect (mysql, postgres, sqlite).
+//
+// Every change to the schema is a pair of files: NNNN_description.up.sql applies it and NNNN_description.down.sql reverts it.
+// Numbers are never reused or edited once released, a new change gets the next number in every dialect directory.
+// Statements end with a semicolon at the end of a line.
+//
+// PostgreSQL and SQLite support came with version 11: their first migration creates the whole schema at that version
+package migrations
+
+import "embed"
+
+//go:embed mysql/*.sql postgres/*.sql sqlite/*.sql
+var Files embed.FS
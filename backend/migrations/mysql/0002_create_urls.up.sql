@@ -0,0 +1,35 @@
+-- Analyses: the URL, its processing status and the latest result
+CREATE TABLE IF NOT EXISTS urls (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    url VARCHAR(2048) NOT NULL,
+    status ENUM('queued', 'running', 'done', 'error') DEFAULT 'queued',
+    should_pause BOOLEAN DEFAULT FALSE,
+    title VARCHAR(255),
+    html_version VARCHAR(50),
+    heading_counts JSON,
+    internal_links_count INT DEFAULT 0,
+    external_links_count INT DEFAULT 0,
+    has_login_form BOOLEAN DEFAULT FALSE,
+    inaccessible_links_count INT DEFAULT 0,
+    inaccessible_links JSON,
+    internal_links JSON,
+    external_links JSON,
+    response_meta JSON,
+    security_audit JSON,
+    technologies JSON,
+    resources JSON,
+    content_analysis JSON,
+    meta_description VARCHAR(1024),
+    content_simhash CHAR(16),
+    extracted_data JSON,
+    charset_report JSON,
+    broken_anchors_count INT DEFAULT 0,
+    broken_anchors JSON,
+    result_kind VARCHAR(16),
+    document_info JSON,
+    rendered_result JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS analysis_extraction_rules;
+DROP TABLE IF EXISTS extraction_rules;
@@ -0,0 +1,22 @@
+-- User-defined CSS or XPath fields to pull out of pages
+CREATE TABLE IF NOT EXISTS extraction_rules (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    selector_type ENUM('css', 'xpath') NOT NULL,
+    selector VARCHAR(1024) NOT NULL,
+    attribute VARCHAR(100) NOT NULL DEFAULT '',
+    multiple BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_extraction_rules_user_name (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Attaches rules to analyses
+CREATE TABLE IF NOT EXISTS analysis_extraction_rules (
+    url_id INT NOT NULL,
+    rule_id INT NOT NULL,
+    PRIMARY KEY (url_id, rule_id),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+    FOREIGN KEY (rule_id) REFERENCES extraction_rules(id) ON DELETE CASCADE
+);
@@ -0,0 +1,26 @@
+-- Gzipped response bodies addressed by their SHA-256, unchanged pages are stored once
+CREATE TABLE IF NOT EXISTS snapshot_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    body LONGBLOB NOT NULL,
+    size BIGINT NOT NULL,
+    compressed_size BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per analysis run with the response headers, the body hash and the WARC and HAR exports
+CREATE TABLE IF NOT EXISTS snapshots (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    url_id INT NOT NULL,
+    blob_hash CHAR(64) NOT NULL,
+    final_url TEXT NOT NULL,
+    status_code INT NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    headers JSON,
+    warc LONGBLOB,
+    har JSON,
+    fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_snapshots_url_fetched (url_id, fetched_at),
+    INDEX idx_snapshots_blob (blob_hash),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
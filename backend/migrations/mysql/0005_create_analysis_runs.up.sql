@@ -0,0 +1,22 @@
+-- One row per analysis run with its full result, so a re-run no longer loses the previous one.
+-- The summary columns are copies from the result for listing runs without reading it
+CREATE TABLE IF NOT EXISTS analysis_runs (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    url_id INT NOT NULL,
+    snapshot_id INT NULL,
+    status ENUM('queued', 'running', 'done', 'error') NOT NULL,
+    error TEXT,
+    final_url TEXT,
+    status_code INT NOT NULL DEFAULT 0,
+    internal_links_count INT NOT NULL DEFAULT 0,
+    external_links_count INT NOT NULL DEFAULT 0,
+    inaccessible_links_count INT NOT NULL DEFAULT 0,
+    broken_anchors_count INT NOT NULL DEFAULT 0,
+    result JSON,
+    started_at DATETIME(3) NOT NULL,
+    finished_at DATETIME(3) NOT NULL,
+    duration_ms INT NOT NULL DEFAULT 0,
+    INDEX idx_analysis_runs_url (url_id, id),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+    FOREIGN KEY (snapshot_id) REFERENCES snapshots(id) ON DELETE SET NULL
+);
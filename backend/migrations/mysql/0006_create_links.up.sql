@@ -0,0 +1,40 @@
+-- Links of the latest run of every analysis as rows, so they can be queried across analyses: which pages link to a URL,
+-- which domains are linked and how many of those links are broken. target_domain is the lowercased host of target_url
+CREATE TABLE IF NOT EXISTS links (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    url_id INT NOT NULL,
+    kind ENUM('internal', 'external', 'inaccessible') NOT NULL,
+    target_url TEXT NOT NULL,
+    target_domain VARCHAR(255) NOT NULL DEFAULT '',
+    anchor_text TEXT,
+    rel VARCHAR(255) NOT NULL DEFAULT '',
+    check_status ENUM('unchecked', 'broken') NOT NULL DEFAULT 'unchecked',
+    check_error VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX idx_links_url_kind (url_id, kind),
+    INDEX idx_links_user_target (user_id, target_url(255)),
+    INDEX idx_links_user_domain (user_id, target_domain, check_status),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+
+-- Existing analyses: copy the links out of the JSON columns. The host is cut out of the URL between :// and the first / ? # or :
+INSERT INTO links (user_id, url_id, kind, target_url, target_domain, anchor_text, rel)
+SELECT u.user_id, u.id, 'internal', l.url,
+    IF(l.url LIKE '%://%', LEFT(LOWER(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(l.url, '://', -1), '/', 1), '?', 1), '#', 1), '@', -1), ':', 1)), 255), ''),
+    COALESCE(l.text, ''), LEFT(COALESCE(l.rel, ''), 255)
+FROM urls u, JSON_TABLE(u.internal_links, '$[*]' COLUMNS (url TEXT PATH '$.url', text TEXT PATH '$.text', rel TEXT PATH '$.rel')) l
+WHERE l.url IS NOT NULL;
+
+INSERT INTO links (user_id, url_id, kind, target_url, target_domain, anchor_text, rel)
+SELECT u.user_id, u.id, 'external', l.url,
+    IF(l.url LIKE '%://%', LEFT(LOWER(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(l.url, '://', -1), '/', 1), '?', 1), '#', 1), '@', -1), ':', 1)), 255), ''),
+    COALESCE(l.text, ''), LEFT(COALESCE(l.rel, ''), 255)
+FROM urls u, JSON_TABLE(u.external_links, '$[*]' COLUMNS (url TEXT PATH '$.url', text TEXT PATH '$.text', rel TEXT PATH '$.rel')) l
+WHERE l.url IS NOT NULL;
+
+INSERT INTO links (user_id, url_id, kind, target_url, target_domain, anchor_text, rel, check_status, check_error)
+SELECT u.user_id, u.id, 'inaccessible', l.url, '', COALESCE(l.text, ''), LEFT(COALESCE(l.rel, ''), 255), 'broken', 'invalid_url'
+FROM urls u, JSON_TABLE(u.inaccessible_links, '$[*]' COLUMNS (url TEXT PATH '$.url', text TEXT PATH '$.text', rel TEXT PATH '$.rel')) l
+WHERE l.url IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP INDEX idx_urls_user_status ON urls;
+DROP INDEX idx_urls_user_created ON urls;
+DROP INDEX idx_urls_user_updated ON urls;
+DROP INDEX idx_urls_user_title ON urls;
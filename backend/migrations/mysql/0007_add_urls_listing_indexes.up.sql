@@ -0,0 +1,5 @@
+-- Indexes of the paginated listing: the user's rows in the order of the common sort columns and by status
+CREATE INDEX idx_urls_user_status ON urls (user_id, status, id);
+CREATE INDEX idx_urls_user_created ON urls (user_id, created_at, id);
+CREATE INDEX idx_urls_user_updated ON urls (user_id, updated_at, id);
+CREATE INDEX idx_urls_user_title ON urls (user_id, title, id);
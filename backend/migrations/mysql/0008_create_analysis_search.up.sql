@@ -0,0 +1,21 @@
+-- Text of each analysis for the search box: the URL, the title, the anchor texts of its links and the main text of the page
+CREATE TABLE IF NOT EXISTS analysis_search (
+    url_id INT PRIMARY KEY,
+    user_id INT NOT NULL,
+    url TEXT NOT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    link_text MEDIUMTEXT NOT NULL,
+    content MEDIUMTEXT NOT NULL,
+    INDEX idx_analysis_search_user (user_id),
+    FULLTEXT INDEX ft_analysis_search_all (title, url, link_text, content),
+    FULLTEXT INDEX ft_analysis_search_title (title),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE
+);
+
+-- Existing analyses are searchable by URL, title and link text, their page text is added on the next run
+SET SESSION group_concat_max_len = 1048576;
+INSERT INTO analysis_search (url_id, user_id, url, title, link_text, content)
+SELECT u.id, u.user_id, u.url, COALESCE(u.title, ''),
+    COALESCE((SELECT GROUP_CONCAT(DISTINCT l.anchor_text SEPARATOR '\n') FROM links l WHERE l.url_id = u.id AND l.anchor_text <> ''), ''),
+    ''
+FROM urls u;
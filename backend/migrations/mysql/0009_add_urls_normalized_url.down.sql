@@ -0,0 +1,4 @@
+ALTER TABLE urls
+    DROP INDEX uq_urls_user_normalized_url,
+    DROP COLUMN normalized_url_hash,
+    DROP COLUMN normalized_url;
@@ -0,0 +1,6 @@
+-- Normalized form of the URL (utils.NormalizeURL), one analysis per normalized URL and user. The unique index is on a hash
+-- because the URL is longer than an index key can be. Existing rows are filled in by the server on start
+ALTER TABLE urls
+    ADD COLUMN normalized_url VARCHAR(2048) NULL AFTER url,
+    ADD COLUMN normalized_url_hash CHAR(64) AS (SHA2(normalized_url, 256)) STORED AFTER normalized_url,
+    ADD UNIQUE INDEX uq_urls_user_normalized_url (user_id, normalized_url_hash);
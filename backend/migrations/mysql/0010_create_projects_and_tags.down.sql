@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS analysis_tags;
+DROP TABLE IF EXISTS tags;
+ALTER TABLE urls
+    DROP FOREIGN KEY fk_urls_project,
+    DROP INDEX idx_urls_user_project,
+    DROP COLUMN project_id;
+DROP TABLE IF EXISTS projects;
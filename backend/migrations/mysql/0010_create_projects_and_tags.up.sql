@@ -0,0 +1,36 @@
+-- Projects group a user's analyses, settings holds the defaults of the analyses created in them (renderer, extraction rules)
+CREATE TABLE IF NOT EXISTS projects (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    description TEXT,
+    settings JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    UNIQUE KEY uniq_projects_user_name (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- An analysis belongs to at most one project, deleting the project keeps its analyses
+ALTER TABLE urls
+    ADD COLUMN project_id INT NULL AFTER user_id,
+    ADD INDEX idx_urls_user_project (user_id, project_id),
+    ADD CONSTRAINT fk_urls_project FOREIGN KEY (project_id) REFERENCES projects(id) ON DELETE SET NULL;
+
+-- Free-form labels of a user, attached to any number of analyses
+CREATE TABLE IF NOT EXISTS tags (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(50) NOT NULL,
+    UNIQUE KEY uniq_tags_user_name (user_id, name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS analysis_tags (
+    url_id INT NOT NULL,
+    tag_id INT NOT NULL,
+    PRIMARY KEY (url_id, tag_id),
+    INDEX idx_analysis_tags_tag (tag_id),
+    FOREIGN KEY (url_id) REFERENCES urls(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
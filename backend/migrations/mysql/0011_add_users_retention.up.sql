@@ -0,0 +1,2 @@
+-- Retention policy of a user's analyses (keep_runs, keep_days), NULL uses the server default
+ALTER TABLE users ADD COLUMN retention JSON NULL;
@@ -0,0 +1,12 @@
+-- The requests and responses of a run without their bodies, the WARC export is written from them when it is downloaded.
+-- warc is only read for runs stored before
+ALTER TABLE snapshots ADD COLUMN exchanges JSON NULL;
+
+-- Response bodies of the exchanges of a run, stored in snapshot_blobs by hash like the page body
+CREATE TABLE IF NOT EXISTS snapshot_exchange_blobs (
+    snapshot_id INT NOT NULL,
+    blob_hash CHAR(64) NOT NULL,
+    PRIMARY KEY (snapshot_id, blob_hash),
+    INDEX idx_snapshot_exchange_blobs_blob (blob_hash),
+    FOREIGN KEY (snapshot_id) REFERENCES snapshots(id) ON DELETE CASCADE
+);
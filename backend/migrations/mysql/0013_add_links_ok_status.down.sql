@@ -0,0 +1,2 @@
+UPDATE links SET check_status = 'unchecked' WHERE check_status = 'ok';
+ALTER TABLE links MODIFY check_status ENUM('unchecked', 'broken') NOT NULL DEFAULT 'unchecked';
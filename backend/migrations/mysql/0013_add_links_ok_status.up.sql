@@ -0,0 +1,2 @@
+-- Link targets are requested during the analysis: ok when they answered below 400, broken with the reason otherwise
+ALTER TABLE links MODIFY check_status ENUM('unchecked', 'ok', 'broken') NOT NULL DEFAULT 'unchecked';
@@ -0,0 +1 @@
+ALTER TABLE analysis_runs MODIFY status ENUM('queued', 'running', 'done', 'error') NOT NULL;
@@ -0,0 +1,4 @@
+-- A stored run is always over, the queued and running states belong to the analysis. Runs stored by the steps before
+-- the end of the chain get the outcome they had
+UPDATE analysis_runs SET status = CASE WHEN error IS NULL OR error = '' THEN 'done' ELSE 'error' END WHERE status IN ('queued', 'running');
+ALTER TABLE analysis_runs MODIFY status ENUM('done', 'error') NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS snapshot_exchange_blobs;
+ALTER TABLE snapshots DROP COLUMN exchanges;
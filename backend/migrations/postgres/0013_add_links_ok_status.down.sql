@@ -0,0 +1,3 @@
+UPDATE links SET check_status = 'unchecked' WHERE check_status = 'ok';
+ALTER TABLE links DROP CONSTRAINT IF EXISTS links_check_status_check;
+ALTER TABLE links ADD CONSTRAINT links_check_status_check CHECK (check_status IN ('unchecked', 'broken'));
@@ -0,0 +1,3 @@
+-- Link targets are requested during the analysis: ok when they answered below 400, broken with the reason otherwise
+ALTER TABLE links DROP CONSTRAINT IF EXISTS links_check_status_check;
+ALTER TABLE links ADD CONSTRAINT links_check_status_check CHECK (check_status IN ('unchecked', 'ok', 'broken'));
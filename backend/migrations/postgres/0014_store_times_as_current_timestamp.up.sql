@@ -0,0 +1,2 @@
+-- Only SQLite stored times in two formats, see the SQLite migration
+SELECT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE analysis_runs DROP CONSTRAINT IF EXISTS analysis_runs_status_check;
+ALTER TABLE analysis_runs ADD CONSTRAINT analysis_runs_status_check CHECK (status IN ('queued', 'running', 'done', 'error'));
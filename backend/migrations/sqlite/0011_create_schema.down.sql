@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS analysis_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS analysis_search;
+DROP TABLE IF EXISTS links;
+DROP TABLE IF EXISTS analysis_runs;
+DROP TABLE IF EXISTS snapshots;
+DROP TABLE IF EXISTS snapshot_blobs;
+DROP TABLE IF EXISTS analysis_extraction_rules;
+DROP TABLE IF EXISTS extraction_rules;
+DROP TABLE IF EXISTS urls;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,175 @@
+-- The schema of the MySQL migrations 0001 to 0011 in one step, SQLite databases start at version 11.
+-- NOCASE compares names and emails without case like the MySQL collation does, JSON columns hold the JSON as text
+-- Accounts, every analysis belongs to a user. retention holds the user's retention policy (keep_runs, keep_days)
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username VARCHAR(50) NOT NULL UNIQUE COLLATE NOCASE,
+    email VARCHAR(100) NOT NULL UNIQUE COLLATE NOCASE,
+    password VARCHAR(255) NOT NULL,
+    retention JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Projects group a user's analyses, settings holds the defaults of the analyses created in them
+CREATE TABLE IF NOT EXISTS projects (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL COLLATE NOCASE,
+    description TEXT,
+    settings JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+-- Analyses: the URL, its processing status and the latest result. One analysis per normalized URL and user,
+-- SQLite indexes the URL itself
+CREATE TABLE IF NOT EXISTS urls (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id INT NULL REFERENCES projects(id) ON DELETE SET NULL,
+    url VARCHAR(2048) NOT NULL,
+    normalized_url VARCHAR(2048) NULL,
+    status VARCHAR(16) DEFAULT 'queued' CHECK (status IN ('queued', 'running', 'done', 'error')),
+    should_pause BOOLEAN DEFAULT FALSE,
+    title VARCHAR(255),
+    html_version VARCHAR(50),
+    heading_counts JSON,
+    internal_links_count INT DEFAULT 0,
+    external_links_count INT DEFAULT 0,
+    has_login_form BOOLEAN DEFAULT FALSE,
+    inaccessible_links_count INT DEFAULT 0,
+    inaccessible_links JSON,
+    internal_links JSON,
+    external_links JSON,
+    response_meta JSON,
+    security_audit JSON,
+    technologies JSON,
+    resources JSON,
+    content_analysis JSON,
+    meta_description VARCHAR(1024),
+    content_simhash CHAR(16),
+    extracted_data JSON,
+    charset_report JSON,
+    broken_anchors_count INT DEFAULT 0,
+    broken_anchors JSON,
+    result_kind VARCHAR(16),
+    document_info JSON,
+    rendered_result JSON,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, normalized_url)
+);
+CREATE INDEX IF NOT EXISTS idx_urls_user_status ON urls (user_id, status, id);
+CREATE INDEX IF NOT EXISTS idx_urls_user_created ON urls (user_id, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_urls_user_updated ON urls (user_id, updated_at, id);
+CREATE INDEX IF NOT EXISTS idx_urls_user_title ON urls (user_id, title, id);
+CREATE INDEX IF NOT EXISTS idx_urls_user_project ON urls (user_id, project_id);
+
+-- User-defined CSS or XPath fields to pull out of pages, and the analyses they are attached to
+CREATE TABLE IF NOT EXISTS extraction_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL COLLATE NOCASE,
+    selector_type VARCHAR(8) NOT NULL CHECK (selector_type IN ('css', 'xpath')),
+    selector VARCHAR(1024) NOT NULL,
+    attribute VARCHAR(100) NOT NULL DEFAULT '',
+    multiple BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS analysis_extraction_rules (
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    rule_id INT NOT NULL REFERENCES extraction_rules(id) ON DELETE CASCADE,
+    PRIMARY KEY (url_id, rule_id)
+);
+
+-- Gzipped response bodies addressed by their SHA-256, and one snapshot per analysis run pointing to its body
+CREATE TABLE IF NOT EXISTS snapshot_blobs (
+    hash CHAR(64) PRIMARY KEY,
+    body BLOB NOT NULL,
+    size BIGINT NOT NULL,
+    compressed_size BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    blob_hash CHAR(64) NOT NULL,
+    final_url TEXT NOT NULL,
+    status_code INT NOT NULL,
+    content_type VARCHAR(255) NOT NULL DEFAULT '',
+    headers JSON,
+    warc BLOB,
+    har JSON,
+    fetched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_snapshots_url_fetched ON snapshots (url_id, fetched_at);
+CREATE INDEX IF NOT EXISTS idx_snapshots_blob ON snapshots (blob_hash);
+
+-- One row per analysis run with its full result
+CREATE TABLE IF NOT EXISTS analysis_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    snapshot_id INT NULL REFERENCES snapshots(id) ON DELETE SET NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('queued', 'running', 'done', 'error')),
+    error TEXT,
+    final_url TEXT,
+    status_code INT NOT NULL DEFAULT 0,
+    internal_links_count INT NOT NULL DEFAULT 0,
+    external_links_count INT NOT NULL DEFAULT 0,
+    inaccessible_links_count INT NOT NULL DEFAULT 0,
+    broken_anchors_count INT NOT NULL DEFAULT 0,
+    result JSON,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NOT NULL,
+    duration_ms INT NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_analysis_runs_url ON analysis_runs (url_id, id);
+
+-- Links of the latest run of every analysis as rows
+CREATE TABLE IF NOT EXISTS links (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('internal', 'external', 'inaccessible')),
+    target_url TEXT NOT NULL,
+    target_domain VARCHAR(255) NOT NULL DEFAULT '',
+    anchor_text TEXT,
+    rel VARCHAR(255) NOT NULL DEFAULT '',
+    check_status VARCHAR(16) NOT NULL DEFAULT 'unchecked' CHECK (check_status IN ('unchecked', 'broken')),
+    check_error VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_links_url_kind ON links (url_id, kind);
+CREATE INDEX IF NOT EXISTS idx_links_user_target ON links (user_id, target_url);
+CREATE INDEX IF NOT EXISTS idx_links_user_domain ON links (user_id, target_domain, check_status);
+
+-- Text of each analysis for the search box, searched with LIKE (there is no full-text index)
+CREATE TABLE IF NOT EXISTS analysis_search (
+    url_id INTEGER PRIMARY KEY REFERENCES urls(id) ON DELETE CASCADE,
+    user_id INT NOT NULL,
+    url TEXT NOT NULL,
+    title VARCHAR(255) NOT NULL DEFAULT '',
+    link_text TEXT NOT NULL,
+    content TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_analysis_search_user ON analysis_search (user_id);
+
+-- Free-form labels of a user, attached to any number of analyses
+CREATE TABLE IF NOT EXISTS tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(50) NOT NULL,
+    UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS analysis_tags (
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    tag_id INT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    PRIMARY KEY (url_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_analysis_tags_tag ON analysis_tags (tag_id);
@@ -0,0 +1,21 @@
+-- Link targets are requested during the analysis: ok when they answered below 400, broken with the reason otherwise.
+-- SQLite cannot change a CHECK constraint, the table is copied into one with the new constraint
+CREATE TABLE links_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('internal', 'external', 'inaccessible')),
+    target_url TEXT NOT NULL,
+    target_domain VARCHAR(255) NOT NULL DEFAULT '',
+    anchor_text TEXT,
+    rel VARCHAR(255) NOT NULL DEFAULT '',
+    check_status VARCHAR(16) NOT NULL DEFAULT 'unchecked' CHECK (check_status IN ('unchecked', 'ok', 'broken')),
+    check_error VARCHAR(64),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO links_new SELECT * FROM links;
+DROP TABLE links;
+ALTER TABLE links_new RENAME TO links;
+CREATE INDEX IF NOT EXISTS idx_links_url_kind ON links (url_id, kind);
+CREATE INDEX IF NOT EXISTS idx_links_user_target ON links (user_id, target_url);
+CREATE INDEX IF NOT EXISTS idx_links_user_domain ON links (user_id, target_domain, check_status);
@@ -0,0 +1,2 @@
+-- The times stay in the format of CURRENT_TIMESTAMP, the fractions are gone and the earlier code reads it as well
+SELECT 1;
@@ -0,0 +1,11 @@
+-- Times written from Go were stored with fractions and an offset (2024-01-02 03:04:05.123+00:00), the column defaults
+-- write CURRENT_TIMESTAMP (2024-01-02 03:04:05). SQLite compares them as text, so both are brought to the second
+UPDATE users SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at);
+UPDATE projects SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at), updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at);
+UPDATE urls SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at), updated_at = strftime('%Y-%m-%d %H:%M:%S', updated_at);
+UPDATE extraction_rules SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at);
+UPDATE snapshot_blobs SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at), last_used_at = strftime('%Y-%m-%d %H:%M:%S', last_used_at);
+UPDATE snapshots SET fetched_at = strftime('%Y-%m-%d %H:%M:%S', fetched_at);
+UPDATE analysis_runs SET started_at = strftime('%Y-%m-%d %H:%M:%S', started_at), finished_at = strftime('%Y-%m-%d %H:%M:%S', finished_at);
+UPDATE links SET created_at = strftime('%Y-%m-%d %H:%M:%S', created_at);
+UPDATE schema_migrations SET applied_at = strftime('%Y-%m-%d %H:%M:%S', applied_at);
@@ -0,0 +1,21 @@
+CREATE TABLE analysis_runs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    snapshot_id INT NULL REFERENCES snapshots(id) ON DELETE SET NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('queued', 'running', 'done', 'error')),
+    error TEXT,
+    final_url TEXT,
+    status_code INT NOT NULL DEFAULT 0,
+    internal_links_count INT NOT NULL DEFAULT 0,
+    external_links_count INT NOT NULL DEFAULT 0,
+    inaccessible_links_count INT NOT NULL DEFAULT 0,
+    broken_anchors_count INT NOT NULL DEFAULT 0,
+    result JSON,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NOT NULL,
+    duration_ms INT NOT NULL DEFAULT 0
+);
+INSERT INTO analysis_runs_new SELECT * FROM analysis_runs;
+DROP TABLE analysis_runs;
+ALTER TABLE analysis_runs_new RENAME TO analysis_runs;
+CREATE INDEX IF NOT EXISTS idx_analysis_runs_url ON analysis_runs (url_id, id);
@@ -0,0 +1,25 @@
+-- A stored run is always over, the queued and running states belong to the analysis. Runs stored by the steps before
+-- the end of the chain get the outcome they had.
+-- SQLite cannot change a CHECK constraint, the table is copied into one with the new constraint
+UPDATE analysis_runs SET status = CASE WHEN error IS NULL OR error = '' THEN 'done' ELSE 'error' END WHERE status IN ('queued', 'running');
+CREATE TABLE analysis_runs_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INT NOT NULL REFERENCES urls(id) ON DELETE CASCADE,
+    snapshot_id INT NULL REFERENCES snapshots(id) ON DELETE SET NULL,
+    status VARCHAR(16) NOT NULL CHECK (status IN ('done', 'error')),
+    error TEXT,
+    final_url TEXT,
+    status_code INT NOT NULL DEFAULT 0,
+    internal_links_count INT NOT NULL DEFAULT 0,
+    external_links_count INT NOT NULL DEFAULT 0,
+    inaccessible_links_count INT NOT NULL DEFAULT 0,
+    broken_anchors_count INT NOT NULL DEFAULT 0,
+    result JSON,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME NOT NULL,
+    duration_ms INT NOT NULL DEFAULT 0
+);
+INSERT INTO analysis_runs_new SELECT * FROM analysis_runs;
+DROP TABLE analysis_runs;
+ALTER TABLE analysis_runs_new RENAME TO analysis_runs;
+CREATE INDEX IF NOT EXISTS idx_analysis_runs_url ON analysis_runs (url_id, id);
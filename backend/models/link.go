@@ -0,0 +1,24 @@
+package models
+
+// A link found on an analyzed page, with the analysis it was found on
+type Link struct {
+	ID           int64  `db:"id" json:"id"`
+	AnalysisID   int    `db:"url_id" json:"analysis_id"`
+	SourceURL    string `json:"source_url"`
+	SourceTitle  string `json:"source_title"`
+	Kind         string `db:"kind" json:"kind"` // internal, external or inaccessible
+	TargetURL    string `db:"target_url" json:"target_url"`
+	TargetDomain string `db:"target_domain" json:"target_domain"`
+	AnchorText   string `db:"anchor_text" json:"anchor_text"`
+	Rel          string `db:"rel" json:"rel"`
+	CheckStatus  string `db:"check_status" json:"check_status"` // unchecked, ok or broken
+	CheckError   string `db:"check_error" json:"check_error,omitempty"`
+}
+
+// Links of a user pointing to one domain
+type LinkDomain struct {
+	Domain      string `json:"domain"`
+	Links       int    `json:"links"`
+	BrokenLinks int    `json:"broken_links"`
+	Analyses    int    `json:"analyses"`
+}
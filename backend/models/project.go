@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// A named group of a user's analyses
+type Project struct {
+	ID          int             `db:"id" json:"id"`
+	UserID      int             `db:"user_id" json:"user_id"`
+	Name        string          `db:"name" json:"name"`
+	Description string          `db:"description" json:"description"`
+	Settings    ProjectSettings `db:"settings" json:"settings"`
+	Analyses    int             `json:"analyses"` // number of analyses in the project
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at" json:"updated_at"`
+}
+
+// Defaults of the analyses created in a project
+type ProjectSettings struct {
+	// static or cdp, empty uses the RENDERER of the server
+	Renderer string `json:"renderer,omitempty"`
+	// Extraction rules attached to every new analysis of the project
+	ExtractionRuleIDs []int `json:"extraction_rule_ids,omitempty"`
+	// How long the runs of the project's analyses are kept, over the user's policy
+	Retention *RetentionPolicy `json:"retention,omitempty"`
+}
+
+// A tag of a user with the number of analyses carrying it
+type Tag struct {
+	Name     string `json:"name"`
+	Analyses int    `json:"analyses"`
+}
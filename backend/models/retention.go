@@ -0,0 +1,10 @@
+package models
+
+// How long the runs of an analysis are kept. A nil field is inherited from the level above (project, then user,
+// then the server default), 0 keeps everything
+type RetentionPolicy struct {
+	// Keep the newest N runs of every analysis
+	KeepRuns *int `json:"keep_runs"`
+	// Drop runs older than D days
+	KeepDays *int `json:"keep_days"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// One run of an analysis, the full result is only loaded when a single run is fetched
+type AnalysisRun struct {
+	ID                     int             `json:"id"`
+	AnalysisID             int             `json:"analysis_id"`
+	SnapshotID             *int            `json:"snapshot_id"`
+	Status                 string          `json:"status"` // done or error
+	Error                  string          `json:"error,omitempty"`
+	FinalURL               string          `json:"final_url"`
+	StatusCode             int             `json:"status_code"`
+	InternalLinksCount     int             `json:"internal_links_count"`
+	ExternalLinksCount     int             `json:"external_links_count"`
+	InaccessibleLinksCount int             `json:"inaccessible_links_count"`
+	BrokenAnchorsCount     int             `json:"broken_anchors_count"`
+	StartedAt              time.Time       `json:"started_at"`
+	FinishedAt             time.Time       `json:"finished_at"`
+	DurationMs             int64           `json:"duration_ms"`
+	Result                 json.RawMessage `json:"result,omitempty"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// An analysis found by the search, best matches first
+type SearchHit struct {
+	AnalysisID int     `json:"analysis_id"`
+	URL        string  `json:"url"`
+	Title      string  `json:"title"`
+	Status     string  `json:"status"`
+	Score      float64 `json:"score"`
+	// Snippets of the matching fields (title, url, links, content) with the matched words in <mark>, HTML-escaped otherwise
+	Highlights map[string]string `json:"highlights"`
+}
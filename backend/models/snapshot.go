@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// The stored response of a run, the body is kept once per distinct content and read separately
+type Snapshot struct {
+	ID             int                 `json:"id"`
+	AnalysisID     int                 `json:"-"`
+	Hash           string              `json:"hash"`
+	FinalURL       string              `json:"final_url"`
+	StatusCode     int                 `json:"status_code"`
+	ContentType    string              `json:"content_type"`
+	Size           int64               `json:"size"`
+	CompressedSize int64               `json:"compressed_size"`
+	Headers        map[string][]string `json:"headers,omitempty"`
+	FetchedAt      time.Time           `json:"fetched_at"`
+}
@@ -1,20 +1,28 @@
 package models
 
-import "time"
+import (
+    "encoding/json"
+    "time"
+)
 
 type LinkDetail struct {
     URL        string `json:"url"`
     Text       string `json:"text,omitempty"`
+    Rel        string `json:"rel,omitempty"`
 }
 
 type URL struct {
     ID                   int                 `db:"id" json:"id"`
     UserID               int                 `db:"user_id" json:"user_id"`
+    ProjectID            *int                `db:"project_id" json:"project_id"`
+    Tags                 []string            `json:"tags,omitempty"`
     URL                  string              `db:"url" json:"url"`
+    NormalizedURL        string              `db:"normalized_url" json:"normalized_url"`
     Status               string              `db:"status" json:"status"` // queued, running, done/error
     ShouldPause          bool                `db:"should_pause" json:"should_pause"`
     Title                string              `db:"title" json:"title"`
     HTMLVersion          string              `db:"html_version" json:"html_version"`
+    ResultKind           string              `db:"result_kind" json:"result_kind"`
     HeadingCounts        map[string]int      `db:"heading_counts" json:"heading_counts"` 
     InternalLinksCount   int                 `db:"internal_links_count" json:"internal_links_count"`
     ExternalLinksCount   int                 `db:"external_links_count" json:"external_links_count"`
@@ -23,6 +31,19 @@ type URL struct {
     InaccessibleLinks    []LinkDetail        `db:"inaccessible_links" json:"inaccessible_links"`
     InternalLinks        []LinkDetail        `db:"internal_links" json:"internal_links"`
     ExternalLinks        []LinkDetail        `db:"external_links" json:"external_links"`
+    ResponseMeta         json.RawMessage     `db:"response_meta" json:"response_meta,omitempty"`
+    SecurityAudit        json.RawMessage     `db:"security_audit" json:"security_audit,omitempty"`
+    Technologies         json.RawMessage     `db:"technologies" json:"technologies,omitempty"`
+    Resources            json.RawMessage     `db:"resources" json:"resources,omitempty"`
+    ContentAnalysis      json.RawMessage     `db:"content_analysis" json:"content_analysis,omitempty"`
+    MetaDescription      string              `db:"meta_description" json:"meta_description"`
+    ContentSimHash       string              `db:"content_simhash" json:"content_simhash,omitempty"`
+    ExtractedData        json.RawMessage     `db:"extracted_data" json:"extracted_data,omitempty"`
+    CharsetReport        json.RawMessage     `db:"charset_report" json:"charset_report,omitempty"`
+    BrokenAnchorsCount   int                 `db:"broken_anchors_count" json:"broken_anchors_count"`
+    BrokenAnchors        json.RawMessage     `db:"broken_anchors" json:"broken_anchors,omitempty"`
+    DocumentInfo         json.RawMessage     `db:"document_info" json:"document_info,omitempty"`
+    RenderedResult       json.RawMessage     `db:"rendered_result" json:"rendered_result,omitempty"`
     CreatedAt            time.Time           `db:"created_at" json:"created_at"`
     UpdatedAt            time.Time           `db:"updated_at" json:"updated_at"`
 }
@@ -3,11 +3,12 @@ package models
 import "time"
 
 type User struct {
-    ID        int       `db:"id" json:"id"`
-    Username  string    `db:"username" json:"username"`
-    Email     string    `db:"email" json:"email"`
-    Password  string    `db:"password" json:"-"`
-    CreatedAt time.Time `db:"created_at" json:"created_at"`
+    ID        int             `db:"id" json:"id"`
+    Username  string          `db:"username" json:"username"`
+    Email     string          `db:"email" json:"email"`
+    Password  string          `db:"password" json:"-"`
+    CreatedAt time.Time       `db:"created_at" json:"created_at"`
+    Retention RetentionPolicy `db:"retention" json:"retention"`
 
     URLs []URL          `json:"urls,omitempty"`
 }
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+// The cursor does not belong to this sort order or cannot be read
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// One page of a user's analyses, ordered by Sort then by id so rows with equal values keep a stable order
+type AnalysisPage struct {
+	Sort   string // a column accepted by IsSortColumn, created_at when empty
+	Desc   bool
+	Limit  int
+	Cursor string // NextCursor of the previous page, empty for the first
+}
+
+type AnalysisPageResult struct {
+	Items []models.URL
+	// Cursor of the following page, empty on the last one
+	NextCursor string
+	// Analyses matching the filter on all pages
+	Total int
+}
+
+// A column of urls the listing can be sorted by
+type sortColumn struct {
+	expr string // SQL expression, NULLs folded away so the keyset comparison works
+	kind string // int, text, bool or time
+}
+
+// Columns the listing can be sorted by, with the names used by the API
+var sortColumns = map[string]sortColumn{
+	"id":                       {"id", "int"},
+	"url":                      {"url", "text"},
+	"status":                   {"CAST(status AS CHAR(16))", "text"},
+	"title":                    {"COALESCE(title, '')", "text"},
+	"html_version":             {"COALESCE(html_version, '')", "text"},
+	"result_kind":              {"COALESCE(result_kind, 'html')", "text"},
+	"internal_links_count":     {"internal_links_count", "int"},
+	"external_links_count":     {"external_links_count", "int"},
+	"inaccessible_links_count": {"inaccessible_links_count", "int"},
+	"broken_anchors_count":     {"COALESCE(broken_anchors_count, 0)", "int"},
+	"has_login_form":           {"has_login_form", "bool"},
+	"should_pause":             {"should_pause", "bool"},
+	"created_at":               {"created_at", "time"},
+	"updated_at":               {"updated_at", "time"},
+}
+
+// Whether the listing can be sorted by column
+func IsSortColumn(column string) bool {
+	_, ok := sortColumns[column]
+	return ok
+}
+
+// Position after the last row of a page: its sort value and id, tied to the sort order it was made for
+type pageCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
+}
+
+func encodeCursor(page AnalysisPage, value interface{}, id int) string {
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(pageCursor{Sort: page.Sort, Desc: page.Desc, Value: raw, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Read a cursor into the value to compare the sort column with, typed for the column
+func decodeCursor(page AnalysisPage) (interface{}, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(page.Cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var cursor pageCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.Sort != page.Sort || cursor.Desc != page.Desc {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	var value interface{}
+	switch sortColumns[page.Sort].kind {
+	case "int":
+		var n int64
+		err = json.Unmarshal(cursor.Value, &n)
+		value = n
+	case "bool":
+		var b bool
+		err = json.Unmarshal(cursor.Value, &b)
+		value = b
+	case "time":
+		var t time.Time
+		err = json.Unmarshal(cursor.Value, &t)
+		value = t
+	default:
+		var s string
+		err = json.Unmarshal(cursor.Value, &s)
+		value = s
+	}
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	return value, cursor.ID, nil
+}
+
+// Value of the sort column for a row, as the SQL expression of the column computes it
+func sortValue(url models.URL, column string) interface{} {
+	switch column {
+	case "id":
+		return int64(url.ID)
+	case "url":
+		return url.URL
+	case "status":
+		return url.Status
+	case "title":
+		return url.Title
+	case "html_version":
+		return url.HTMLVersion
+	case "result_kind":
+		if url.ResultKind == "" {
+			return "html"
+		}
+		return url.ResultKind
+	case "internal_links_count":
+		return int64(url.InternalLinksCount)
+	case "external_links_count":
+		return int64(url.ExternalLinksCount)
+	case "inaccessible_links_count":
+		return int64(url.InaccessibleLinksCount)
+	case "broken_anchors_count":
+		return int64(url.BrokenAnchorsCount)
+	case "has_login_form":
+		return url.HasLoginForm
+	case "should_pause":
+		return url.ShouldPause
+	case "updated_at":
+		return url.UpdatedAt
+	}
+	return url.CreatedAt
+}
+
+// -1, 0 or 1 as a is before, equal to or after b in ascending order. Text compares case-insensitively like the MySQL collation
+func compareSortValues(a, b interface{}) int {
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		switch {
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		}
+	case bool:
+		b := b.(bool)
+		switch {
+		case !a && b:
+			return -1
+		case a && !b:
+			return 1
+		}
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case string:
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b.(string)))
+	}
+	return 0
+}
+
+// Fill in the default sort column and page size
+func normalizePage(page AnalysisPage) AnalysisPage {
+	if page.Sort == "" {
+		page.Sort = "created_at"
+	}
+	if page.Limit < 1 {
+		page.Limit = 25
+	}
+	return page
+}
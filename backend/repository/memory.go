@@ -0,0 +1,1236 @@
+package repository
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// Everything the in-memory repositories hold. Deleting an analysis removes its links, search document, tags, runs,
+// snapshots and rules, and deleting a project takes its analyses out of it, like the foreign keys do in MySQL
+type memoryStore struct {
+	mu             sync.Mutex
+	users          map[int]models.User
+	urls           map[int]models.URL
+	links          []models.Link // ordered by id
+	search         map[int]SearchDocument
+	projects       map[int]models.Project
+	tags           map[int]map[string]bool // names by user
+	urlTags        map[int][]string        // names by analysis, sorted
+	runs           []models.AnalysisRun    // ordered by id
+	snapshots      []memorySnapshot        // ordered by id
+	blobs          map[string]memoryBlob   // by hash
+	rules          map[int]memoryRule
+	urlRules       map[int][]int // rule ids by analysis
+	locks          map[string]bool
+	nextProjID     int
+	nextUserID     int
+	nextURLID      int
+	nextLinkID     int64
+	nextRunID      int
+	nextSnapshotID int
+	nextRuleID     int
+}
+
+// Repositories that keep everything in memory, for tests of the handlers without a database
+func NewMemory() *Repositories {
+	store := &memoryStore{
+		users:    map[int]models.User{},
+		urls:     map[int]models.URL{},
+		search:   map[int]SearchDocument{},
+		projects: map[int]models.Project{},
+		tags:     map[int]map[string]bool{},
+		urlTags:  map[int][]string{},
+		blobs:    map[string]memoryBlob{},
+		rules:    map[int]memoryRule{},
+		urlRules: map[int][]int{},
+		locks:    map[string]bool{},
+	}
+	return &Repositories{
+		Users:     &memoryUsers{store},
+		Analyses:  &memoryAnalyses{store},
+		Links:     &memoryLinks{store},
+		Search:    &memorySearch{store},
+		Projects:  &memoryProjects{store},
+		Tags:      &memoryTags{store},
+		Runs:      &memoryRuns{store},
+		Snapshots: &memorySnapshots{store},
+		Rules:     &memoryRules{store},
+		Retention: &memoryRetention{store},
+	}
+}
+
+type memoryUsers struct {
+	*memoryStore
+}
+
+func (r *memoryUsers) Create(username, email, passwordHash string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Comparisons ignore case like the MySQL collation does
+	for _, user := range r.users {
+		if strings.EqualFold(user.Username, username) || strings.EqualFold(user.Email, email) {
+			return 0, ErrDuplicate
+		}
+	}
+	r.nextUserID++
+	r.users[r.nextUserID] = models.User{ID: r.nextUserID, Username: username, Email: email, Password: passwordHash, CreatedAt: time.Now()}
+	return r.nextUserID, nil
+}
+
+func (r *memoryUsers) FindByID(id int) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *memoryUsers) FindByIdentifier(identifier string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, identifier) || strings.EqualFold(user.Username, identifier) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUsers) SetRetention(userID int, policy models.RetentionPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[userID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Retention = policy
+	r.users[userID] = user
+	return nil
+}
+
+type memoryAnalyses struct {
+	*memoryStore
+}
+
+func (r *memoryAnalyses) Create(url *models.URL) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if url.NormalizedURL != "" {
+		for _, stored := range r.urls {
+			if stored.UserID == url.UserID && stored.NormalizedURL == url.NormalizedURL {
+				return 0, ErrDuplicate
+			}
+		}
+	}
+	r.nextURLID++
+	stored := *url
+	stored.ID = r.nextURLID
+	stored.UpdatedAt = stored.CreatedAt
+	r.urls[stored.ID] = stored
+	return stored.ID, nil
+}
+
+func (r *memoryAnalyses) Find(id int) (*models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.urls[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &models.URL{ID: stored.ID, UserID: stored.UserID, ProjectID: stored.ProjectID, URL: stored.URL, Status: stored.Status, ShouldPause: stored.ShouldPause}, nil
+}
+
+func (r *memoryAnalyses) FindIDByNormalizedURL(userID int, normalizedURL string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.urls {
+		if stored.UserID == userID && stored.NormalizedURL == normalizedURL {
+			return stored.ID, nil
+		}
+	}
+	return 0, ErrNotFound
+}
+
+func (r *memoryAnalyses) Get(id, userID int) (*models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.urls[id]
+	if !ok || stored.UserID != userID {
+		return nil, ErrNotFound
+	}
+	if stored.ResultKind == "" {
+		stored.ResultKind = utils.ResultKindHTML
+	}
+	return &stored, nil
+}
+
+func (r *memoryAnalyses) ListByUser(userID int, filter AnalysisFilter) ([]models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	urls := r.list(userID, filter)
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	return urls, nil
+}
+
+func (r *memoryAnalyses) ListPage(userID int, filter AnalysisFilter, page AnalysisPage) (*AnalysisPageResult, error) {
+	page = normalizePage(page)
+	if !IsSortColumn(page.Sort) {
+		return nil, fmt.Errorf("unknown sort column %q", page.Sort)
+	}
+	var cursorValue interface{}
+	var cursorID int
+	if page.Cursor != "" {
+		var err error
+		if cursorValue, cursorID, err = decodeCursor(page); err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	urls := r.list(userID, filter)
+	r.mu.Unlock()
+
+	// ORDER BY the sort column then id, both in the direction of the page
+	compare := func(url models.URL, value interface{}, id int) int {
+		order := compareSortValues(sortValue(url, page.Sort), value)
+		if order == 0 {
+			order = cmp.Compare(url.ID, id)
+		}
+		if page.Desc {
+			order = -order
+		}
+		return order
+	}
+	sort.Slice(urls, func(i, j int) bool { return compare(urls[i], sortValue(urls[j], page.Sort), urls[j].ID) < 0 })
+
+	result := &AnalysisPageResult{Items: []models.URL{}, Total: len(urls)}
+	for _, url := range urls {
+		if page.Cursor != "" && compare(url, cursorValue, cursorID) <= 0 {
+			continue
+		}
+		if len(result.Items) == page.Limit {
+			last := result.Items[page.Limit-1]
+			result.NextCursor = encodeCursor(page, sortValue(last, page.Sort), last.ID)
+			break
+		}
+		result.Items = append(result.Items, url)
+	}
+	return result, nil
+}
+
+// The user's analyses matching the filter with only the columns the MySQL listings select, the caller holds the lock
+func (r *memoryAnalyses) list(userID int, filter AnalysisFilter) []models.URL {
+	urls := []models.URL{}
+	for _, stored := range r.urls {
+		if stored.UserID != userID || !matchesAnalysis(stored, r.urlTags[stored.ID], filter) {
+			continue
+		}
+		listed := models.URL{
+			ID:                     stored.ID,
+			UserID:                 stored.UserID,
+			ProjectID:              stored.ProjectID,
+			URL:                    stored.URL,
+			Status:                 stored.Status,
+			ShouldPause:            stored.ShouldPause,
+			Title:                  stored.Title,
+			HTMLVersion:            stored.HTMLVersion,
+			InternalLinksCount:     stored.InternalLinksCount,
+			ExternalLinksCount:     stored.ExternalLinksCount,
+			HasLoginForm:           stored.HasLoginForm,
+			InaccessibleLinksCount: stored.InaccessibleLinksCount,
+			BrokenAnchorsCount:     stored.BrokenAnchorsCount,
+			Technologies:           stored.Technologies,
+			ResultKind:             stored.ResultKind,
+			CreatedAt:              stored.CreatedAt,
+			UpdatedAt:              stored.UpdatedAt,
+		}
+		if listed.ResultKind == "" {
+			listed.ResultKind = utils.ResultKindHTML
+		}
+		urls = append(urls, listed)
+	}
+	return urls
+}
+
+// The conditions of analysisConditions, tags are those of the analysis
+func matchesAnalysis(url models.URL, tags []string, filter AnalysisFilter) bool {
+	if filter.Technology != "" && !hasTechnology(url.Technologies, filter.Technology) {
+		return false
+	}
+	if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, url.Status) {
+		return false
+	}
+	if filter.Search != "" {
+		search := strings.ToLower(filter.Search)
+		if !strings.Contains(strings.ToLower(url.URL), search) && !strings.Contains(strings.ToLower(url.Title), search) {
+			return false
+		}
+	}
+	if (!filter.CreatedFrom.IsZero() && url.CreatedAt.Before(filter.CreatedFrom)) ||
+		(!filter.CreatedTo.IsZero() && !url.CreatedAt.Before(filter.CreatedTo)) ||
+		(!filter.UpdatedFrom.IsZero() && url.UpdatedAt.Before(filter.UpdatedFrom)) ||
+		(!filter.UpdatedTo.IsZero() && !url.UpdatedAt.Before(filter.UpdatedTo)) {
+		return false
+	}
+	if filter.HTMLVersion != "" && url.HTMLVersion != filter.HTMLVersion {
+		return false
+	}
+	if filter.HasLoginForm != nil && url.HasLoginForm != *filter.HasLoginForm {
+		return false
+	}
+	if filter.ProjectID != nil {
+		if (*filter.ProjectID == 0 && url.ProjectID != nil) || (*filter.ProjectID != 0 && (url.ProjectID == nil || *url.ProjectID != *filter.ProjectID)) {
+			return false
+		}
+	}
+	for _, tag := range filter.Tags {
+		if !slices.Contains(tags, tag) {
+			return false
+		}
+	}
+	return filter.InternalLinks.contains(url.InternalLinksCount) &&
+		filter.ExternalLinks.contains(url.ExternalLinksCount) &&
+		filter.InaccessibleLinks.contains(url.InaccessibleLinksCount)
+}
+
+// JSON_CONTAINS(technologies, JSON_OBJECT('name', ?)) of the MySQL listing
+func hasTechnology(technologiesJSON json.RawMessage, name string) bool {
+	var technologies []utils.Technology
+	if err := json.Unmarshal(technologiesJSON, &technologies); err != nil {
+		return false
+	}
+	for _, technology := range technologies {
+		if technology.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryAnalyses) Fingerprinted(userID int) ([]models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	urls := []models.URL{}
+	for _, stored := range r.urls {
+		if stored.UserID == userID && stored.ContentSimHash != "" {
+			urls = append(urls, models.URL{ID: stored.ID, URL: stored.URL, Title: stored.Title, ContentSimHash: stored.ContentSimHash})
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	return urls, nil
+}
+
+func (r *memoryAnalyses) SharingValue(userID int, column SharedColumn) ([]models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	value := func(url models.URL) string {
+		if column == SharedMetaDescription {
+			return url.MetaDescription
+		}
+		return url.Title
+	}
+	counts := map[string]int{}
+	for _, stored := range r.urls {
+		if stored.UserID == userID && value(stored) != "" {
+			counts[value(stored)]++
+		}
+	}
+	urls := []models.URL{}
+	for _, stored := range r.urls {
+		if stored.UserID == userID && counts[value(stored)] > 1 {
+			urls = append(urls, models.URL{ID: stored.ID, URL: stored.URL, Title: stored.Title, MetaDescription: stored.MetaDescription})
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		return cmp.Or(cmp.Compare(value(urls[i]), value(urls[j])), cmp.Compare(urls[i].ID, urls[j].ID)) < 0
+	})
+	return urls, nil
+}
+
+func (r *memoryAnalyses) BackfillNormalizedURLs(normalize func(url string) (string, error)) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	type key struct {
+		userID int
+		url    string
+	}
+	taken := map[key]bool{}
+	var pending []int
+	for id, stored := range r.urls {
+		if stored.NormalizedURL != "" {
+			taken[key{stored.UserID, stored.NormalizedURL}] = true
+		} else {
+			pending = append(pending, id)
+		}
+	}
+	// Oldest first like the MySQL backfill
+	sort.Ints(pending)
+
+	filled := 0
+	for _, id := range pending {
+		stored := r.urls[id]
+		normalized, err := normalize(stored.URL)
+		if err != nil || taken[key{stored.UserID, normalized}] {
+			continue
+		}
+		taken[key{stored.UserID, normalized}] = true
+		stored.NormalizedURL = normalized
+		r.urls[id] = stored
+		filled++
+	}
+	return filled, nil
+}
+
+func (r *memoryAnalyses) Delete(id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.delete(id)
+	return nil
+}
+
+func (r *memoryAnalyses) DeleteForUser(userID int, ids []int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for _, id := range ids {
+		if stored, ok := r.urls[id]; ok && stored.UserID == userID {
+			r.delete(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Remove an analysis with its links, search document, tags, runs, snapshots and rules, the caller holds the lock
+func (r *memoryAnalyses) delete(id int) {
+	delete(r.urls, id)
+	delete(r.search, id)
+	delete(r.urlTags, id)
+	delete(r.urlRules, id)
+	r.links = slices.DeleteFunc(r.links, func(link models.Link) bool { return link.AnalysisID == id })
+	r.runs = slices.DeleteFunc(r.runs, func(run models.AnalysisRun) bool { return run.AnalysisID == id })
+	r.snapshots = slices.DeleteFunc(r.snapshots, func(snapshot memorySnapshot) bool { return snapshot.AnalysisID == id })
+}
+
+func (r *memoryAnalyses) SetStatus(id int, status string) error {
+	return r.update(id, func(url *models.URL) { url.Status = status })
+}
+
+func (r *memoryAnalyses) SetShouldPause(id int, shouldPause bool) error {
+	return r.update(id, func(url *models.URL) { url.ShouldPause = shouldPause })
+}
+
+func (r *memoryAnalyses) SaveResult(id int, status string, shouldPause *bool, result *utils.AnalysisResult) error {
+	return r.update(id, func(url *models.URL) {
+		url.Status = status
+		if shouldPause != nil {
+			url.ShouldPause = *shouldPause
+		}
+		applyResult(url, result)
+		url.UpdatedAt = time.Now()
+	})
+}
+
+func (r *memoryAnalyses) SaveDetails(id int, result *utils.AnalysisResult) error {
+	return r.update(id, func(url *models.URL) { applyDetails(url, result) })
+}
+
+// Change a stored analysis, a missing one is left alone like an UPDATE matching no row
+func (r *memoryAnalyses) update(id int, change func(url *models.URL)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.urls[id]; ok {
+		change(&stored)
+		r.urls[id] = stored
+	}
+	return nil
+}
+
+type memoryLinks struct {
+	*memoryStore
+}
+
+func (r *memoryLinks) Replace(analysisID int, links []models.Link) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	source, ok := r.urls[analysisID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	kept := r.links[:0]
+	for _, link := range r.links {
+		if link.AnalysisID != analysisID {
+			kept = append(kept, link)
+		}
+	}
+	r.links = kept
+
+	for _, link := range links {
+		r.nextLinkID++
+		link.ID = r.nextLinkID
+		link.AnalysisID = analysisID
+		link.SourceURL = source.URL
+		r.links = append(r.links, link)
+	}
+	return nil
+}
+
+func (r *memoryLinks) List(filter LinkFilter) ([]models.Link, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	links := []models.Link{}
+	// Newest first
+	for i := len(r.links) - 1; i >= 0 && len(links) < filter.Limit; i-- {
+		link := r.links[i]
+		if !r.matches(link, filter) || (filter.Before > 0 && link.ID >= filter.Before) {
+			continue
+		}
+		// The title is read at query time like the JOIN on urls does
+		source := r.urls[link.AnalysisID]
+		link.SourceURL, link.SourceTitle = source.URL, source.Title
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+func (r *memoryLinks) Domains(filter LinkFilter) ([]models.LinkDomain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	byDomain := map[string]*models.LinkDomain{}
+	analyses := map[string]map[int]bool{}
+	for _, link := range r.links {
+		// Relative and invalid links have no domain
+		if link.TargetDomain == "" || !r.matches(link, filter) {
+			continue
+		}
+		domain, ok := byDomain[link.TargetDomain]
+		if !ok {
+			domain = &models.LinkDomain{Domain: link.TargetDomain}
+			byDomain[link.TargetDomain] = domain
+			analyses[link.TargetDomain] = map[int]bool{}
+		}
+		domain.Links++
+		if link.CheckStatus == "broken" {
+			domain.BrokenLinks++
+		}
+		analyses[link.TargetDomain][link.AnalysisID] = true
+	}
+
+	domains := []models.LinkDomain{}
+	for name, domain := range byDomain {
+		domain.Analyses = len(analyses[name])
+		domains = append(domains, *domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].Links != domains[j].Links {
+			return domains[i].Links > domains[j].Links
+		}
+		return domains[i].Domain < domains[j].Domain
+	})
+	if len(domains) > filter.Limit {
+		domains = domains[:filter.Limit]
+	}
+	return domains, nil
+}
+
+// The conditions of linkConditions, the caller holds the lock
+func (r *memoryLinks) matches(link models.Link, filter LinkFilter) bool {
+	return r.urls[link.AnalysisID].UserID == filter.UserID &&
+		(filter.AnalysisID == 0 || link.AnalysisID == filter.AnalysisID) &&
+		(filter.TargetURL == "" || link.TargetURL == filter.TargetURL) &&
+		(filter.Kind == "" || link.Kind == filter.Kind) &&
+		(filter.Status == "" || link.CheckStatus == filter.Status) &&
+		(filter.Domain == "" || link.TargetDomain == filter.Domain)
+}
+
+type memorySearch struct {
+	*memoryStore
+}
+
+func (r *memorySearch) Index(doc SearchDocument) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// Like the INSERT ... SELECT, a missing analysis stores nothing
+	if _, ok := r.urls[doc.AnalysisID]; ok {
+		r.search[doc.AnalysisID] = doc
+	}
+	return nil
+}
+
+// Scans the documents of the user, ranked by scoreHit
+func (r *memorySearch) Search(userID int, terms []string, limit int) ([]models.SearchHit, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pattern := termsPattern(terms)
+	hits := []models.SearchHit{}
+	for id, doc := range r.search {
+		url := r.urls[id]
+		if url.UserID != userID {
+			continue
+		}
+		fields := map[string]string{"title": doc.Title, "url": url.URL, "links": doc.LinkText, "content": doc.Content}
+		score, ok := scoreHit(pattern, terms, fields)
+		if !ok {
+			continue
+		}
+		hits = append(hits, models.SearchHit{
+			AnalysisID: id,
+			URL:        url.URL,
+			Title:      doc.Title,
+			Status:     url.Status,
+			Score:      score,
+			Highlights: highlightHit(terms, fields),
+		})
+	}
+	return bestHits(hits, limit), nil
+}
+
+type memoryProjects struct {
+	*memoryStore
+}
+
+func (r *memoryProjects) Create(project *models.Project) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.nameTaken(project) {
+		return 0, ErrDuplicate
+	}
+	r.nextProjID++
+	stored := *project
+	stored.ID = r.nextProjID
+	stored.CreatedAt = time.Now()
+	stored.UpdatedAt = stored.CreatedAt
+	r.projects[stored.ID] = stored
+	return stored.ID, nil
+}
+
+func (r *memoryProjects) Get(id, userID int) (*models.Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.projects[id]
+	if !ok || stored.UserID != userID {
+		return nil, ErrNotFound
+	}
+	stored.Analyses = r.countAnalyses(id)
+	return &stored, nil
+}
+
+func (r *memoryProjects) List(userID int) ([]models.Project, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	projects := []models.Project{}
+	for id, stored := range r.projects {
+		if stored.UserID == userID {
+			stored.Analyses = r.countAnalyses(id)
+			projects = append(projects, stored)
+		}
+	}
+	// By name like the collation, ignoring case
+	sort.Slice(projects, func(i, j int) bool { return strings.ToLower(projects[i].Name) < strings.ToLower(projects[j].Name) })
+	return projects, nil
+}
+
+func (r *memoryProjects) Update(project *models.Project) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.projects[project.ID]
+	if !ok || stored.UserID != project.UserID {
+		return ErrNotFound
+	}
+	if r.nameTaken(project) {
+		return ErrDuplicate
+	}
+	stored.Name, stored.Description, stored.Settings = project.Name, project.Description, project.Settings
+	stored.UpdatedAt = time.Now()
+	r.projects[project.ID] = stored
+	return nil
+}
+
+func (r *memoryProjects) Delete(id, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, ok := r.projects[id]
+	if !ok || stored.UserID != userID {
+		return ErrNotFound
+	}
+	delete(r.projects, id)
+	for urlID, url := range r.urls {
+		if url.ProjectID != nil && *url.ProjectID == id {
+			url.ProjectID = nil
+			r.urls[urlID] = url
+		}
+	}
+	return nil
+}
+
+func (r *memoryProjects) MoveAnalyses(userID int, analysisIDs []int, projectID *int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if projectID != nil {
+		if project, ok := r.projects[*projectID]; !ok || project.UserID != userID {
+			return 0, ErrNotFound
+		}
+	}
+	var moved int64
+	for _, id := range analysisIDs {
+		if url, ok := r.urls[id]; ok && url.UserID == userID {
+			url.ProjectID = projectID
+			r.urls[id] = url
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+// Whether another project of the user has the name, ignoring case like the unique key. The caller holds the lock
+func (r *memoryProjects) nameTaken(project *models.Project) bool {
+	for id, stored := range r.projects {
+		if id != project.ID && stored.UserID == project.UserID && strings.EqualFold(stored.Name, project.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The caller holds the lock
+func (r *memoryProjects) countAnalyses(projectID int) int {
+	count := 0
+	for _, url := range r.urls {
+		if url.ProjectID != nil && *url.ProjectID == projectID {
+			count++
+		}
+	}
+	return count
+}
+
+type memoryTags struct {
+	*memoryStore
+}
+
+func (r *memoryTags) List(userID int) ([]models.Tag, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := []models.Tag{}
+	for name := range r.tags[userID] {
+		tag := models.Tag{Name: name}
+		for id, names := range r.urlTags {
+			if r.urls[id].UserID == userID && slices.Contains(names, name) {
+				tag.Analyses++
+			}
+		}
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+	return tags, nil
+}
+
+func (r *memoryTags) SetForAnalysis(userID, analysisID int, names []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if url, ok := r.urls[analysisID]; !ok || url.UserID != userID {
+		return ErrNotFound
+	}
+	if r.tags[userID] == nil {
+		r.tags[userID] = map[string]bool{}
+	}
+	set := []string{}
+	for _, name := range names {
+		r.tags[userID][name] = true
+		if !slices.Contains(set, name) {
+			set = append(set, name)
+		}
+	}
+	sort.Strings(set)
+	if len(set) == 0 {
+		delete(r.urlTags, analysisID)
+	} else {
+		r.urlTags[analysisID] = set
+	}
+	return nil
+}
+
+func (r *memoryTags) ForAnalyses(analysisIDs []int) (map[int][]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tags := map[int][]string{}
+	for _, id := range analysisIDs {
+		if names, ok := r.urlTags[id]; ok {
+			tags[id] = slices.Clone(names)
+		}
+	}
+	return tags, nil
+}
+
+func (r *memoryTags) Rename(userID int, name, newName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.tags[userID][name] {
+		return ErrNotFound
+	}
+	if name == newName {
+		return nil
+	}
+	if r.tags[userID][newName] {
+		return ErrDuplicate
+	}
+	delete(r.tags[userID], name)
+	r.tags[userID][newName] = true
+	r.replaceOnAnalyses(userID, name, newName)
+	return nil
+}
+
+func (r *memoryTags) Delete(userID int, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.tags[userID][name] {
+		return ErrNotFound
+	}
+	delete(r.tags[userID], name)
+	r.replaceOnAnalyses(userID, name, "")
+	return nil
+}
+
+// Replace a tag on the user's analyses, an empty newName removes it. The caller holds the lock
+func (r *memoryTags) replaceOnAnalyses(userID int, name, newName string) {
+	for id, names := range r.urlTags {
+		if r.urls[id].UserID != userID || !slices.Contains(names, name) {
+			continue
+		}
+		names = slices.DeleteFunc(slices.Clone(names), func(n string) bool { return n == name })
+		if newName != "" {
+			names = append(names, newName)
+			sort.Strings(names)
+		}
+		if len(names) == 0 {
+			delete(r.urlTags, id)
+		} else {
+			r.urlTags[id] = names
+		}
+	}
+}
+
+type memoryRuns struct {
+	*memoryStore
+}
+
+func (r *memoryRuns) Create(run *models.AnalysisRun) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.urls[run.AnalysisID]; !ok {
+		return 0, ErrNotFound
+	}
+	r.nextRunID++
+	stored := *run
+	stored.ID = r.nextRunID
+	r.runs = append(r.runs, stored)
+	return stored.ID, nil
+}
+
+func (r *memoryRuns) List(analysisID, before, limit int) ([]models.AnalysisRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	runs := []models.AnalysisRun{}
+	for i := len(r.runs) - 1; i >= 0 && len(runs) < limit; i-- {
+		run := r.runs[i]
+		if run.AnalysisID == analysisID && (before <= 0 || run.ID < before) {
+			run.Result = nil
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+func (r *memoryRuns) Get(analysisID, userID, runID int) (*models.AnalysisRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if url, ok := r.urls[analysisID]; !ok || url.UserID != userID {
+		return nil, ErrNotFound
+	}
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		if run := r.runs[i]; run.AnalysisID == analysisID && (runID == 0 || run.ID == runID) {
+			return &run, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// A stored snapshot with what its exports are made from
+type memorySnapshot struct {
+	models.Snapshot
+	exchanges []utils.Exchange
+	har       []byte
+	// Bodies of the other requests of the run, they keep their blobs away from the orphan cleanup
+	exchangeHashes []string
+}
+
+type memoryBlob struct {
+	body           []byte
+	compressedSize int64
+	lastUsed       time.Time
+}
+
+type memorySnapshots struct {
+	*memoryStore
+}
+
+func (r *memorySnapshots) Create(analysisID int, result *utils.AnalysisResult) (int, error) {
+	snapshot := result.RunSnapshot()
+	hash := snapshot.Hash()
+	exchanges, bodies := result.Exchanges()
+	var harJSON []byte
+	if har := utils.BuildHAR(result); har != nil {
+		harJSON, _ = json.Marshal(har)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.urls[analysisID]; !ok {
+		return 0, ErrNotFound
+	}
+	bodies[hash] = snapshot.Body
+	stored := memorySnapshot{exchanges: exchanges, har: harJSON}
+	for bodyHash, body := range bodies {
+		compressed, err := utils.CompressSnapshotBody(body)
+		if err != nil {
+			return 0, err
+		}
+		r.blobs[bodyHash] = memoryBlob{body: body, compressedSize: int64(len(compressed)), lastUsed: time.Now()}
+		if bodyHash != hash {
+			stored.exchangeHashes = append(stored.exchangeHashes, bodyHash)
+		}
+	}
+	r.nextSnapshotID++
+	stored.Snapshot = models.Snapshot{
+		ID:             r.nextSnapshotID,
+		AnalysisID:     analysisID,
+		Hash:           hash,
+		FinalURL:       snapshot.FinalURL,
+		StatusCode:     snapshot.StatusCode,
+		ContentType:    snapshot.Headers.Get("Content-Type"),
+		Size:           int64(len(snapshot.Body)),
+		CompressedSize: r.blobs[hash].compressedSize,
+		Headers:        snapshot.Headers.Clone(),
+		FetchedAt:      snapshot.FetchedAt,
+	}
+	r.snapshots = append(r.snapshots, stored)
+	return stored.ID, nil
+}
+
+func (r *memorySnapshots) List(analysisID, userID int) ([]models.Snapshot, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snapshots := []models.Snapshot{}
+	for _, stored := range r.owned(analysisID, userID) {
+		stored.Headers = nil
+		snapshots = append(snapshots, stored.Snapshot)
+	}
+	return snapshots, nil
+}
+
+func (r *memorySnapshots) Get(analysisID, userID, snapshotID int, withBody bool) (*models.Snapshot, []byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.find(analysisID, userID, snapshotID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var body []byte
+	if withBody {
+		body = slices.Clone(r.blobs[stored.Hash].body)
+	}
+	return &stored.Snapshot, body, nil
+}
+
+func (r *memorySnapshots) Export(analysisID, userID, snapshotID int) (*SnapshotExport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stored, err := r.find(analysisID, userID, snapshotID)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotExport{SnapshotID: stored.ID, Exchanges: stored.exchanges, HAR: stored.har}, nil
+}
+
+func (r *memorySnapshots) Bodies(hashes []string) (map[string][]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bodies := map[string][]byte{}
+	for _, hash := range hashes {
+		if blob, ok := r.blobs[hash]; ok {
+			bodies[hash] = slices.Clone(blob.body)
+		}
+	}
+	return bodies, nil
+}
+
+// Snapshots of the user's analysis newest first, the caller holds the lock
+func (r *memorySnapshots) owned(analysisID, userID int) []memorySnapshot {
+	if url, ok := r.urls[analysisID]; !ok || url.UserID != userID {
+		return nil
+	}
+	var snapshots []memorySnapshot
+	for _, stored := range r.snapshots {
+		if stored.AnalysisID == analysisID {
+			snapshots = append(snapshots, stored)
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if !snapshots[i].FetchedAt.Equal(snapshots[j].FetchedAt) {
+			return snapshots[i].FetchedAt.After(snapshots[j].FetchedAt)
+		}
+		return snapshots[i].ID > snapshots[j].ID
+	})
+	return snapshots
+}
+
+// One snapshot of the user's analysis, the newest when snapshotID is 0. The caller holds the lock
+func (r *memorySnapshots) find(analysisID, userID, snapshotID int) (*memorySnapshot, error) {
+	for _, stored := range r.owned(analysisID, userID) {
+		if snapshotID == 0 || stored.ID == snapshotID {
+			return &stored, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// An extraction rule with its owner
+type memoryRule struct {
+	userID int
+	rule   utils.ExtractionRule
+}
+
+type memoryRules struct {
+	*memoryStore
+}
+
+func (r *memoryRules) List(userID int) ([]utils.ExtractionRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.matching(func(id int, stored memoryRule) bool { return stored.userID == userID }), nil
+}
+
+func (r *memoryRules) ListByIDs(userID int, ids []int) ([]utils.ExtractionRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.matching(func(id int, stored memoryRule) bool { return stored.userID == userID && slices.Contains(ids, id) }), nil
+}
+
+func (r *memoryRules) ForAnalysis(analysisID int) ([]utils.ExtractionRule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attached := r.urlRules[analysisID]
+	return r.matching(func(id int, stored memoryRule) bool { return slices.Contains(attached, id) }), nil
+}
+
+func (r *memoryRules) Create(userID int, rule utils.ExtractionRule) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, stored := range r.rules {
+		if stored.userID == userID && strings.EqualFold(stored.rule.Name, rule.Name) {
+			return 0, ErrDuplicate
+		}
+	}
+	r.nextRuleID++
+	rule.ID = r.nextRuleID
+	r.rules[rule.ID] = memoryRule{userID: userID, rule: rule}
+	return rule.ID, nil
+}
+
+func (r *memoryRules) Delete(id, userID int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stored, ok := r.rules[id]; !ok || stored.userID != userID {
+		return ErrNotFound
+	}
+	delete(r.rules, id)
+	for urlID, ruleIDs := range r.urlRules {
+		r.urlRules[urlID] = slices.DeleteFunc(ruleIDs, func(ruleID int) bool { return ruleID == id })
+	}
+	return nil
+}
+
+func (r *memoryRules) Attach(analysisID, userID int, ruleIDs []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attach(analysisID, userID, ruleIDs)
+	return nil
+}
+
+func (r *memoryRules) SetForAnalysis(analysisID, userID int, ruleIDs []int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.urlRules, analysisID)
+	r.attach(analysisID, userID, ruleIDs)
+	return nil
+}
+
+func (r *memoryRules) Extractions(userID int) ([]models.URL, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	urls := []models.URL{}
+	for _, stored := range r.urls {
+		if stored.UserID == userID && stored.ExtractedData != nil {
+			urls = append(urls, models.URL{ID: stored.ID, URL: stored.URL, ExtractedData: stored.ExtractedData})
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	return urls, nil
+}
+
+// Attach the user's rules among ruleIDs to an existing analysis, the caller holds the lock
+func (r *memoryRules) attach(analysisID, userID int, ruleIDs []int) {
+	if _, ok := r.urls[analysisID]; !ok {
+		return
+	}
+	for _, id := range ruleIDs {
+		if stored, ok := r.rules[id]; ok && stored.userID == userID && !slices.Contains(r.urlRules[analysisID], id) {
+			r.urlRules[analysisID] = append(r.urlRules[analysisID], id)
+		}
+	}
+}
+
+// The rules keep accepts by name, the caller holds the lock
+func (r *memoryRules) matching(keep func(id int, stored memoryRule) bool) []utils.ExtractionRule {
+	rules := []utils.ExtractionRule{}
+	for id, stored := range r.rules {
+		if keep(id, stored) {
+			rules = append(rules, stored.rule)
+		}
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Name < rules[j].Name })
+	return rules
+}
+
+type memoryRetention struct {
+	*memoryStore
+}
+
+func (r *memoryRetention) Policies(afterID, limit int) ([]AnalysisRetention, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var analyses []AnalysisRetention
+	for _, url := range r.urls {
+		if url.ID <= afterID {
+			continue
+		}
+		analysis := AnalysisRetention{AnalysisID: url.ID, User: r.users[url.UserID].Retention}
+		if url.ProjectID != nil {
+			analysis.Project = r.projects[*url.ProjectID].Settings.Retention
+		}
+		analyses = append(analyses, analysis)
+	}
+	sort.Slice(analyses, func(i, j int) bool { return analyses[i].AnalysisID < analyses[j].AnalysisID })
+	return analyses[:min(limit, len(analyses))], nil
+}
+
+func (r *memoryRetention) PruneRuns(analysisID, keep int, cutoff time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []int
+	var times []time.Time
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		if r.runs[i].AnalysisID == analysisID {
+			ids = append(ids, r.runs[i].ID)
+			times = append(times, r.runs[i].StartedAt)
+		}
+	}
+	expired := expiredRows(ids, times, keep, cutoff, limit)
+	r.runs = slices.DeleteFunc(r.runs, func(run models.AnalysisRun) bool { return expired[run.ID] })
+	return int64(len(expired)), nil
+}
+
+func (r *memoryRetention) PruneSnapshots(analysisID, keep int, cutoff time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ids []int
+	var times []time.Time
+	for i := len(r.snapshots) - 1; i >= 0; i-- {
+		if r.snapshots[i].AnalysisID == analysisID {
+			ids = append(ids, r.snapshots[i].ID)
+			times = append(times, r.snapshots[i].FetchedAt)
+		}
+	}
+	expired := expiredRows(ids, times, keep, cutoff, limit)
+	r.snapshots = slices.DeleteFunc(r.snapshots, func(snapshot memorySnapshot) bool { return expired[snapshot.ID] })
+	// A run keeps its place in the history without the snapshot, like ON DELETE SET NULL
+	for i, run := range r.runs {
+		if run.SnapshotID != nil && expired[*run.SnapshotID] {
+			r.runs[i].SnapshotID = nil
+		}
+	}
+	return int64(len(expired)), nil
+}
+
+// Up to limit of ids (newest first, with the time of each) past keep or before cutoff, never the first
+func expiredRows(ids []int, times []time.Time, keep int, cutoff time.Time, limit int) map[int]bool {
+	expired := map[int]bool{}
+	for position := 1; position < len(ids) && len(expired) < limit; position++ {
+		if (keep > 0 && position >= keep) || (!cutoff.IsZero() && times[position].Before(cutoff)) {
+			expired[ids[position]] = true
+		}
+	}
+	return expired
+}
+
+func (r *memoryRetention) DeleteOrphanLinks(limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var removed int64
+	r.links = slices.DeleteFunc(r.links, func(link models.Link) bool {
+		if _, ok := r.urls[link.AnalysisID]; ok || removed >= int64(limit) {
+			return false
+		}
+		removed++
+		return true
+	})
+	return removed, nil
+}
+
+func (r *memoryRetention) DeleteOrphanBlobs(cutoff time.Time, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	used := map[string]bool{}
+	for _, snapshot := range r.snapshots {
+		used[snapshot.Hash] = true
+		for _, hash := range snapshot.exchangeHashes {
+			used[hash] = true
+		}
+	}
+	var removed int64
+	for hash, blob := range r.blobs {
+		if removed >= int64(limit) {
+			break
+		}
+		if !used[hash] && blob.lastUsed.Before(cutoff) {
+			delete(r.blobs, hash)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (r *memoryRetention) TryLock(name string) (func(), bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.locks[name] {
+		return nil, false, nil
+	}
+	r.locks[name] = true
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		delete(r.locks, name)
+	}, true, nil
+}
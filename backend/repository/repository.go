@@ -0,0 +1,296 @@
+// Package repository holds the data access of the handlers behind interfaces, with an SQL implementation for the server
+// (MySQL, PostgreSQL or SQLite) and an in-memory one for tests that should not need a database
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+var (
+	// The row does not exist, or belongs to another user where the lookup is scoped to one
+	ErrNotFound = errors.New("not found")
+	// A unique value (username, email) is already taken
+	ErrDuplicate = errors.New("already exists")
+)
+
+type UserRepository interface {
+	// Store a new user with an already hashed password and return its id
+	Create(username, email, passwordHash string) (int, error)
+	FindByID(id int) (*models.User, error)
+	// The user whose email or username is identifier, for the login
+	FindByIdentifier(identifier string) (*models.User, error)
+	// Save the retention policy of the user's analyses
+	SetRetention(userID int, policy models.RetentionPolicy) error
+}
+
+type AnalysisRepository interface {
+	// Store a new analysis and return its id, ErrDuplicate when the user already has one with the same normalized URL
+	Create(url *models.URL) (int, error)
+	// Id, owner, URL, status and pause flag of an analysis, for ownership checks and re-runs
+	Find(id int) (*models.URL, error)
+	// Id of the user's analysis whose URL normalizes to normalizedURL
+	FindIDByNormalizedURL(userID int, normalizedURL string) (int, error)
+	// Every column of one of the user's analyses, for the detail page
+	Get(id, userID int) (*models.URL, error)
+	// The user's analyses with the columns of the table
+	ListByUser(userID int, filter AnalysisFilter) ([]models.URL, error)
+	// One sorted page of the user's analyses with the columns of the table, ErrInvalidCursor for a cursor of another sort order
+	ListPage(userID int, filter AnalysisFilter, page AnalysisPage) (*AnalysisPageResult, error)
+	Delete(id int) error
+	// Delete the given analyses of the user and return how many there were
+	DeleteForUser(userID int, ids []int) (int64, error)
+	SetStatus(id int, status string) error
+	SetShouldPause(id int, shouldPause bool) error
+	// Store the result of a run (title, headings, link counts and lists) with the new status, a nil shouldPause leaves the flag alone
+	SaveResult(id int, status string, shouldPause *bool, result *utils.AnalysisResult) error
+	// Store the detail columns of a run (response metadata, security audit, technologies, content, ...)
+	SaveDetails(id int, result *utils.AnalysisResult) error
+	// The user's analyses that have a content fingerprint by id, with their id, URL, title and fingerprint
+	Fingerprinted(userID int) ([]models.URL, error)
+	// The user's analyses whose non-empty value of column is shared with another of their analyses, by that value and id.
+	// They carry their id, URL, title and the value
+	SharingValue(userID int, column SharedColumn) ([]models.URL, error)
+	// Fill in the normalized URL of analyses stored before it existed and return how many were. Of several analyses of
+	// the same page the oldest gets it, the others are left without one
+	BackfillNormalizedURLs(normalize func(url string) (string, error)) (int, error)
+}
+
+type ProjectRepository interface {
+	// Store a new project and return its id, ErrDuplicate when the user already has a project with that name
+	Create(project *models.Project) (int, error)
+	// One of the user's projects with its number of analyses
+	Get(id, userID int) (*models.Project, error)
+	// The user's projects by name with their number of analyses
+	List(userID int) ([]models.Project, error)
+	// Save the name, description and settings of one of the user's projects
+	Update(project *models.Project) error
+	// Delete one of the user's projects, its analyses are kept without a project
+	Delete(id, userID int) error
+	// Put the given analyses of the user in a project, nil takes them out of theirs. Returns how many there were
+	MoveAnalyses(userID int, analysisIDs []int, projectID *int) (int64, error)
+}
+
+type TagRepository interface {
+	// The user's tags by name with their number of analyses
+	List(userID int) ([]models.Tag, error)
+	// Replace the tags of one of the user's analyses, tags that do not exist yet are created
+	SetForAnalysis(userID, analysisID int, names []string) error
+	// Tags of each of the analyses by name, analyses without tags are left out
+	ForAnalyses(analysisIDs []int) (map[int][]string, error)
+	// Rename a tag on all the analyses carrying it, ErrDuplicate when the new name is taken
+	Rename(userID int, name, newName string) error
+	// Remove a tag from the user's analyses and delete it
+	Delete(userID int, name string) error
+}
+
+type LinkRepository interface {
+	// Replace the links of an analysis
+	Replace(analysisID int, links []models.Link) error
+	// Links matching the filter, newest first
+	List(filter LinkFilter) ([]models.Link, error)
+	// Target domains of the links matching the filter, most linked first
+	Domains(filter LinkFilter) ([]models.LinkDomain, error)
+}
+
+type RunRepository interface {
+	// Add a run to the history of an analysis and return its id
+	Create(run *models.AnalysisRun) (int, error)
+	// Runs of an analysis newest first without their result, those with an id below before when it is above 0
+	List(analysisID, before, limit int) ([]models.AnalysisRun, error)
+	// One run of the user's analysis with its result, runID 0 is the newest one
+	Get(analysisID, userID, runID int) (*models.AnalysisRun, error)
+}
+
+type SnapshotRepository interface {
+	// Store the fetched response of a run (see AnalysisResult.RunSnapshot, status 0 when the page got none) and the bodies
+	// of all its requests, and return the id of the snapshot. Bodies are stored once per distinct content, a body stored
+	// again only counts as used now
+	Create(analysisID int, result *utils.AnalysisResult) (int, error)
+	// Snapshots of the user's analysis newest first, without their headers
+	List(analysisID, userID int) ([]models.Snapshot, error)
+	// One snapshot of the user's analysis, snapshotID 0 is the newest one. The body is only read when withBody is set
+	Get(analysisID, userID, snapshotID int, withBody bool) (*models.Snapshot, []byte, error)
+	// What the WARC and HAR downloads of a snapshot are made from, snapshotID 0 is the newest one
+	Export(analysisID, userID, snapshotID int) (*SnapshotExport, error)
+	// Stored bodies by hash, hashes without a body are left out
+	Bodies(hashes []string) (map[string][]byte, error)
+}
+
+type ExtractionRuleRepository interface {
+	// The user's rules by name
+	List(userID int) ([]utils.ExtractionRule, error)
+	// The user's rules among ids by name, ids of other users' rules are left out
+	ListByIDs(userID int, ids []int) ([]utils.ExtractionRule, error)
+	// Rules attached to an analysis by name
+	ForAnalysis(analysisID int) ([]utils.ExtractionRule, error)
+	// Store a new rule of the user and return its id, ErrDuplicate when the user has a rule with that name
+	Create(userID int, rule utils.ExtractionRule) (int, error)
+	// Delete one of the user's rules, it is detached from every analysis
+	Delete(id, userID int) error
+	// Attach the user's rules among ruleIDs to an analysis next to those it has
+	Attach(analysisID, userID int, ruleIDs []int) error
+	// Replace the rules of an analysis with the user's rules among ruleIDs
+	SetForAnalysis(analysisID, userID int, ruleIDs []int) error
+	// The user's analyses with extracted values by id, with their id, URL and extracted data
+	Extractions(userID int) ([]models.URL, error)
+}
+
+type RetentionRepository interface {
+	// Up to limit analyses with an id above afterID by id, with the policies of their user and project
+	Policies(afterID, limit int) ([]AnalysisRetention, error)
+	// Delete up to limit runs of an analysis that are not among the newest keep (0 keeps any number) or that started
+	// before cutoff (a zero time keeps any age), and return how many. The newest run is always kept
+	PruneRuns(analysisID, keep int, cutoff time.Time, limit int) (int64, error)
+	// Same as PruneRuns for the snapshots, by the time they were fetched
+	PruneSnapshots(analysisID, keep int, cutoff time.Time, limit int) (int64, error)
+	// Delete up to limit link rows whose analysis is gone and return how many
+	DeleteOrphanLinks(limit int) (int64, error)
+	// Delete up to limit bodies no snapshot points to that were last used before cutoff and return how many
+	DeleteOrphanBlobs(cutoff time.Time, limit int) (int64, error)
+	// Take the lock called name that every instance of the server shares, locked is false when another one holds it.
+	// release frees it
+	TryLock(name string) (release func(), locked bool, err error)
+}
+
+// Columns compared by AnalysisRepository.SharingValue
+type SharedColumn string
+
+const (
+	SharedTitle           SharedColumn = "title"
+	SharedMetaDescription SharedColumn = "meta_description"
+)
+
+// What the WARC and HAR downloads of a snapshot are made from
+type SnapshotExport struct {
+	SnapshotID int
+	// Requests and responses of the run, the WARC file is written from them and their bodies
+	Exchanges []utils.Exchange
+	// The finished WARC file of runs stored before their exchanges were
+	WARC []byte
+	HAR  []byte
+}
+
+// An analysis with the retention policies it falls under, Project is nil outside a project or when it has none
+type AnalysisRetention struct {
+	AnalysisID int
+	User       models.RetentionPolicy
+	Project    *models.RetentionPolicy
+}
+
+// Optional conditions of AnalysisRepository.ListByUser and ListPage, empty fields match everything
+type AnalysisFilter struct {
+	// Only analyses where this technology was detected
+	Technology string
+	// Any of these statuses (queued, running, done, error)
+	Statuses []string
+	// Text contained in the URL or the title, ignoring case
+	Search string
+	// Creation and last update between From (inclusive) and To (exclusive), zero times leave that side open
+	CreatedFrom, CreatedTo time.Time
+	UpdatedFrom, UpdatedTo time.Time
+	HTMLVersion            string
+	HasLoginForm           *bool
+	InternalLinks          CountRange
+	ExternalLinks          CountRange
+	InaccessibleLinks      CountRange
+	// Only analyses of this project, a pointer to 0 keeps those without a project
+	ProjectID *int
+	// Only analyses carrying all of these tags
+	Tags []string
+}
+
+// Inclusive bounds of a count, nil leaves that side open
+type CountRange struct {
+	Min, Max *int
+}
+
+func (r CountRange) contains(n int) bool {
+	return (r.Min == nil || n >= *r.Min) && (r.Max == nil || n <= *r.Max)
+}
+
+// Conditions of LinkRepository.List and Domains. UserID is required, the other fields are skipped when empty
+type LinkFilter struct {
+	UserID     int
+	AnalysisID int
+	TargetURL  string
+	Kind       string
+	Status     string
+	Domain     string
+	// Only links with a smaller id, the cursor of the next page
+	Before int64
+	Limit  int
+}
+
+// The repositories the handlers work with
+type Repositories struct {
+	Users     UserRepository
+	Analyses  AnalysisRepository
+	Links     LinkRepository
+	Search    SearchRepository
+	Projects  ProjectRepository
+	Tags      TagRepository
+	Runs      RunRepository
+	Snapshots SnapshotRepository
+	Rules     ExtractionRuleRepository
+	Retention RetentionRepository
+}
+
+// Copy the summary of a run (title, headings, link counts and lists) into url
+func applyResult(url *models.URL, result *utils.AnalysisResult) {
+	url.Title = result.Title
+	url.HTMLVersion = result.HTMLVersion
+	url.HeadingCounts = result.HeadingCounts
+	url.InternalLinksCount = result.InternalLinksCount
+	url.ExternalLinksCount = result.ExternalLinksCount
+	url.HasLoginForm = result.HasLoginForm
+	url.InaccessibleLinksCount = result.InaccessibleLinksCount
+	url.InternalLinks = linkDetails(result.InternalLinks)
+	url.ExternalLinks = linkDetails(result.ExternalLinks)
+	url.InaccessibleLinks = linkDetails(result.InaccessibleLinks)
+}
+
+func linkDetails(links []utils.LinkDetail) []models.LinkDetail {
+	if links == nil {
+		return nil
+	}
+	details := make([]models.LinkDetail, len(links))
+	for i, link := range links {
+		details[i] = models.LinkDetail{URL: link.URL, Text: link.Text, Rel: link.Rel}
+	}
+	return details
+}
+
+// Copy the detail columns of a run into url, as the JSON they are stored as
+func applyDetails(url *models.URL, result *utils.AnalysisResult) {
+	url.ResponseMeta, _ = json.Marshal(result.Response)
+	url.SecurityAudit, _ = json.Marshal(result.Security)
+	url.Technologies, _ = json.Marshal(result.Technologies)
+	url.Resources, _ = json.Marshal(result.Resources)
+	url.ContentAnalysis, _ = json.Marshal(result.Content)
+	url.CharsetReport, _ = json.Marshal(result.Charset)
+	url.BrokenAnchors, _ = json.Marshal(result.BrokenAnchors)
+	url.MetaDescription = result.MetaDescription
+	url.ContentSimHash = result.ContentSimHash
+	url.BrokenAnchorsCount = result.BrokenAnchorsCount
+	url.ResultKind = result.Kind
+	// Document metadata only exists for PDFs, images, feeds and other non-HTML results
+	url.DocumentInfo = nil
+	if result.Document != nil {
+		url.DocumentInfo, _ = json.Marshal(result.Document)
+	}
+	// The rendered analysis only exists when a browser renderer is configured
+	url.RenderedResult = nil
+	if result.Rendered != nil {
+		url.RenderedResult, _ = json.Marshal(result.Rendered)
+	}
+	// Extracted fields stay NULL when no extraction rules are attached
+	url.ExtractedData = nil
+	if result.Extracted != nil {
+		url.ExtractedData, _ = json.Marshal(result.Extracted)
+	}
+}
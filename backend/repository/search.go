@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+// Search backends implement this. MySQL uses FULLTEXT indexes and skips the terms they leave out, PostgreSQL a tsvector
+// index, SQLite narrows the documents down with LIKE and ranks the newest of them like the in-memory one, which scans the documents
+type SearchRepository interface {
+	// Replace the searchable text of an analysis
+	Index(doc SearchDocument) error
+	// The user's analyses containing every term, best matches first, with the matching fields highlighted
+	Search(userID int, terms []string, limit int) ([]models.SearchHit, error)
+}
+
+// Searchable text of an analysis, its URL and owner are taken from the analysis
+type SearchDocument struct {
+	AnalysisID int
+	Title      string
+	// Anchor texts of the links, one per line
+	LinkText string
+	// Main text of the page
+	Content string
+}
+
+// Shortest term worth searching for, InnoDB does not index shorter words (innodb_ft_min_token_size)
+const minSearchTermLength = 3
+
+// Most terms taken from a query, the rest are ignored
+const maxSearchTerms = 10
+
+// Length of a highlighted snippet in runes, and how much of it comes before the first match
+const (
+	snippetLength  = 160
+	snippetContext = 40
+)
+
+// Words of a search box query, lowercased and without duplicates. Terms match the start of words, so "crawl" finds "crawler"
+func SearchTerms(query string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(query), isNotWordRune) {
+		if utf8.RuneCountInString(word) < minSearchTermLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+func isNotWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// Finds words starting with one of the terms, the word is the first submatch
+func termsPattern(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile(`(?i)(?:^|[^\pL\pN])((?:` + strings.Join(quoted, "|") + `)[\pL\pN]*)`)
+}
+
+// Every term has to start a word of one of the fields. The score counts the matching words, those of the title count
+// titleMatchWeight more times like in the MySQL ranking. ok is false when a term is missing
+func scoreHit(pattern *regexp.Regexp, terms []string, fields map[string]string) (score float64, ok bool) {
+	found := map[string]bool{}
+	for name, text := range fields {
+		for _, match := range pattern.FindAllStringSubmatch(text, -1) {
+			word := strings.ToLower(match[1])
+			for _, term := range terms {
+				if strings.HasPrefix(word, term) {
+					found[term] = true
+				}
+			}
+			score++
+			if name == "title" {
+				score += titleMatchWeight
+			}
+		}
+	}
+	return score, len(found) == len(terms)
+}
+
+// The limit best hits, newest analyses first among equal scores
+func bestHits(hits []models.SearchHit, limit int) []models.SearchHit {
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].AnalysisID > hits[j].AnalysisID
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits
+}
+
+// Snippets of the fields of a hit that contain a term, fields without a match are left out
+func highlightHit(terms []string, fields map[string]string) map[string]string {
+	pattern := termsPattern(terms)
+	highlights := map[string]string{}
+	for name, text := range fields {
+		// Only the matching line of the link texts, they are unrelated to each other
+		if name == "links" {
+			for _, line := range strings.Split(text, "\n") {
+				if pattern.MatchString(line) {
+					text = line
+					break
+				}
+			}
+		}
+		if snippet, ok := highlight(pattern, text); ok {
+			highlights[name] = snippet
+		}
+	}
+	return highlights
+}
+
+// A snippet of text around the first match with every match wrapped in <mark>
+func highlight(pattern *regexp.Regexp, text string) (string, bool) {
+	matches := pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return "", false
+	}
+
+	// Window of runes around the first match, as byte offsets
+	runeStart := utf8.RuneCountInString(text[:matches[0][2]]) - snippetContext
+	start, end := 0, len(text)
+	if runeStart > 0 {
+		start = runeOffset(text, runeStart)
+	}
+	if runeEnd := max(runeStart, 0) + snippetLength; runeEnd < utf8.RuneCountInString(text) {
+		end = runeOffset(text, runeEnd)
+	}
+	// Cut between words
+	if start > 0 {
+		if i := strings.IndexByte(text[start:matches[0][2]], ' '); i >= 0 {
+			start += i + 1
+		}
+	}
+	if end < len(text) && end > matches[0][3] {
+		if i := strings.LastIndexByte(text[matches[0][3]:end], ' '); i >= 0 {
+			end = matches[0][3] + i
+		}
+	}
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	pos := start
+	for _, match := range matches {
+		wordStart, wordEnd := match[2], match[3]
+		if wordStart < start {
+			continue
+		}
+		if wordStart >= end {
+			break
+		}
+		wordEnd = min(wordEnd, end)
+		b.WriteString(html.EscapeString(text[pos:wordStart]))
+		b.WriteString("<mark>" + html.EscapeString(text[wordStart:wordEnd]) + "</mark>")
+		pos = wordEnd
+	}
+	b.WriteString(html.EscapeString(text[pos:end]))
+	if end < len(text) {
+		b.WriteString("…")
+	}
+	return b.String(), true
+}
+
+// Byte offset of the nth rune of s
+func runeOffset(s string, n int) int {
+	for offset := range s {
+		if n == 0 {
+			return offset
+		}
+		n--
+	}
+	return len(s)
+}
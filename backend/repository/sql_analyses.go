@@ -0,0 +1,571 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+type sqlAnalyses struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func (r *sqlAnalyses) Create(url *models.URL) (int, error) {
+	// Convert complex fields to JSON strings for storage in JSON columns
+	headingCountsJSON, _ := json.Marshal(url.HeadingCounts)
+	inaccessibleLinksJSON, _ := json.Marshal(url.InaccessibleLinks)
+	internalLinksJSON, _ := json.Marshal(url.InternalLinks)
+	externalLinksJSON, _ := json.Marshal(url.ExternalLinks)
+
+	id, err := r.dialect.InsertID(r.db, `
+		INSERT INTO urls (
+			user_id, project_id, url, normalized_url, status, should_pause, title, html_version, heading_counts, internal_links_count,
+			external_links_count, has_login_form, inaccessible_links_count, inaccessible_links,
+			internal_links, external_links, created_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		url.UserID,
+		url.ProjectID,
+		url.URL,
+		sql.NullString{String: url.NormalizedURL, Valid: url.NormalizedURL != ""},
+		url.Status,
+		url.ShouldPause,
+		url.Title,
+		url.HTMLVersion,
+		headingCountsJSON,
+		url.InternalLinksCount,
+		url.ExternalLinksCount,
+		url.HasLoginForm,
+		url.InaccessibleLinksCount,
+		inaccessibleLinksJSON,
+		internalLinksJSON,
+		externalLinksJSON,
+		url.CreatedAt,
+	)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *sqlAnalyses) Find(id int) (*models.URL, error) {
+	var url models.URL
+	var projectID sql.NullInt64
+	err := r.db.QueryRow("SELECT id, user_id, project_id, url, status, should_pause FROM urls WHERE id = ?", id).
+		Scan(&url.ID, &url.UserID, &projectID, &url.URL, &url.Status, &url.ShouldPause)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	url.ProjectID = nullIntPointer(projectID)
+	return &url, nil
+}
+
+func (r *sqlAnalyses) FindIDByNormalizedURL(userID int, normalizedURL string) (int, error) {
+	var id int
+	// MySQL indexes the hash of the URL, the other databases the URL itself
+	query := "SELECT id FROM urls WHERE user_id = ? AND normalized_url = ?"
+	if r.dialect == db.MySQL {
+		query = "SELECT id FROM urls WHERE user_id = ? AND normalized_url_hash = SHA2(?, 256)"
+	}
+	err := r.db.QueryRow(query, userID, normalizedURL).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	return id, err
+}
+
+func (r *sqlAnalyses) Get(id, userID int) (*models.URL, error) {
+	var url models.URL
+	var headingCountsJSON, inaccessibleLinksJSON, internalLinksJSON, externalLinksJSON []byte
+	var responseMetaJSON, securityAuditJSON, technologiesJSON, resourcesJSON, contentAnalysisJSON, extractedDataJSON, charsetReportJSON, brokenAnchorsJSON, documentInfoJSON, renderedResultJSON []byte
+	var projectID sql.NullInt64
+
+	err := r.db.QueryRow(`
+		SELECT
+			id, user_id, project_id, url, COALESCE(normalized_url, ''), status, should_pause, title, html_version, heading_counts,
+			internal_links_count, external_links_count, has_login_form, inaccessible_links_count,
+			inaccessible_links, internal_links, external_links, response_meta, security_audit, technologies, resources, content_analysis, COALESCE(meta_description, ''), COALESCE(content_simhash, ''), extracted_data, charset_report, broken_anchors_count, broken_anchors, COALESCE(result_kind, 'html'), document_info, rendered_result, created_at, updated_at
+		FROM urls
+		WHERE id = ? AND user_id = ?`, id, userID).Scan(
+		&url.ID,
+		&url.UserID,
+		&projectID,
+		&url.URL,
+		&url.NormalizedURL,
+		&url.Status,
+		&url.ShouldPause,
+		&url.Title,
+		&url.HTMLVersion,
+		&headingCountsJSON,
+		&url.InternalLinksCount,
+		&url.ExternalLinksCount,
+		&url.HasLoginForm,
+		&url.InaccessibleLinksCount,
+		&inaccessibleLinksJSON,
+		&internalLinksJSON,
+		&externalLinksJSON,
+		&responseMetaJSON,
+		&securityAuditJSON,
+		&technologiesJSON,
+		&resourcesJSON,
+		&contentAnalysisJSON,
+		&url.MetaDescription,
+		&url.ContentSimHash,
+		&extractedDataJSON,
+		&charsetReportJSON,
+		&url.BrokenAnchorsCount,
+		&brokenAnchorsJSON,
+		&url.ResultKind,
+		&documentInfoJSON,
+		&renderedResultJSON,
+		&url.CreatedAt,
+		&url.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal JSON fields into Go structs
+	if err := json.Unmarshal(headingCountsJSON, &url.HeadingCounts); err != nil {
+		return nil, fmt.Errorf("parse heading counts: %v", err)
+	}
+	if err := json.Unmarshal(inaccessibleLinksJSON, &url.InaccessibleLinks); err != nil {
+		return nil, fmt.Errorf("parse inaccessible links: %v", err)
+	}
+	if err := json.Unmarshal(internalLinksJSON, &url.InternalLinks); err != nil {
+		return nil, fmt.Errorf("parse internal links: %v", err)
+	}
+	if err := json.Unmarshal(externalLinksJSON, &url.ExternalLinks); err != nil {
+		return nil, fmt.Errorf("parse external links: %v", err)
+	}
+
+	// Detail columns are passed through as stored, they are NULL for analyses created before they were captured
+	url.ResponseMeta = responseMetaJSON
+	url.SecurityAudit = securityAuditJSON
+	url.Technologies = technologiesJSON
+	url.ProjectID = nullIntPointer(projectID)
+	url.Resources = resourcesJSON
+	url.ContentAnalysis = contentAnalysisJSON
+	url.ExtractedData = extractedDataJSON
+	url.CharsetReport = charsetReportJSON
+	url.BrokenAnchors = brokenAnchorsJSON
+	url.DocumentInfo = documentInfoJSON
+	url.RenderedResult = renderedResultJSON
+	return &url, nil
+}
+
+// Columns of urls the listings select, in the order scanListedURLs reads them
+const listedColumns = "id, user_id, project_id, url, status, should_pause, title, html_version, internal_links_count, external_links_count, has_login_form, inaccessible_links_count, COALESCE(broken_anchors_count, 0), technologies, COALESCE(result_kind, 'html'), created_at, updated_at"
+
+func (r *sqlAnalyses) ListByUser(userID int, filter AnalysisFilter) ([]models.URL, error) {
+	where, args := analysisConditions(r.dialect, userID, filter)
+	rows, err := r.db.Query("SELECT "+listedColumns+" FROM urls WHERE "+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanListedURLs(rows)
+}
+
+func (r *sqlAnalyses) ListPage(userID int, filter AnalysisFilter, page AnalysisPage) (*AnalysisPageResult, error) {
+	page = normalizePage(page)
+	column, ok := sortColumns[page.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort column %q", page.Sort)
+	}
+
+	where, args := analysisConditions(r.dialect, userID, filter)
+	result := &AnalysisPageResult{}
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM urls WHERE "+where, args...).Scan(&result.Total); err != nil {
+		return nil, err
+	}
+
+	direction, operator := "ASC", ">"
+	if page.Desc {
+		direction, operator = "DESC", "<"
+	}
+	// Keyset pagination: rows after the last one of the previous page in (sort value, id) order
+	if page.Cursor != "" {
+		value, id, err := decodeCursor(page)
+		if err != nil {
+			return nil, err
+		}
+		where += fmt.Sprintf(" AND (%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column.expr, operator)
+		args = append(args, value, value, id)
+	}
+	// One extra row tells whether there is another page
+	args = append(args, page.Limit+1)
+
+	rows, err := r.db.Query(fmt.Sprintf("SELECT %s FROM urls WHERE %s ORDER BY %s %s, id %s LIMIT ?", listedColumns, where, column.expr, direction, direction), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if result.Items, err = scanListedURLs(rows); err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) > page.Limit {
+		result.Items = result.Items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		result.NextCursor = encodeCursor(page, sortValue(last, page.Sort), last.ID)
+	}
+	return result, nil
+}
+
+// WHERE conditions of a filter on the user's rows of urls
+func analysisConditions(dialect db.Dialect, userID int, filter AnalysisFilter) (string, []interface{}) {
+	where := "user_id = ?"
+	args := []interface{}{userID}
+
+	// Keeps only the URLs where that technology was detected
+	if filter.Technology != "" {
+		switch dialect {
+		case db.Postgres:
+			where += " AND technologies @> jsonb_build_array(jsonb_build_object('name', CAST(? AS TEXT)))"
+		case db.SQLite:
+			where += " AND EXISTS (SELECT 1 FROM json_each(CAST(technologies AS TEXT)) WHERE json_extract(value, '$.name') = ?)"
+		default:
+			where += " AND JSON_CONTAINS(technologies, JSON_OBJECT('name', ?))"
+		}
+		args = append(args, filter.Technology)
+	}
+	if len(filter.Statuses) > 0 {
+		where += " AND status IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(filter.Statuses)), ", ") + ")"
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if filter.Search != "" {
+		// % and _ typed by the user are matched literally
+		pattern := "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(filter.Search) + "%"
+		where += " AND (" + dialect.ILike("url") + " OR " + dialect.ILike("title") + ")"
+		args = append(args, pattern, pattern)
+	}
+	for _, bound := range []struct {
+		condition string
+		value     time.Time
+	}{
+		{"created_at >= ?", filter.CreatedFrom},
+		{"created_at < ?", filter.CreatedTo},
+		{"updated_at >= ?", filter.UpdatedFrom},
+		{"updated_at < ?", filter.UpdatedTo},
+	} {
+		if !bound.value.IsZero() {
+			where += " AND " + bound.condition
+			args = append(args, bound.value)
+		}
+	}
+	if filter.HTMLVersion != "" {
+		where += " AND html_version = ?"
+		args = append(args, filter.HTMLVersion)
+	}
+	if filter.HasLoginForm != nil {
+		where += " AND has_login_form = ?"
+		args = append(args, *filter.HasLoginForm)
+	}
+	for _, count := range []struct {
+		column string
+		bounds CountRange
+	}{
+		{"internal_links_count", filter.InternalLinks},
+		{"external_links_count", filter.ExternalLinks},
+		{"inaccessible_links_count", filter.InaccessibleLinks},
+	} {
+		if count.bounds.Min != nil {
+			where += " AND " + count.column + " >= ?"
+			args = append(args, *count.bounds.Min)
+		}
+		if count.bounds.Max != nil {
+			where += " AND " + count.column + " <= ?"
+			args = append(args, *count.bounds.Max)
+		}
+	}
+	if filter.ProjectID != nil {
+		if *filter.ProjectID == 0 {
+			where += " AND project_id IS NULL"
+		} else {
+			where += " AND project_id = ?"
+			args = append(args, *filter.ProjectID)
+		}
+	}
+	if len(filter.Tags) > 0 {
+		// Analyses carrying as many of the tags as were asked for carry all of them
+		where += `
+			AND id IN (
+				SELECT at.url_id FROM analysis_tags at JOIN tags t ON t.id = at.tag_id
+				WHERE t.user_id = ? AND t.name IN (` + strings.TrimSuffix(strings.Repeat("?, ", len(filter.Tags)), ", ") + `)
+				GROUP BY at.url_id HAVING COUNT(*) = ?
+			)`
+		args = append(args, userID)
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+		args = append(args, len(filter.Tags))
+	}
+	return where, args
+}
+
+// A nullable integer column as a pointer, nil for NULL
+func nullIntPointer(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	value := int(n.Int64)
+	return &value
+}
+
+func scanListedURLs(rows *sql.Rows) ([]models.URL, error) {
+	urls := []models.URL{}
+	for rows.Next() {
+		var url models.URL
+		var technologiesJSON []byte
+		var projectID sql.NullInt64
+		err := rows.Scan(
+			&url.ID,
+			&url.UserID,
+			&projectID,
+			&url.URL,
+			&url.Status,
+			&url.ShouldPause,
+			&url.Title,
+			&url.HTMLVersion,
+			&url.InternalLinksCount,
+			&url.ExternalLinksCount,
+			&url.HasLoginForm,
+			&url.InaccessibleLinksCount,
+			&url.BrokenAnchorsCount,
+			&technologiesJSON,
+			&url.ResultKind,
+			&url.CreatedAt,
+			&url.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		url.Technologies = technologiesJSON
+		url.ProjectID = nullIntPointer(projectID)
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (r *sqlAnalyses) Fingerprinted(userID int) ([]models.URL, error) {
+	rows, err := r.db.Query(`
+		SELECT id, url, COALESCE(title, ''), content_simhash
+		FROM urls
+		WHERE user_id = ? AND content_simhash IS NOT NULL
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []models.URL{}
+	for rows.Next() {
+		var url models.URL
+		if err := rows.Scan(&url.ID, &url.URL, &url.Title, &url.ContentSimHash); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (r *sqlAnalyses) SharingValue(userID int, column SharedColumn) ([]models.URL, error) {
+	// column is one of the SharedColumn constants, never user input
+	rows, err := r.db.Query(`
+		SELECT id, url, COALESCE(title, ''), COALESCE(meta_description, '')
+		FROM urls
+		WHERE user_id = ? AND `+string(column)+` IN (
+			SELECT `+string(column)+` FROM urls
+			WHERE user_id = ? AND `+string(column)+` IS NOT NULL AND `+string(column)+` <> ''
+			GROUP BY `+string(column)+`
+			HAVING COUNT(*) > 1
+		)
+		ORDER BY `+string(column)+`, id`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []models.URL{}
+	for rows.Next() {
+		var url models.URL
+		if err := rows.Scan(&url.ID, &url.URL, &url.Title, &url.MetaDescription); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (r *sqlAnalyses) BackfillNormalizedURLs(normalize func(url string) (string, error)) (int, error) {
+	rows, err := r.db.Query("SELECT id, url FROM urls WHERE normalized_url IS NULL ORDER BY id")
+	if err != nil {
+		return 0, err
+	}
+	var pending []models.URL
+	for rows.Next() {
+		var url models.URL
+		if err := rows.Scan(&url.ID, &url.URL); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		pending = append(pending, url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	filled := 0
+	for _, url := range pending {
+		normalized, err := normalize(url.URL)
+		if err != nil {
+			continue
+		}
+		// Rows are visited oldest first, a later analysis of the same page hits the unique index and keeps NULL
+		if _, err := r.db.Exec("UPDATE urls SET normalized_url = ? WHERE id = ?", normalized, url.ID); err != nil {
+			if isDuplicateEntry(err) {
+				continue
+			}
+			return filled, err
+		}
+		filled++
+	}
+	return filled, nil
+}
+
+func (r *sqlAnalyses) Delete(id int) error {
+	_, err := r.db.Exec("DELETE FROM urls WHERE id = ?", id)
+	return err
+}
+
+func (r *sqlAnalyses) DeleteForUser(userID int, ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	// DELETE FROM urls WHERE user_id = ? AND id IN (?, ?, ?)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	result, err := r.db.Exec(fmt.Sprintf("DELETE FROM urls WHERE user_id = ? AND id IN (%s)", placeholders), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (r *sqlAnalyses) SetStatus(id int, status string) error {
+	_, err := r.db.Exec("UPDATE urls SET status = ? WHERE id = ?", status, id)
+	return err
+}
+
+func (r *sqlAnalyses) SetShouldPause(id int, shouldPause bool) error {
+	_, err := r.db.Exec("UPDATE urls SET should_pause = ? WHERE id = ?", shouldPause, id)
+	return err
+}
+
+func (r *sqlAnalyses) SaveResult(id int, status string, shouldPause *bool, result *utils.AnalysisResult) error {
+	var url models.URL
+	applyResult(&url, result)
+
+	// Convert complex fields to JSON strings for storage in JSON columns
+	headingCountsJSON, _ := json.Marshal(url.HeadingCounts)
+	inaccessibleLinksJSON, _ := json.Marshal(url.InaccessibleLinks)
+	internalLinksJSON, _ := json.Marshal(url.InternalLinks)
+	externalLinksJSON, _ := json.Marshal(url.ExternalLinks)
+
+	_, err := r.db.Exec(`
+		UPDATE urls
+		SET
+			status = ?,
+			should_pause = COALESCE(?, should_pause),
+			title = ?,
+			html_version = ?,
+			heading_counts = ?,
+			internal_links_count = ?,
+			external_links_count = ?,
+			has_login_form = ?,
+			inaccessible_links_count = ?,
+			inaccessible_links = ?,
+			internal_links = ?,
+			external_links = ?,
+			updated_at = ?
+		WHERE id = ?`,
+		status,
+		sql.NullBool{Bool: shouldPause != nil && *shouldPause, Valid: shouldPause != nil},
+		url.Title,
+		url.HTMLVersion,
+		headingCountsJSON,
+		url.InternalLinksCount,
+		url.ExternalLinksCount,
+		url.HasLoginForm,
+		url.InaccessibleLinksCount,
+		inaccessibleLinksJSON,
+		internalLinksJSON,
+		externalLinksJSON,
+		time.Now(),
+		id,
+	)
+	return err
+}
+
+func (r *sqlAnalyses) SaveDetails(id int, result *utils.AnalysisResult) error {
+	var url models.URL
+	applyDetails(&url, result)
+
+	_, err := r.db.Exec(`
+		UPDATE urls
+		SET
+			response_meta = ?,
+			security_audit = ?,
+			technologies = ?,
+			resources = ?,
+			content_analysis = ?,
+			meta_description = ?,
+			content_simhash = ?,
+			extracted_data = ?,
+			charset_report = ?,
+			broken_anchors_count = ?,
+			broken_anchors = ?,
+			result_kind = ?,
+			document_info = ?,
+			rendered_result = ?
+		WHERE id = ?`,
+		[]byte(url.ResponseMeta),
+		[]byte(url.SecurityAudit),
+		[]byte(url.Technologies),
+		[]byte(url.Resources),
+		[]byte(url.ContentAnalysis),
+		url.MetaDescription,
+		sql.NullString{String: url.ContentSimHash, Valid: url.ContentSimHash != ""},
+		[]byte(url.ExtractedData),
+		[]byte(url.CharsetReport),
+		url.BrokenAnchorsCount,
+		[]byte(url.BrokenAnchors),
+		sql.NullString{String: url.ResultKind, Valid: url.ResultKind != ""},
+		[]byte(url.DocumentInfo),
+		[]byte(url.RenderedResult),
+		id,
+	)
+	return err
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+// Repositories on a migrated SQLite database in a temporary file
+func newSQLiteRepositories(t *testing.T) *Repositories {
+	t.Helper()
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	db.Connect()
+	t.Cleanup(func() { db.DB.Close() })
+	if _, err := db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewSQL(db.DB, db.Driver)
+}
+
+// Times written by the column defaults and times written from Go have to compare as one format: the listing pages
+// through both with a cursor and filters them by date
+func TestListPageOnSQLite(t *testing.T) {
+	repos := newSQLiteRepositories(t)
+	userID, err := repos.Users.Create("alice", "alice@example.com", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// newest keeps the updated_at of the column default, the other two get theirs from Go
+	now := time.Now()
+	var ids []int
+	for _, url := range []string{"https://example.com/newest", "https://example.com/middle", "https://example.com/oldest"} {
+		id, err := repos.Analyses.Create(&models.URL{UserID: userID, URL: url, Status: "queued", CreatedAt: now})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	newest, middle, oldest := ids[0], ids[1], ids[2]
+	for id, updatedAt := range map[int]time.Time{middle: now.Add(-time.Hour), oldest: now.Add(-2 * time.Hour)} {
+		if _, err := db.DB.Exec("UPDATE urls SET updated_at = ? WHERE id = ?", updatedAt, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	walk := func(desc bool) []int {
+		var seen []int
+		page := AnalysisPage{Sort: "updated_at", Desc: desc, Limit: 1}
+		for len(seen) <= len(ids) {
+			result, err := repos.Analyses.ListPage(userID, AnalysisFilter{}, page)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range result.Items {
+				seen = append(seen, item.ID)
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			page.Cursor = result.NextCursor
+		}
+		return seen
+	}
+	if got, want := walk(true), []int{newest, middle, oldest}; !reflect.DeepEqual(got, want) {
+		t.Errorf("updated_at desc: pages %v, want %v", got, want)
+	}
+	if got, want := walk(false), []int{oldest, middle, newest}; !reflect.DeepEqual(got, want) {
+		t.Errorf("updated_at asc: pages %v, want %v", got, want)
+	}
+
+	// The bounds are inclusive from and exclusive to, also for the time the default wrote
+	var defaulted time.Time
+	if err := db.DB.QueryRow("SELECT updated_at FROM urls WHERE id = ?", newest).Scan(&defaulted); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		filter AnalysisFilter
+		want   []int
+	}{
+		{AnalysisFilter{UpdatedFrom: defaulted}, []int{newest}},
+		{AnalysisFilter{UpdatedTo: defaulted}, []int{oldest, middle}},
+		{AnalysisFilter{UpdatedFrom: now.Add(-90 * time.Minute), UpdatedTo: now.Add(-30 * time.Minute)}, []int{middle}},
+	} {
+		result, err := repos.Analyses.ListPage(userID, tc.filter, AnalysisPage{Sort: "updated_at", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, item := range result.Items {
+			got = append(got, item.ID)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("updated from %s to %s: got %v, want %v", tc.filter.UpdatedFrom, tc.filter.UpdatedTo, got, tc.want)
+		}
+	}
+}
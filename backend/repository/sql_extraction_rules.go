@@ -0,0 +1,148 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+type sqlExtractionRules struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+// Attach a rule of the user to an analysis, nothing happens when it is attached already or belongs to someone else
+const attachRuleQuery = `
+	INSERT INTO analysis_extraction_rules (url_id, rule_id)
+	SELECT u.id, r.id FROM urls u, extraction_rules r WHERE u.id = ? AND r.id = ? AND r.user_id = ?`
+
+func (r *sqlExtractionRules) List(userID int) ([]utils.ExtractionRule, error) {
+	return r.query(`
+		SELECT id, name, selector_type, selector, attribute, multiple
+		FROM extraction_rules
+		WHERE user_id = ?
+		ORDER BY name`, userID)
+}
+
+func (r *sqlExtractionRules) ListByIDs(userID int, ids []int) ([]utils.ExtractionRule, error) {
+	if len(ids) == 0 {
+		return []utils.ExtractionRule{}, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return r.query(`
+		SELECT id, name, selector_type, selector, attribute, multiple
+		FROM extraction_rules
+		WHERE user_id = ? AND id IN (`+placeholders+`)
+		ORDER BY name`, args...)
+}
+
+func (r *sqlExtractionRules) ForAnalysis(analysisID int) ([]utils.ExtractionRule, error) {
+	return r.query(`
+		SELECT r.id, r.name, r.selector_type, r.selector, r.attribute, r.multiple
+		FROM extraction_rules r
+		JOIN analysis_extraction_rules ar ON ar.rule_id = r.id
+		WHERE ar.url_id = ?
+		ORDER BY r.name`, analysisID)
+}
+
+func (r *sqlExtractionRules) Create(userID int, rule utils.ExtractionRule) (int, error) {
+	id, err := r.dialect.InsertID(r.db, `
+		INSERT INTO extraction_rules (user_id, name, selector_type, selector, attribute, multiple)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, rule.Name, rule.SelectorType, rule.Selector, rule.Attribute, rule.Multiple)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *sqlExtractionRules) Delete(id, userID int) error {
+	res, err := r.db.Exec("DELETE FROM extraction_rules WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlExtractionRules) Attach(analysisID, userID int, ruleIDs []int) error {
+	for _, ruleID := range ruleIDs {
+		if _, err := r.db.Exec(r.dialect.InsertIgnore(attachRuleQuery), analysisID, ruleID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlExtractionRules) SetForAnalysis(analysisID, userID int, ruleIDs []int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM analysis_extraction_rules WHERE url_id = ?", analysisID); err != nil {
+		return err
+	}
+	for _, ruleID := range ruleIDs {
+		if _, err := tx.Exec(r.dialect.InsertIgnore(attachRuleQuery), analysisID, ruleID, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlExtractionRules) Extractions(userID int) ([]models.URL, error) {
+	rows, err := r.db.Query(`
+		SELECT id, url, extracted_data
+		FROM urls
+		WHERE user_id = ? AND extracted_data IS NOT NULL
+		ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []models.URL{}
+	for rows.Next() {
+		var url models.URL
+		var extractedJSON []byte
+		if err := rows.Scan(&url.ID, &url.URL, &extractedJSON); err != nil {
+			return nil, err
+		}
+		url.ExtractedData = extractedJSON
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// Run a query selecting the columns of a rule
+func (r *sqlExtractionRules) query(query string, args ...interface{}) ([]utils.ExtractionRule, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []utils.ExtractionRule{}
+	for rows.Next() {
+		var rule utils.ExtractionRule
+		if err := rows.Scan(&rule.ID, &rule.Name, &rule.SelectorType, &rule.Selector, &rule.Attribute, &rule.Multiple); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
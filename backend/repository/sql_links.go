@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+// Rows per INSERT when the links of a run are stored
+const linkInsertBatchSize = 500
+
+type sqlLinks struct {
+	db *sql.DB
+}
+
+func (r *sqlLinks) Replace(analysisID int, links []models.Link) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.QueryRow("SELECT user_id FROM urls WHERE id = ?", analysisID).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM links WHERE url_id = ?", analysisID); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(links); start += linkInsertBatchSize {
+		batch := links[start:min(start+linkInsertBatchSize, len(links))]
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*9)
+		for i, link := range batch {
+			placeholders[i] = "(?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			args = append(args, userID, analysisID, link.Kind, link.TargetURL, link.TargetDomain, link.AnchorText, link.Rel, link.CheckStatus,
+				sql.NullString{String: link.CheckError, Valid: link.CheckError != ""})
+		}
+		_, err := tx.Exec(`
+			INSERT INTO links (user_id, url_id, kind, target_url, target_domain, anchor_text, rel, check_status, check_error)
+			VALUES `+strings.Join(placeholders, ", "), args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *sqlLinks) List(filter LinkFilter) ([]models.Link, error) {
+	where, args := linkConditions(filter)
+	if filter.Before > 0 {
+		where += " AND l.id < ?"
+		args = append(args, filter.Before)
+	}
+	args = append(args, filter.Limit)
+
+	rows, err := r.db.Query(`
+		SELECT l.id, l.url_id, u.url, COALESCE(u.title, ''), l.kind, l.target_url, l.target_domain, COALESCE(l.anchor_text, ''),
+			l.rel, l.check_status, COALESCE(l.check_error, '')
+		FROM links l
+		JOIN urls u ON u.id = l.url_id
+		WHERE `+where+`
+		ORDER BY l.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []models.Link{}
+	for rows.Next() {
+		var link models.Link
+		if err := rows.Scan(&link.ID, &link.AnalysisID, &link.SourceURL, &link.SourceTitle, &link.Kind, &link.TargetURL, &link.TargetDomain, &link.AnchorText, &link.Rel, &link.CheckStatus, &link.CheckError); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (r *sqlLinks) Domains(filter LinkFilter) ([]models.LinkDomain, error) {
+	where, args := linkConditions(filter)
+	args = append(args, filter.Limit)
+
+	// Relative and invalid links have no domain
+	rows, err := r.db.Query(`
+		SELECT l.target_domain, COUNT(*), SUM(CASE WHEN l.check_status = 'broken' THEN 1 ELSE 0 END), COUNT(DISTINCT l.url_id)
+		FROM links l
+		WHERE `+where+` AND l.target_domain <> ''
+		GROUP BY l.target_domain
+		ORDER BY COUNT(*) DESC, l.target_domain
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []models.LinkDomain{}
+	for rows.Next() {
+		var domain models.LinkDomain
+		if err := rows.Scan(&domain.Domain, &domain.Links, &domain.BrokenLinks, &domain.Analyses); err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+	return domains, rows.Err()
+}
+
+// WHERE conditions of a filter on the links table aliased l
+func linkConditions(filter LinkFilter) (string, []interface{}) {
+	where := "l.user_id = ?"
+	args := []interface{}{filter.UserID}
+	if filter.AnalysisID > 0 {
+		where += " AND l.url_id = ?"
+		args = append(args, filter.AnalysisID)
+	}
+	if filter.TargetURL != "" {
+		where += " AND l.target_url = ?"
+		args = append(args, filter.TargetURL)
+	}
+	if filter.Kind != "" {
+		where += " AND l.kind = ?"
+		args = append(args, filter.Kind)
+	}
+	if filter.Status != "" {
+		where += " AND l.check_status = ?"
+		args = append(args, filter.Status)
+	}
+	if filter.Domain != "" {
+		where += " AND l.target_domain = ?"
+		args = append(args, filter.Domain)
+	}
+	return where, args
+}
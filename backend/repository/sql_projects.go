@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+type sqlProjects struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+// Columns of a project with its number of analyses, in the order scanProject reads them
+const projectColumns = `
+	p.id, p.user_id, p.name, COALESCE(p.description, ''), p.settings, p.created_at, p.updated_at,
+	(SELECT COUNT(*) FROM urls u WHERE u.project_id = p.id)`
+
+func (r *sqlProjects) Create(project *models.Project) (int, error) {
+	settingsJSON, _ := json.Marshal(project.Settings)
+	id, err := r.dialect.InsertID(r.db, "INSERT INTO projects (user_id, name, description, settings) VALUES (?, ?, ?, ?)",
+		project.UserID, project.Name, project.Description, settingsJSON)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *sqlProjects) Get(id, userID int) (*models.Project, error) {
+	project, err := scanProject(r.db.QueryRow("SELECT "+projectColumns+" FROM projects p WHERE p.id = ? AND p.user_id = ?", id, userID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return project, err
+}
+
+func (r *sqlProjects) List(userID int) ([]models.Project, error) {
+	rows, err := r.db.Query("SELECT "+projectColumns+" FROM projects p WHERE p.user_id = ? ORDER BY p.name", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []models.Project{}
+	for rows.Next() {
+		project, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, *project)
+	}
+	return projects, rows.Err()
+}
+
+func (r *sqlProjects) Update(project *models.Project) error {
+	settingsJSON, _ := json.Marshal(project.Settings)
+	res, err := r.db.Exec("UPDATE projects SET name = ?, description = ?, settings = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?",
+		project.Name, project.Description, settingsJSON, project.ID, project.UserID)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	// An update that changes nothing affects no row either, so a missing project is told apart with a lookup
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		if _, err := r.Get(project.ID, project.UserID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *sqlProjects) Delete(id, userID int) error {
+	// The foreign key takes the analyses out of the project
+	res, err := r.db.Exec("DELETE FROM projects WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlProjects) MoveAnalyses(userID int, analysisIDs []int, projectID *int) (int64, error) {
+	if len(analysisIDs) == 0 {
+		return 0, nil
+	}
+	if projectID != nil {
+		if _, err := r.Get(*projectID, userID); err != nil {
+			return 0, err
+		}
+	}
+
+	// UPDATE urls SET project_id = ? WHERE user_id = ? AND id IN (?, ?, ?)
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(analysisIDs)), ", ")
+	args := []interface{}{projectID, userID}
+	for _, id := range analysisIDs {
+		args = append(args, id)
+	}
+	// The analyses found, not the rows changed: those already in the project count as moved too
+	var moved int64
+	countArgs := append([]interface{}{userID}, args[2:]...)
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM urls WHERE user_id = ? AND id IN ("+placeholders+")", countArgs...).Scan(&moved); err != nil {
+		return 0, err
+	}
+	if _, err := r.db.Exec("UPDATE urls SET project_id = ? WHERE user_id = ? AND id IN ("+placeholders+")", args...); err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// Scan the columns of projectColumns
+func scanProject(row interface{ Scan(...interface{}) error }) (*models.Project, error) {
+	var project models.Project
+	var settingsJSON []byte
+	err := row.Scan(&project.ID, &project.UserID, &project.Name, &project.Description, &settingsJSON, &project.CreatedAt, &project.UpdatedAt, &project.Analyses)
+	if err != nil {
+		return nil, err
+	}
+	if len(settingsJSON) > 0 {
+		json.Unmarshal(settingsJSON, &project.Settings)
+	}
+	return &project, nil
+}
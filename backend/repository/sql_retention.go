@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+type sqlRetention struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func (r *sqlRetention) Policies(afterID, limit int) ([]AnalysisRetention, error) {
+	rows, err := r.db.Query(`
+		SELECT u.id, us.retention, p.settings
+		FROM urls u
+		JOIN users us ON us.id = u.user_id
+		LEFT JOIN projects p ON p.id = u.project_id
+		WHERE u.id > ?
+		ORDER BY u.id
+		LIMIT ?`, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var analyses []AnalysisRetention
+	for rows.Next() {
+		var analysis AnalysisRetention
+		var userJSON, projectJSON []byte
+		if err := rows.Scan(&analysis.AnalysisID, &userJSON, &projectJSON); err != nil {
+			return nil, err
+		}
+		if len(userJSON) > 0 {
+			json.Unmarshal(userJSON, &analysis.User)
+		}
+		if len(projectJSON) > 0 {
+			var settings models.ProjectSettings
+			json.Unmarshal(projectJSON, &settings)
+			analysis.Project = settings.Retention
+		}
+		analyses = append(analyses, analysis)
+	}
+	return analyses, rows.Err()
+}
+
+func (r *sqlRetention) PruneRuns(analysisID, keep int, cutoff time.Time, limit int) (int64, error) {
+	return r.prune("analysis_runs", "started_at", analysisID, keep, cutoff, limit)
+}
+
+func (r *sqlRetention) PruneSnapshots(analysisID, keep int, cutoff time.Time, limit int) (int64, error) {
+	return r.prune("snapshots", "fetched_at", analysisID, keep, cutoff, limit)
+}
+
+// Delete up to limit rows of table (analysis_runs or snapshots) of an analysis that are past keep or whose timeColumn
+// is before cutoff, never the newest row
+func (r *sqlRetention) prune(table, timeColumn string, analysisID, keep int, cutoff time.Time, limit int) (int64, error) {
+	rows, err := r.db.Query("SELECT id, "+timeColumn+" FROM "+table+" WHERE url_id = ? ORDER BY id DESC", analysisID)
+	if err != nil {
+		return 0, err
+	}
+	var expired []interface{}
+	for position := 0; rows.Next() && len(expired) < limit; position++ {
+		var id int64
+		var at time.Time
+		if err := rows.Scan(&id, &at); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if position == 0 {
+			continue
+		}
+		if (keep > 0 && position >= keep) || (!cutoff.IsZero() && at.Before(cutoff)) {
+			expired = append(expired, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	return r.deleteIn("DELETE FROM "+table+" WHERE id IN", expired)
+}
+
+func (r *sqlRetention) DeleteOrphanLinks(limit int) (int64, error) {
+	ids, err := r.values(`
+		SELECT l.id FROM links l
+		LEFT JOIN urls u ON u.id = l.url_id
+		WHERE u.id IS NULL
+		LIMIT ?`, limit)
+	if err != nil {
+		return 0, err
+	}
+	return r.deleteIn("DELETE FROM links WHERE id IN", ids)
+}
+
+func (r *sqlRetention) DeleteOrphanBlobs(cutoff time.Time, limit int) (int64, error) {
+	hashes, err := r.values(`
+		SELECT b.hash FROM snapshot_blobs b
+		LEFT JOIN snapshots s ON s.blob_hash = b.hash
+		LEFT JOIN snapshot_exchange_blobs e ON e.blob_hash = b.hash
+		WHERE s.id IS NULL AND e.snapshot_id IS NULL AND b.last_used_at < ?
+		LIMIT ?`, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	// The age is checked again, a run may have reused the body since it was selected
+	return r.deleteIn("DELETE FROM snapshot_blobs WHERE last_used_at < ? AND hash IN", hashes, cutoff)
+}
+
+func (r *sqlRetention) TryLock(name string) (func(), bool, error) {
+	ctx := context.Background()
+	// MySQL and PostgreSQL locks belong to the session, the lock is taken and released on the same connection
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	locked, err := r.dialect.Lock(ctx, conn, name, 0)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+	return func() {
+		r.dialect.Unlock(ctx, conn, name)
+		conn.Close()
+	}, true, nil
+}
+
+// The first column of every row of a query, as arguments for deleteIn
+func (r *sqlRetention) values(query string, args ...interface{}) ([]interface{}, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var values []interface{}
+	for rows.Next() {
+		var value interface{}
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// Run a DELETE ending in "IN" for the values, e.g. DELETE FROM links WHERE id IN (?, ?, ?). args are the arguments of
+// the placeholders before the IN
+func (r *sqlRetention) deleteIn(statement string, values []interface{}, args ...interface{}) (int64, error) {
+	if len(values) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+	res, err := r.db.Exec(statement+" ("+placeholders+")", append(args, values...)...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
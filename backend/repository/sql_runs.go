@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+type sqlRuns struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+// Columns of a run in the order scanRun reads them, the result is selected separately
+const runColumns = `
+	r.id, r.url_id, r.snapshot_id, r.status, COALESCE(r.error, ''), COALESCE(r.final_url, ''), r.status_code, r.internal_links_count,
+	r.external_links_count, r.inaccessible_links_count, r.broken_anchors_count, r.started_at, r.finished_at, r.duration_ms`
+
+func (r *sqlRuns) Create(run *models.AnalysisRun) (int, error) {
+	id, err := r.dialect.InsertID(r.db, `
+		INSERT INTO analysis_runs (
+			url_id, snapshot_id, status, error, final_url, status_code, internal_links_count, external_links_count,
+			inaccessible_links_count, broken_anchors_count, result, started_at, finished_at, duration_ms
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		run.AnalysisID,
+		run.SnapshotID,
+		run.Status,
+		sql.NullString{String: run.Error, Valid: run.Error != ""},
+		run.FinalURL,
+		run.StatusCode,
+		run.InternalLinksCount,
+		run.ExternalLinksCount,
+		run.InaccessibleLinksCount,
+		run.BrokenAnchorsCount,
+		[]byte(run.Result),
+		run.StartedAt,
+		run.FinishedAt,
+		run.DurationMs,
+	)
+	return int(id), err
+}
+
+func (r *sqlRuns) List(analysisID, before, limit int) ([]models.AnalysisRun, error) {
+	query := "SELECT " + runColumns + ", NULL FROM analysis_runs r WHERE r.url_id = ?"
+	args := []interface{}{analysisID}
+	if before > 0 {
+		query += " AND r.id < ?"
+		args = append(args, before)
+	}
+	query += " ORDER BY r.id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []models.AnalysisRun{}
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+func (r *sqlRuns) Get(analysisID, userID, runID int) (*models.AnalysisRun, error) {
+	query := `
+		SELECT ` + runColumns + `, r.result
+		FROM analysis_runs r
+		JOIN urls u ON u.id = r.url_id
+		WHERE r.url_id = ? AND u.user_id = ?`
+	args := []interface{}{analysisID, userID}
+	if runID == 0 {
+		query += " ORDER BY r.id DESC LIMIT 1"
+	} else {
+		query += " AND r.id = ?"
+		args = append(args, runID)
+	}
+
+	run, err := scanRun(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return run, err
+}
+
+// Scan the columns of runColumns followed by the result
+func scanRun(row interface{ Scan(...interface{}) error }) (*models.AnalysisRun, error) {
+	var run models.AnalysisRun
+	var snapshotID sql.NullInt64
+	var result []byte
+	err := row.Scan(
+		&run.ID,
+		&run.AnalysisID,
+		&snapshotID,
+		&run.Status,
+		&run.Error,
+		&run.FinalURL,
+		&run.StatusCode,
+		&run.InternalLinksCount,
+		&run.ExternalLinksCount,
+		&run.InaccessibleLinksCount,
+		&run.BrokenAnchorsCount,
+		&run.StartedAt,
+		&run.FinishedAt,
+		&run.DurationMs,
+		&result,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotID.Valid {
+		id := int(snapshotID.Int64)
+		run.SnapshotID = &id
+	}
+	if len(result) > 0 {
+		run.Result = result
+	}
+	return &run, nil
+}
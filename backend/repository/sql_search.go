@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+// Weight of a match in the title over a match anywhere else
+const titleMatchWeight = 2
+
+// Most documents SQLite reads and ranks for one search, the newest analyses matching every term. Older matches beyond
+// that are not found
+const sqliteSearchScanLimit = 1000
+
+// Words InnoDB leaves out of its FULLTEXT indexes by default (INFORMATION_SCHEMA.INNODB_FT_DEFAULT_STOPWORD). A required
+// term that is not indexed matches nothing, so these are not searched for
+var innodbStopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true, "be": true, "by": true, "com": true,
+	"de": true, "en": true, "for": true, "from": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"la": true, "of": true, "on": true, "or": true, "that": true, "the": true, "this": true, "to": true, "was": true,
+	"what": true, "when": true, "where": true, "who": true, "will": true, "with": true, "und": true, "www": true,
+}
+
+type sqlSearch struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func (r *sqlSearch) Index(doc SearchDocument) error {
+	d := r.dialect
+	// The URL and the owner come from the analysis, a missing analysis inserts nothing
+	_, err := r.db.Exec(`
+		INSERT INTO analysis_search (url_id, user_id, url, title, link_text, content)
+		SELECT id, user_id, url, ?, ?, ? FROM urls WHERE id = ?`+
+		d.OnConflictUpdate("url_id")+`url = `+d.Excluded("url")+`, title = `+d.Excluded("title")+
+		`, link_text = `+d.Excluded("link_text")+`, content = `+d.Excluded("content"),
+		doc.Title, doc.LinkText, doc.Content, doc.AnalysisID)
+	return err
+}
+
+func (r *sqlSearch) Search(userID int, terms []string, limit int) ([]models.SearchHit, error) {
+	switch r.dialect {
+	case db.Postgres:
+		return r.searchPostgres(userID, terms, limit)
+	case db.SQLite:
+		return r.searchSQLite(userID, terms, limit)
+	}
+
+	// Words shorter than the server indexes (innodb_ft_min_token_size) and stopwords are not in the index, requiring
+	// them would find nothing. Only the other terms are searched for, a query of nothing else finds nothing
+	var minTokenSize int
+	if err := r.db.QueryRow("SELECT @@innodb_ft_min_token_size").Scan(&minTokenSize); err != nil {
+		return nil, err
+	}
+	var indexed []string
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) >= minTokenSize && !innodbStopwords[term] {
+			indexed = append(indexed, term)
+		}
+	}
+	if len(indexed) == 0 {
+		return []models.SearchHit{}, nil
+	}
+
+	// Boolean mode with every term required and matching the start of words: +crawl* +report*
+	required := make([]string, len(indexed))
+	for i, term := range indexed {
+		required[i] = "+" + term + "*"
+	}
+	against := strings.Join(required, " ")
+
+	rows, err := r.db.Query(`
+		SELECT s.url_id, s.url, s.title, u.status, s.link_text, s.content,
+			MATCH(s.title, s.url, s.link_text, s.content) AGAINST (? IN BOOLEAN MODE) + ? * MATCH(s.title) AGAINST (? IN BOOLEAN MODE) AS score
+		FROM analysis_search s
+		JOIN urls u ON u.id = s.url_id
+		WHERE s.user_id = ? AND MATCH(s.title, s.url, s.link_text, s.content) AGAINST (? IN BOOLEAN MODE)
+		ORDER BY score DESC, s.url_id DESC
+		LIMIT ?`,
+		against, titleMatchWeight, against, userID, against, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanHits(rows, terms, nil)
+}
+
+// Every term is a prefix query on the document: crawl:* & report:*
+func (r *sqlSearch) searchPostgres(userID int, terms []string, limit int) ([]models.SearchHit, error) {
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	query := strings.Join(prefixes, " & ")
+
+	rows, err := r.db.Query(`
+		SELECT s.url_id, s.url, s.title, u.status, s.link_text, s.content,
+			ts_rank(s.document, q) + ? * ts_rank(to_tsvector('simple', s.title), q) AS score
+		FROM analysis_search s
+		JOIN urls u ON u.id = s.url_id
+		CROSS JOIN to_tsquery('simple', ?) q
+		WHERE s.user_id = ? AND s.document @@ q
+		ORDER BY score DESC, s.url_id DESC
+		LIMIT ?`,
+		titleMatchWeight, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanHits(rows, terms, nil)
+}
+
+// SQLite has no full-text index here: the documents containing every term are read and ranked in Go like the in-memory
+// backend does, at most sqliteSearchScanLimit of them starting with the newest analyses
+func (r *sqlSearch) searchSQLite(userID int, terms []string, limit int) ([]models.SearchHit, error) {
+	where := "s.user_id = ?"
+	args := []interface{}{userID}
+	for _, term := range terms {
+		where += " AND (s.title LIKE ? OR s.url LIKE ? OR s.link_text LIKE ? OR s.content LIKE ?)"
+		pattern := "%" + term + "%"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+	rows, err := r.db.Query(`
+		SELECT s.url_id, s.url, s.title, u.status, s.link_text, s.content, 0
+		FROM analysis_search s
+		JOIN urls u ON u.id = s.url_id
+		WHERE `+where+`
+		ORDER BY s.url_id DESC
+		LIMIT ?`, append(args, sqliteSearchScanLimit)...)
+	if err != nil {
+		return nil, err
+	}
+	pattern := termsPattern(terms)
+	hits, err := scanHits(rows, terms, func(fields map[string]string) (float64, bool) {
+		return scoreHit(pattern, terms, fields)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return bestHits(hits, limit), nil
+}
+
+// Read the rows of a search query (url_id, url, title, status, link_text, content, score) and highlight the terms.
+// A rank function replaces the score of the query and drops the rows it returns false for
+func scanHits(rows *sql.Rows, terms []string, rank func(fields map[string]string) (float64, bool)) ([]models.SearchHit, error) {
+	defer rows.Close()
+	hits := []models.SearchHit{}
+	for rows.Next() {
+		var hit models.SearchHit
+		var linkText, content string
+		if err := rows.Scan(&hit.AnalysisID, &hit.URL, &hit.Title, &hit.Status, &linkText, &content, &hit.Score); err != nil {
+			return nil, err
+		}
+		fields := map[string]string{"title": hit.Title, "url": hit.URL, "links": linkText, "content": content}
+		if rank != nil {
+			score, ok := rank(fields)
+			if !ok {
+				continue
+			}
+			hit.Score = score
+		}
+		hit.Highlights = highlightHit(terms, fields)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
@@ -0,0 +1,207 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+type sqlSnapshots struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func (r *sqlSnapshots) Create(analysisID int, result *utils.AnalysisResult) (int, error) {
+	snapshot := result.RunSnapshot()
+	hash := snapshot.Hash()
+	headersJSON, _ := json.Marshal(snapshot.Headers)
+	exchanges, bodies := result.Exchanges()
+	exchangesJSON, _ := json.Marshal(exchanges)
+	var harJSON []byte
+	if har := utils.BuildHAR(result); har != nil {
+		harJSON, _ = json.Marshal(har)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// An unchanged body only refreshes last_used_at, which keeps the blob away from the orphan cleanup
+	bodies[hash] = snapshot.Body
+	// Blobs go in hash order, two snapshots sharing bodies lock their rows in the same order and cannot deadlock
+	hashes := make([]string, 0, len(bodies))
+	for bodyHash := range bodies {
+		hashes = append(hashes, bodyHash)
+	}
+	sort.Strings(hashes)
+	for _, bodyHash := range hashes {
+		body := bodies[bodyHash]
+		compressed, err := utils.CompressSnapshotBody(body)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO snapshot_blobs (hash, body, size, compressed_size)
+			VALUES (?, ?, ?, ?)`+r.dialect.OnConflictUpdate("hash")+`last_used_at = CURRENT_TIMESTAMP`,
+			bodyHash, compressed, len(body), len(compressed))
+		if err != nil {
+			return 0, err
+		}
+	}
+	snapshotID, err := r.dialect.InsertID(tx, `
+		INSERT INTO snapshots (url_id, blob_hash, final_url, status_code, content_type, headers, exchanges, har, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		analysisID, hash, snapshot.FinalURL, snapshot.StatusCode, snapshot.Headers.Get("Content-Type"), headersJSON, exchangesJSON, harJSON, snapshot.FetchedAt)
+	if err != nil {
+		return 0, err
+	}
+	for _, bodyHash := range hashes {
+		if bodyHash == hash {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO snapshot_exchange_blobs (snapshot_id, blob_hash) VALUES (?, ?)", snapshotID, bodyHash); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int(snapshotID), nil
+}
+
+func (r *sqlSnapshots) List(analysisID, userID int) ([]models.Snapshot, error) {
+	rows, err := r.db.Query(`
+		SELECT s.id, s.url_id, s.blob_hash, s.final_url, s.status_code, s.content_type, b.size, b.compressed_size, NULL, s.fetched_at, NULL
+		FROM snapshots s
+		JOIN urls u ON u.id = s.url_id
+		JOIN snapshot_blobs b ON b.hash = s.blob_hash
+		WHERE s.url_id = ? AND u.user_id = ?
+		ORDER BY s.fetched_at DESC, s.id DESC`, analysisID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []models.Snapshot{}
+	for rows.Next() {
+		snapshot, _, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+func (r *sqlSnapshots) Get(analysisID, userID, snapshotID int, withBody bool) (*models.Snapshot, []byte, error) {
+	// The body is only read from the database when it is asked for
+	bodyColumn := "NULL"
+	if withBody {
+		bodyColumn = "b.body"
+	}
+	query, args := latestOrOne(`
+		SELECT s.id, s.url_id, s.blob_hash, s.final_url, s.status_code, s.content_type, b.size, b.compressed_size, s.headers, s.fetched_at, `+bodyColumn+`
+		FROM snapshots s
+		JOIN urls u ON u.id = s.url_id
+		JOIN snapshot_blobs b ON b.hash = s.blob_hash
+		WHERE s.url_id = ? AND u.user_id = ?`, analysisID, userID, snapshotID)
+
+	snapshot, compressed, err := scanSnapshot(r.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil || !withBody {
+		return snapshot, nil, err
+	}
+	body, err := utils.DecompressSnapshotBody(compressed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return snapshot, body, nil
+}
+
+func (r *sqlSnapshots) Export(analysisID, userID, snapshotID int) (*SnapshotExport, error) {
+	query, args := latestOrOne(`
+		SELECT s.id, s.exchanges, s.warc, s.har
+		FROM snapshots s
+		JOIN urls u ON u.id = s.url_id
+		WHERE s.url_id = ? AND u.user_id = ?`, analysisID, userID, snapshotID)
+
+	var export SnapshotExport
+	var exchangesJSON []byte
+	err := r.db.QueryRow(query, args...).Scan(&export.SnapshotID, &exchangesJSON, &export.WARC, &export.HAR)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(exchangesJSON) > 0 {
+		if err := json.Unmarshal(exchangesJSON, &export.Exchanges); err != nil {
+			return nil, err
+		}
+	}
+	return &export, nil
+}
+
+func (r *sqlSnapshots) Bodies(hashes []string) (map[string][]byte, error) {
+	bodies := map[string][]byte{}
+	if len(hashes) == 0 {
+		return bodies, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(hashes)), ", ")
+	args := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		args[i] = hash
+	}
+
+	rows, err := r.db.Query("SELECT hash, body FROM snapshot_blobs WHERE hash IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hash string
+		var compressed []byte
+		if err := rows.Scan(&hash, &compressed); err != nil {
+			return nil, err
+		}
+		body, err := utils.DecompressSnapshotBody(compressed)
+		if err != nil {
+			return nil, err
+		}
+		bodies[hash] = body
+	}
+	return bodies, rows.Err()
+}
+
+// Narrow a snapshot query on an analysis and user to one snapshot, or to the newest one when snapshotID is 0
+func latestOrOne(query string, analysisID, userID, snapshotID int) (string, []interface{}) {
+	args := []interface{}{analysisID, userID}
+	if snapshotID == 0 {
+		return query + " ORDER BY s.fetched_at DESC, s.id DESC LIMIT 1", args
+	}
+	return query + " AND s.id = ?", append(args, snapshotID)
+}
+
+// Scan a snapshot with its headers and compressed body, either of which may be selected as NULL
+func scanSnapshot(row interface{ Scan(...interface{}) error }) (*models.Snapshot, []byte, error) {
+	var snapshot models.Snapshot
+	var headersJSON, compressed []byte
+	err := row.Scan(&snapshot.ID, &snapshot.AnalysisID, &snapshot.Hash, &snapshot.FinalURL, &snapshot.StatusCode, &snapshot.ContentType,
+		&snapshot.Size, &snapshot.CompressedSize, &headersJSON, &snapshot.FetchedAt, &compressed)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(headersJSON) > 0 {
+		json.Unmarshal(headersJSON, &snapshot.Headers)
+	}
+	return &snapshot, compressed, nil
+}
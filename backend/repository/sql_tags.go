@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+type sqlTags struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func (r *sqlTags) List(userID int) ([]models.Tag, error) {
+	rows, err := r.db.Query(`
+		SELECT t.name, COUNT(at.url_id)
+		FROM tags t
+		LEFT JOIN analysis_tags at ON at.tag_id = t.id
+		WHERE t.user_id = ?
+		GROUP BY t.id, t.name
+		ORDER BY t.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []models.Tag{}
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.Name, &tag.Analyses); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+func (r *sqlTags) SetForAnalysis(userID, analysisID int, names []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	if err := tx.QueryRow("SELECT user_id FROM urls WHERE id = ?", analysisID).Scan(&ownerID); err != nil || ownerID != userID {
+		if err == nil || err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM analysis_tags WHERE url_id = ?", analysisID); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := tx.Exec(r.dialect.InsertIgnore("INSERT INTO tags (user_id, name) VALUES (?, ?)"), userID, name); err != nil {
+			return err
+		}
+		_, err := tx.Exec(r.dialect.InsertIgnore(`
+			INSERT INTO analysis_tags (url_id, tag_id)
+			SELECT u.id, t.id FROM urls u, tags t WHERE u.id = ? AND t.user_id = ? AND t.name = ?`), analysisID, userID, name)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlTags) ForAnalyses(analysisIDs []int) (map[int][]string, error) {
+	tags := map[int][]string{}
+	if len(analysisIDs) == 0 {
+		return tags, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(analysisIDs)), ", ")
+	args := make([]interface{}, len(analysisIDs))
+	for i, id := range analysisIDs {
+		args[i] = id
+	}
+
+	rows, err := r.db.Query(`
+		SELECT at.url_id, t.name
+		FROM analysis_tags at
+		JOIN tags t ON t.id = at.tag_id
+		WHERE at.url_id IN (`+placeholders+`)
+		ORDER BY t.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var analysisID int
+		var name string
+		if err := rows.Scan(&analysisID, &name); err != nil {
+			return nil, err
+		}
+		tags[analysisID] = append(tags[analysisID], name)
+	}
+	return tags, rows.Err()
+}
+
+func (r *sqlTags) Rename(userID int, name, newName string) error {
+	res, err := r.db.Exec("UPDATE tags SET name = ? WHERE user_id = ? AND name = ?", newName, userID, name)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return ErrDuplicate
+		}
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 && name != newName {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sqlTags) Delete(userID int, name string) error {
+	// The foreign key removes the tag from the analyses
+	res, err := r.db.Exec("DELETE FROM tags WHERE user_id = ? AND name = ?", userID, name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
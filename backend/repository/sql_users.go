@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/kiwiscode/go-react-crawler/db"
+	"github.com/kiwiscode/go-react-crawler/models"
+)
+
+// The repositories on a MySQL, PostgreSQL or SQLite database. Queries are written for all three with ? placeholders,
+// the few that differ ask the dialect
+func NewSQL(conn *sql.DB, dialect db.Dialect) *Repositories {
+	return &Repositories{
+		Users:     &sqlUsers{db: conn, dialect: dialect},
+		Analyses:  &sqlAnalyses{db: conn, dialect: dialect},
+		Links:     &sqlLinks{db: conn},
+		Search:    &sqlSearch{db: conn, dialect: dialect},
+		Projects:  &sqlProjects{db: conn, dialect: dialect},
+		Tags:      &sqlTags{db: conn, dialect: dialect},
+		Runs:      &sqlRuns{db: conn, dialect: dialect},
+		Snapshots: &sqlSnapshots{db: conn, dialect: dialect},
+		Rules:     &sqlExtractionRules{db: conn, dialect: dialect},
+		Retention: &sqlRetention{db: conn, dialect: dialect},
+	}
+}
+
+// Whether err is the database refusing a row that repeats a unique key
+func isDuplicateEntry(err error) bool {
+	return db.IsDuplicate(err)
+}
+
+type sqlUsers struct {
+	db      *sql.DB
+	dialect db.Dialect
+}
+
+func (r *sqlUsers) Create(username, email, passwordHash string) (int, error) {
+	id, err := r.dialect.InsertID(r.db, "INSERT INTO users (username, email, password) VALUES (?, ?, ?)", username, email, passwordHash)
+	if err != nil {
+		if isDuplicateEntry(err) {
+			return 0, ErrDuplicate
+		}
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func (r *sqlUsers) FindByID(id int) (*models.User, error) {
+	return r.find("SELECT id, username, email, password, created_at, retention FROM users WHERE id = ?", id)
+}
+
+func (r *sqlUsers) FindByIdentifier(identifier string) (*models.User, error) {
+	return r.find("SELECT id, username, email, password, created_at, retention FROM users WHERE email = ? OR username = ?", identifier, identifier)
+}
+
+func (r *sqlUsers) find(query string, args ...interface{}) (*models.User, error) {
+	var user models.User
+	var retentionJSON []byte
+	err := r.db.QueryRow(query, args...).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &retentionJSON)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(retentionJSON) > 0 {
+		json.Unmarshal(retentionJSON, &user.Retention)
+	}
+	return &user, nil
+}
+
+func (r *sqlUsers) SetRetention(userID int, policy models.RetentionPolicy) error {
+	retentionJSON, _ := json.Marshal(policy)
+	res, err := r.db.Exec("UPDATE users SET retention = ? WHERE id = ?", retentionJSON, userID)
+	if err != nil {
+		return err
+	}
+	// An unchanged policy affects no row either, so a missing user is told apart with a lookup
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		if _, err := r.FindByID(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiwiscode/go-react-crawler/repository"
+)
+
+// Analyses per page of the listing when ?limit is not given, and the most a page can hold
+const (
+	defaultAnalysesPageSize = 25
+	maxAnalysesPageSize     = 200
+)
+
+// Statuses an analysis can have, for the ?status filter
+var analysisStatuses = []string{"queued", "running", "done", "error"}
+
+// One page of the user's analyses /analyses, sorted by ?sort (created_at by default) in ?order (asc or desc, desc by default).
+// ?cursor=<next_cursor of the previous page> continues the listing, the filters are described in parseAnalysisFilter
+func listAnalysesHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	page := repository.AnalysisPage{Sort: c.DefaultQuery("sort", "created_at"), Limit: defaultAnalysesPageSize, Cursor: c.Query("cursor")}
+	if !repository.IsSortColumn(page.Sort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot sort by %q", page.Sort)})
+		return
+	}
+	switch c.DefaultQuery("order", "desc") {
+	case "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "order must be asc or desc"})
+		return
+	}
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxAnalysesPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxAnalysesPageSize)})
+			return
+		}
+		page.Limit = limit
+	}
+
+	filter, err := parseAnalysisFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := repos.Analyses.ListPage(userID, filter, page)
+	if err != nil {
+		if err == repository.ErrInvalidCursor {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor, it must come from a listing with the same sort and order"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on URLs"})
+		return
+	}
+
+	if err := attachTags(result.Items); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on tags"})
+		return
+	}
+
+	var nextCursor *string
+	if result.NextCursor != "" {
+		nextCursor = &result.NextCursor
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result.Items, "next_cursor": nextCursor, "total": result.Total})
+}
+
+// Filters of the listing:
+//   - status: one or more comma-separated statuses
+//   - q: text contained in the URL or the title
+//   - created_from, created_to, updated_from, updated_to: RFC 3339 times or YYYY-MM-DD dates, a "to" date includes that whole day
+//   - html_version, has_login_form (true or false), technology
+//   - internal_links_min/max, external_links_min/max, inaccessible_links_min/max: inclusive link count ranges
+//   - project and tag, see parseProjectAndTags
+func parseAnalysisFilter(c *gin.Context) (repository.AnalysisFilter, error) {
+	filter := repository.AnalysisFilter{
+		Technology:  c.Query("technology"),
+		Search:      strings.TrimSpace(c.Query("q")),
+		HTMLVersion: c.Query("html_version"),
+	}
+
+	if statusParam := c.Query("status"); statusParam != "" {
+		for _, status := range strings.Split(statusParam, ",") {
+			status = strings.TrimSpace(status)
+			if !slices.Contains(analysisStatuses, status) {
+				return filter, fmt.Errorf("status must be one of %s", strings.Join(analysisStatuses, ", "))
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	dates := []struct {
+		param  string
+		target *time.Time
+		end    bool
+	}{
+		{"created_from", &filter.CreatedFrom, false},
+		{"created_to", &filter.CreatedTo, true},
+		{"updated_from", &filter.UpdatedFrom, false},
+		{"updated_to", &filter.UpdatedTo, true},
+	}
+	for _, date := range dates {
+		value := c.Query(date.param)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseListingTime(value, date.end)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 time or a YYYY-MM-DD date", date.param)
+		}
+		*date.target = parsed
+	}
+
+	if loginParam := c.Query("has_login_form"); loginParam != "" {
+		hasLoginForm, err := strconv.ParseBool(loginParam)
+		if err != nil {
+			return filter, fmt.Errorf("has_login_form must be true or false")
+		}
+		filter.HasLoginForm = &hasLoginForm
+	}
+
+	counts := []struct {
+		prefix string
+		target *repository.CountRange
+	}{
+		{"internal_links", &filter.InternalLinks},
+		{"external_links", &filter.ExternalLinks},
+		{"inaccessible_links", &filter.InaccessibleLinks},
+	}
+	for _, count := range counts {
+		for _, bound := range []struct {
+			param  string
+			target **int
+		}{
+			{count.prefix + "_min", &count.target.Min},
+			{count.prefix + "_max", &count.target.Max},
+		} {
+			value := c.Query(bound.param)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return filter, fmt.Errorf("%s must be a non-negative integer", bound.param)
+			}
+			*bound.target = &n
+		}
+	}
+
+	if err := parseProjectAndTags(c, &filter); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+// The filters on the organization of analyses, shared by the listings and the exports:
+//   - project: a project id, or none for the analyses outside projects
+//   - tag: one or more comma-separated tags the analyses all carry
+func parseProjectAndTags(c *gin.Context, filter *repository.AnalysisFilter) error {
+	if projectParam := c.Query("project"); projectParam != "" {
+		projectID := 0
+		if projectParam != "none" {
+			var err error
+			if projectID, err = strconv.Atoi(projectParam); err != nil || projectID < 1 {
+				return fmt.Errorf("project must be a project id or none")
+			}
+		}
+		filter.ProjectID = &projectID
+	}
+	if tagParam := c.Query("tag"); tagParam != "" {
+		for _, tag := range strings.Split(tagParam, ",") {
+			name, err := normalizeTag(tag)
+			if err != nil {
+				return err
+			}
+			if !slices.Contains(filter.Tags, name) {
+				filter.Tags = append(filter.Tags, name)
+			}
+		}
+	}
+	return nil
+}
+
+// An RFC 3339 time, or a YYYY-MM-DD date in the server's time zone like the stored timestamps. As the end of a range a date
+// is exclusive, so it becomes the start of the next day and the whole day is included
+func parseListingTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
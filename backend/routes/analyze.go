@@ -1,18 +1,17 @@
 package routes
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
+	"log"
 	"net/http"
 	"regexp"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kiwiscode/go-react-crawler/db"
 	auth "github.com/kiwiscode/go-react-crawler/middleware"
 	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
 	"github.com/kiwiscode/go-react-crawler/utils"
 )
 
@@ -23,6 +22,8 @@ type UrlReq struct {
 
 type Urls struct {
 	URLs []string `json:"urls"`
+	// Optional project of the new analyses, they get its default settings
+	ProjectID *int `json:"project_id"`
 }
 
 type BulkUrlReq struct {
@@ -32,6 +33,7 @@ type BulkUrlReq struct {
 
 func AnalyzeRoutes(r *gin.Engine) {
 	// Route declarations
+	r.GET("/analyses", auth.JWTAuthMiddleware(), listAnalysesHandler)
 	r.POST("/analyses/create", auth.JWTAuthMiddleware(), createAnalyses)
 	r.GET("/analyses/:id", auth.JWTAuthMiddleware(), getAnalysisDetailHandler)
 	r.DELETE("/analyses/:id", auth.JWTAuthMiddleware(), deleteAnalysisByIDHandler)
@@ -39,6 +41,7 @@ func AnalyzeRoutes(r *gin.Engine) {
 	r.POST("/analyses/running", auth.JWTAuthMiddleware(), runningAnalysisHandler)
 	r.POST("/analyses/result", auth.JWTAuthMiddleware(), saveAnalysisResultHandler)
 	r.POST("/analyses/:id/toggle_should_pause", auth.JWTAuthMiddleware(), togglePauseAnalysisHandler)
+	r.GET("/analyses/duplicates", auth.JWTAuthMiddleware(), duplicatesHandler)
 }
 
 // Colly rejects some URLs; I wrote this helper function because it helped understand the error better
@@ -61,6 +64,52 @@ func urlInExistURLs(existURLs []gin.H, url string) bool {
 	return false
 }
 
+// Store the analysis details that live in their own JSON columns (response metadata, security audit, technologies, resources, content, extracted fields, broken anchors, document metadata, rendered result, ...) for the given urls row
+func saveAnalysisDetails(id int, result *utils.AnalysisResult) error {
+	return repos.Analyses.SaveDetails(id, result)
+}
+
+// Keep the finished run of an analysis: its links and text for the queries across analyses, what was fetched, and the run
+// in the history with its outcome (done or error, see runStatus) and the time the analysis started. Only the step that ends
+// the queued → running → done/error chain records it, the steps before only update the urls row
+func recordAnalysisRun(id int, result *utils.AnalysisResult, status string, startedAt time.Time) error {
+	// The analysis is over once its result is here, storing it does not count towards the run's duration
+	finishedAt := time.Now()
+
+	// The links of the run as rows for the queries across analyses
+	if err := saveLinks(id, result); err != nil {
+		return err
+	}
+
+	// The text of the run for the search box
+	if err := saveSearchDocument(id, result); err != nil {
+		return err
+	}
+
+	// Keep what was fetched for this run, the requests too when the page got no response
+	var snapshotID int
+	if result.RunSnapshot() != nil {
+		var err error
+		if snapshotID, err = repos.Snapshots.Create(id, result); err != nil {
+			return err
+		}
+	}
+	return saveAnalysisRun(id, analysisRun{
+		Status:     status,
+		Result:     result,
+		SnapshotID: snapshotID,
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+	})
+}
+
+// Remove an analysis whose details could not be saved, so a retry creates it again instead of finding a half-written row
+func discardAnalysis(id int) {
+	if err := repos.Analyses.Delete(id); err != nil {
+		log.Printf("Failed to remove analysis %d after an incomplete save: %v", id, err)
+	}
+}
+
 // A route for creating one or multiple analyses /analyses/create
 func createAnalyses(c *gin.Context) {
 	// Set the req variable as type Urls
@@ -90,6 +139,21 @@ func createAnalyses(c *gin.Context) {
 	// Float64 → int
 	userID := int(userIDFloat)
 
+	// New analyses of a project are run with its renderer and extraction rules
+	var project *models.Project
+	var projectRules []utils.ExtractionRule
+	if req.ProjectID != nil {
+		var err error
+		if project, err = repos.Projects.Get(*req.ProjectID, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		if projectRules, err = repos.Rules.ListByIDs(userID, project.Settings.ExtractionRuleIDs); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on extraction rules"})
+			return
+		}
+	}
+
 	// The created URLs will be stored in a createdURLs variable, so a variable was created for this purpose
 	var createdURLs []gin.H
 	// The URLs transitioning from queued → running → done/error sometimes cause this route to restart, and since URLs already saved in the database don’t need to be created again, they should be tracked inside exist URLs
@@ -101,12 +165,24 @@ func createAnalyses(c *gin.Context) {
 	// A loop is created over the id array received from the request body
 	for _, url := range req.URLs {
 
+		// The same page written differently (case, default port, tracking parameters, ...) is the same analysis
+		normalizedURL, err := utils.NormalizeURLFromEnv(url)
+		if err != nil {
+			// An invalid URL fails on its own, the rest of the batch is still created
+			failedURLs = append(failedURLs, gin.H{
+				"url":          url,
+				"status":       "error",
+				"should_pause": false,
+				"error":        fmt.Sprintf("Invalid URL: %s", err),
+			})
+			continue
+		}
+
 		// We will store whether the active URL in the loop exists in the database in the variable existingID
-		var existingID int
 		// Check if the URL already exists for the user in the database
-		err := db.DB.QueryRow("SELECT id FROM urls WHERE user_id = ? AND url = ?", userID, url).Scan(&existingID)
+		existingID, err := repos.Analyses.FindIDByNormalizedURL(userID, normalizedURL)
 		if err != nil {
-			if err == sql.ErrNoRows {
+			if err == repository.ErrNotFound {
 				// No existing URL found, so it's safe to proceed with adding it
 			} else {
 				// Unexpected database error occurred
@@ -125,7 +201,7 @@ func createAnalyses(c *gin.Context) {
 
 
 		// Pass the active URL to the analyzeURL function from utils and perform HTML analysis.
-		result, err := utils.AnalyzeURL(url)
+		result, err := utils.AnalyzeURLWithOptions(url, utils.AnalyzeOptions{ExtractionRules: projectRules, Renderer: projectRenderer(project)})
 
 		// If analysis failed for this URL
 		if result.ErrorURL == url {
@@ -159,7 +235,9 @@ func createAnalyses(c *gin.Context) {
 			// Create a new URL record
 			newURL := models.URL{
 				UserID:                 userID,
+				ProjectID:              req.ProjectID,
 				URL:                    url,
+				NormalizedURL:          normalizedURL,
 				Status:                 "queued",
 				ShouldPause:            false,
 				Title:                  result.Title,
@@ -175,48 +253,44 @@ func createAnalyses(c *gin.Context) {
 				CreatedAt:              time.Now(),
 			}
 
-			// Prepare SQL insert statement for the URLs table
-			query := `
-        INSERT INTO urls (
-            user_id, url, status, should_pause, title, html_version, heading_counts, internal_links_count,
-            external_links_count, has_login_form, inaccessible_links_count, inaccessible_links,
-            internal_links, external_links, created_at
-        ) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-    `
-
-			// Convert complex fields to JSON strings for storage in JSON columns
-			headingCountsJSON, _ := json.Marshal(newURL.HeadingCounts)
-			inaccessibleLinksJSON, _ := json.Marshal(newURL.InaccessibleLinks)
-			internalLinksJSON, _ := json.Marshal(newURL.InternalLinks)
-			externalLinksJSON, _ := json.Marshal(newURL.ExternalLinks)
-
-			// Execute the insert query with URL data, including JSON fields
-			res, err := db.DB.Exec(query,
-				newURL.UserID,
-				newURL.URL,
-				newURL.Status,
-				newURL.ShouldPause,
-				newURL.Title,
-				newURL.HTMLVersion,
-				headingCountsJSON,
-				newURL.InternalLinksCount,
-				newURL.ExternalLinksCount,
-				newURL.HasLoginForm,
-				newURL.InaccessibleLinksCount,
-				inaccessibleLinksJSON,
-				internalLinksJSON,
-				externalLinksJSON,
-				newURL.CreatedAt,
-			)
-
+			// Insert the new URL record
+			insertedID, err := repos.Analyses.Create(&newURL)
+
+			// Another request created the same page in the meantime
+			if err == repository.ErrDuplicate {
+				if existingID, err := repos.Analyses.FindIDByNormalizedURL(userID, normalizedURL); err == nil {
+					existURLs = append(existURLs, gin.H{
+						"id":           existingID,
+						"url":          url,
+						"status":       "queued",
+						"should_pause": false,
+					})
+					continue
+				}
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+				return
+			}
 			// If insertion fails, respond with a 500 error and message
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save URL data"})
 				return
 			}
 
-			// Get the ID of the newly inserted URL and add it to the response list. This will be needed on the frontend to properly update the UI with new URLs
-			insertedID, _ := res.LastInsertId()
+			// The default extraction rules of the project stay attached for the next runs
+			if project != nil {
+				if err := repos.Rules.Attach(insertedID, userID, project.Settings.ExtractionRuleIDs); err != nil {
+					discardAnalysis(insertedID)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save URL data"})
+					return
+				}
+			}
+
+			// Save the response metadata and other detail columns for the new row
+			if err := saveAnalysisDetails(insertedID, result); err != nil {
+				discardAnalysis(insertedID)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save URL data"})
+				return
+			}
 
 			// Add the new URL info to the createdURLs slice for frontend use
 			createdURLs = append(createdURLs, gin.H{
@@ -264,67 +338,22 @@ func getAnalysisDetailHandler(c *gin.Context) {
 	}
 	userID := int(userIDFloat)
 
-	// Query to get the URL details by ID and userID
-	query := `
-        SELECT 
-            id, user_id, url, status, should_pause, title, html_version, heading_counts, 
-            internal_links_count, external_links_count, has_login_form, inaccessible_links_count, 
-            inaccessible_links, internal_links, external_links, created_at, updated_at
-        FROM urls 
-        WHERE id = ? AND user_id = ?
-    `
-
-	var url models.URL
-
-	row := db.DB.QueryRow(query, id, userID)
-	var headingCountsJSON, inaccessibleLinksJSON, internalLinksJSON, externalLinksJSON []byte
-
-	err = row.Scan(
-		&url.ID,
-		&url.UserID,
-		&url.URL,
-		&url.Status,
-		&url.ShouldPause,
-		&url.Title,
-		&url.HTMLVersion,
-		&headingCountsJSON,
-		&url.InternalLinksCount,
-		&url.ExternalLinksCount,
-		&url.HasLoginForm,
-		&url.InaccessibleLinksCount,
-		&inaccessibleLinksJSON,
-		&internalLinksJSON,
-		&externalLinksJSON,
-		&url.CreatedAt,
-		&url.UpdatedAt,
-	)
-
+	// Get the URL details by ID and userID
+	url, err := repos.Analyses.Get(id, userID)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
 			return
 		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
-
-	// Unmarshal JSON fields into Go structs
-	if err := json.Unmarshal(headingCountsJSON, &url.HeadingCounts); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse heading counts"})
-		return
-	}
-	if err := json.Unmarshal(inaccessibleLinksJSON, &url.InaccessibleLinks); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse inaccessible links"})
-		return
-	}
-	if err := json.Unmarshal(internalLinksJSON, &url.InternalLinks); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse internal links"})
-		return
-	}
-	if err := json.Unmarshal(externalLinksJSON, &url.ExternalLinks); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse external links"})
+	tags, err := repos.Tags.ForAnalyses([]int{id})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	url.Tags = tags[id]
 
 	// Return the URL analysis details as JSON
 	c.JSON(http.StatusOK, gin.H{
@@ -358,22 +387,20 @@ func deleteAnalysisByIDHandler(c *gin.Context) {
 	userID := int(userIDFloat)
 
 	// Check if URL with given id exists and get its owner user_id
-	var ownerID int
-	row := db.DB.QueryRow("SELECT user_id FROM urls WHERE id = ?", id)
-	if err := row.Scan(&ownerID); err != nil {
+	existing, err := repos.Analyses.Find(id)
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
 
 	// Verify that the logged-in user owns this URL
-	if ownerID != userID {
+	if existing.UserID != userID {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to delete this URL"})
 		return
 	}
 
 	// Delete the URL from the database
-	_, err = db.DB.Exec("DELETE FROM urls WHERE id = ?", id)
-	if err != nil {
+	if err := repos.Analyses.Delete(id); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete URL"})
 		return
 	}
@@ -415,17 +442,14 @@ func setAnalysisQueuedHandler(c *gin.Context) {
 	// A loop is created over the req array received from the request body
 	for _, id := range req.IDs {
 
-		// A variable was created to receive and assign the ownerID
-		var ownerID int
-		// Add the active URL here
-		var url string
 		// Query the database for user_id and url where id matches
-		row := db.DB.QueryRow("SELECT user_id, url FROM urls WHERE id = ?", id)
-		// Scan the result into ownerID and url variables
 		// If there's an error, skip to next iteration
-		if err := row.Scan(&ownerID, &url); err != nil {
+		existing, err := repos.Analyses.Find(id)
+		if err != nil {
 			continue
 		}
+		// The owner and the active URL
+		ownerID, url := existing.UserID, existing.URL
 
 		// Check if URL with given id exists and get its owner user_id
 		if ownerID != userID {
@@ -433,59 +457,34 @@ func setAnalysisQueuedHandler(c *gin.Context) {
 			return
 		}
 
-		// Pass the active URL to the analyzeURL function from utils and perform HTML analysis.
-		result, err := utils.AnalyzeURL(url)
+		// Load the extraction rules attached to this analysis, they are applied during the analysis
+		rules, err := repos.Rules.ForAnalysis(id)
+		if err != nil {
+			continue
+		}
+
+		// Pass the active URL to the analyzeURL function from utils and perform HTML analysis
+		result, err := utils.AnalyzeURLWithOptions(url, utils.AnalyzeOptions{ExtractionRules: rules, Renderer: analysisRenderer(existing)})
 		if err != nil {
 			// If analysis fails, update the URL status to "error" in the database and stop the process
-			_, _ = db.DB.Exec("UPDATE urls SET status = ? WHERE id = ?", "error", id)
+			_ = repos.Analyses.SetStatus(id, "error")
 			return
 		}
 
-		// Convert complex fields to JSON strings for storage in JSON columns
-		headingCountsJSON, _ := json.Marshal(result.HeadingCounts)
-		inaccessibleLinksJSON, _ := json.Marshal(result.InaccessibleLinks)
-		internalLinksJSON, _ := json.Marshal(result.InternalLinks)
-		externalLinksJSON, _ := json.Marshal(result.ExternalLinks)
-
-		// Execute the update query, including JSON fields
-		_, err = db.DB.Exec(`
-            UPDATE urls
-            SET 
-                status = ?, 
-                should_pause = ?,
-                title = ?, 
-                html_version = ?, 
-                heading_counts = ?, 
-                internal_links_count = ?, 
-                external_links_count = ?, 
-                has_login_form = ?, 
-                inaccessible_links_count = ?, 
-                inaccessible_links = ?, 
-                internal_links = ?, 
-                external_links = ?,
-                updated_at = ?
-            WHERE id = ?`,
-			"queued",
-			false,
-			result.Title,
-			result.HTMLVersion,
-			headingCountsJSON,
-			result.InternalLinksCount,
-			result.ExternalLinksCount,
-			result.HasLoginForm,
-			result.InaccessibleLinksCount,
-			inaccessibleLinksJSON,
-			internalLinksJSON,
-			externalLinksJSON,
-			time.Now(),
-			id,
-		)
+		// Store the result with the status queued and should_pause reset to false
+		shouldPause := false
+		err = repos.Analyses.SaveResult(id, "queued", &shouldPause, result)
 
 		// If there is an error, skip this iteration and continue with the next
 		if err != nil {
 			continue
 		}
 
+		// Save the response metadata and other detail columns
+		if err := saveAnalysisDetails(id, result); err != nil {
+			continue
+		}
+
 		// Add the id and current URL as 'url' to updatedURLs with status 'queued' and should_pause set to false
 		updatedURLs = append(updatedURLs, gin.H{
 			"id":           id,
@@ -537,17 +536,14 @@ func runningAnalysisHandler(c *gin.Context) {
 	// A loop is created over the req array received from the request body
 	for _, id := range req.IDs {
 
-		// A variable was created to receive and assign the ownerID
-		var ownerID int
-		// Add the active URL here
-		var url string
 		// Query the database for user_id and url where id matches
-		row := db.DB.QueryRow("SELECT user_id, url FROM urls WHERE id = ?", id)
-		// Scan the result into ownerID and url variables
 		// If there's an error, skip to next iteration
-		if err := row.Scan(&ownerID, &url); err != nil {
+		existing, err := repos.Analyses.Find(id)
+		if err != nil {
 			continue
 		}
+		// The owner and the active URL
+		ownerID, url := existing.UserID, existing.URL
 
 
 		// Check if URL with given id exists and get its owner user_id
@@ -556,59 +552,33 @@ func runningAnalysisHandler(c *gin.Context) {
 			return
 		}
 
+		// Load the extraction rules attached to this analysis, they are applied during the analysis
+		rules, err := repos.Rules.ForAnalysis(id)
+		if err != nil {
+			continue
+		}
+
 		// Pass the active URL to the analyzeURL function from utils and perform HTML analysis
-		result, err := utils.AnalyzeURL(url)
+		result, err := utils.AnalyzeURLWithOptions(url, utils.AnalyzeOptions{ExtractionRules: rules, Renderer: analysisRenderer(existing)})
 		if err != nil {
 			// If analysis fails, update the URL status to "error" in the database and stop the process
-			_, _ = db.DB.Exec("UPDATE urls SET status = ? WHERE id = ?", "error", id)
+			_ = repos.Analyses.SetStatus(id, "error")
 			return
 		}
 
-		// Convert complex fields to JSON strings for storage in JSON columns
-		headingCountsJSON, _ := json.Marshal(result.HeadingCounts)
-		inaccessibleLinksJSON, _ := json.Marshal(result.InaccessibleLinks)
-		internalLinksJSON, _ := json.Marshal(result.InternalLinks)
-		externalLinksJSON, _ := json.Marshal(result.ExternalLinks)
-
-		// Execute the update query, including JSON fields
-		_, err = db.DB.Exec(`
-            UPDATE urls
-            SET 
-                status = ?, 
-               
-                title = ?, 
-                html_version = ?, 
-                heading_counts = ?, 
-                internal_links_count = ?, 
-                external_links_count = ?, 
-                has_login_form = ?, 
-                inaccessible_links_count = ?, 
-                inaccessible_links = ?, 
-                internal_links = ?, 
-                external_links = ?,
-                updated_at = ?
-            WHERE id = ?`,
-			"running",
-			
-			result.Title,
-			result.HTMLVersion,
-			headingCountsJSON,
-			result.InternalLinksCount,
-			result.ExternalLinksCount,
-			result.HasLoginForm,
-			result.InaccessibleLinksCount,
-			inaccessibleLinksJSON,
-			internalLinksJSON,
-			externalLinksJSON,
-			time.Now(),
-			id,
-		)
+		// Store the result with the status running, should_pause is left as the user set it
+		err = repos.Analyses.SaveResult(id, "running", nil, result)
 
 		// If there is an error, skip this iteration and continue with the next
 		if err != nil {
 			continue
 		}
 
+		// Save the response metadata and other detail columns
+		if err := saveAnalysisDetails(id, result); err != nil {
+			continue
+		}
+
 		// Add the id and current URL as 'url' to updatedURLs with status 'running' and should_pause set to false
 		updatedURLs = append(updatedURLs, gin.H{
 			"id":           id,
@@ -660,18 +630,14 @@ func saveAnalysisResultHandler(c *gin.Context) {
 	// A loop is created over the req array received from the request body
 	for _, id := range req.IDs {
 
-		// A variable was created to receive and assign the ownerID
-		var ownerID int
-		// Add the active URL here
-		var url string
-		// During the queued → running stage, check if the user toggled the should_pause flag to 0 or 1 and assign it to the variable
-		var shouldPause bool
 		// Retrieves the user_id (owner), URL, and should_pause value for the given ID from the database
-		row := db.DB.QueryRow("SELECT user_id, url, should_pause FROM urls WHERE id = ?", id)
-		if err := row.Scan(&ownerID, &url, &shouldPause); err != nil {
+		existing, err := repos.Analyses.Find(id)
+		if err != nil {
 			//  If the record is not found or a query error occurs, skip processing this ID and continue with the next
 			continue
 		}
+		// During the queued → running stage, check if the user toggled the should_pause flag to 0 or 1 and assign it to the variable
+		ownerID, url, shouldPause := existing.UserID, existing.URL, existing.ShouldPause
 
 		// Check if URL with given id exists and get its owner user_id
 		if ownerID != userID {
@@ -679,20 +645,24 @@ func saveAnalysisResultHandler(c *gin.Context) {
 			return
 		}
 
+		// Load the extraction rules attached to this analysis, they are applied during the analysis
+		rules, err := repos.Rules.ForAnalysis(id)
+		if err != nil {
+			continue
+		}
+
 		// Pass the active URL to the analyzeURL function from utils and perform HTML analysis
-		result, err := utils.AnalyzeURL(url)
+		startedAt := time.Now()
+		result, err := utils.AnalyzeURLWithOptions(url, utils.AnalyzeOptions{ExtractionRules: rules, Renderer: analysisRenderer(existing)})
 		if err != nil {
 			// If analysis fails, update the URL status to "error" in the database and stop the process
-			_, _ = db.DB.Exec("UPDATE urls SET status = ? WHERE id = ?", "error", id)
+			_ = repos.Analyses.SetStatus(id, "error")
+			if err := saveAnalysisRun(id, analysisRun{Status: "error", Error: err.Error(), StartedAt: startedAt, FinishedAt: time.Now()}); err != nil {
+				log.Printf("Failed to save the failed run of analysis %d: %v", id, err)
+			}
 			return
 		}
 
-		// Convert complex fields to JSON strings for storage in JSON columns
-		headingCountsJSON, _ := json.Marshal(result.HeadingCounts)
-		inaccessibleLinksJSON, _ := json.Marshal(result.InaccessibleLinks)
-		internalLinksJSON, _ := json.Marshal(result.InternalLinks)
-		externalLinksJSON, _ := json.Marshal(result.ExternalLinks)
-
 		// Since this is the final step, the analysis for this specific URL is normally considered complete. However, if the user triggered a pause before the API call reached this point, we need to check and retain that state
 		// If the shouldPause field is true (1), then set the status to queued
 		status := "done"
@@ -718,45 +688,31 @@ func saveAnalysisResultHandler(c *gin.Context) {
 
 
 
-		// Execute the update query, including JSON fields
-		_, err = db.DB.Exec(`
-            UPDATE urls
-            SET 
-                status = ?, 
-                should_pause = ?,
-                title = ?, 
-                html_version = ?, 
-                heading_counts = ?, 
-                internal_links_count = ?, 
-                external_links_count = ?, 
-                has_login_form = ?, 
-                inaccessible_links_count = ?, 
-                inaccessible_links = ?, 
-                internal_links = ?, 
-                external_links = ?,
-                updated_at = ?
-            WHERE id = ?`,
-			status,
-			shouldPause,
-			result.Title,
-			result.HTMLVersion,
-			headingCountsJSON,
-			result.InternalLinksCount,
-			result.ExternalLinksCount,
-			result.HasLoginForm,
-			result.InaccessibleLinksCount,
-			inaccessibleLinksJSON,
-			internalLinksJSON,
-			externalLinksJSON,
-			time.Now(),
-			id,
-		)
+		// Store the result with the final status and pause flag
+		err = repos.Analyses.SaveResult(id, status, &shouldPause, result)
 
 		// If there is an error, skip this iteration and continue with the next
 		if err != nil {
 			continue
 		}
 
+		// Save the response metadata and other detail columns
+		if err := saveAnalysisDetails(id, result); err != nil {
+			continue
+		}
+
+		// The chain is over unless the user paused it, then it runs again from running and records its run then.
+		// A URL the frontend reported as failed is a failed run too
+		if status != "queued" {
+			runOutcome := runStatus(result)
+			if failedURL {
+				runOutcome = "error"
+			}
+			if err := recordAnalysisRun(id, result, runOutcome, startedAt); err != nil {
+				continue
+			}
+		}
+
 		// Add the id and current URL as 'url' to updatedURLs with status 'queued' and should_pause set to false.
 		// Also, store it in the result variable which will be used on the frontend for UI updates.
 		updatedURLs = append(updatedURLs, gin.H{
@@ -802,17 +758,14 @@ func togglePauseAnalysisHandler(c *gin.Context) {
 	}
 	userID := int(userIDFloat)
 
-	var url string
-	var ownerID int
-	var shouldPause bool
-	var status string
 	// Retrieve url record details (user_id, url, status, should_pause) by id from the database
-	row := db.DB.QueryRow("SELECT user_id, url,status, should_pause FROM urls WHERE id = ?", id)
-	// Scan query results into variables; if not found, return 404
-	if err := row.Scan(&ownerID, &url, &status, &shouldPause); err != nil {
+	existing, err := repos.Analyses.Find(id)
+	// If not found, return 404
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
 		return
 	}
+	ownerID, url, status, shouldPause := existing.UserID, existing.URL, existing.Status, existing.ShouldPause
 
 	// Check if the current user is the owner of the URL; if not, return 403 forbidden
 	if ownerID != userID {
@@ -823,8 +776,7 @@ func togglePauseAnalysisHandler(c *gin.Context) {
 	// Toggle the should_pause boolean value
 	newPauseValue := !shouldPause
 	// Update the database record with the new should_pause value
-	_, err = db.DB.Exec("UPDATE urls SET should_pause = ? WHERE id = ?", newPauseValue, id)
-	if err != nil {
+	if err := repos.Analyses.SetShouldPause(id, newPauseValue); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to toggle pause state"})
 		return
 	}
@@ -0,0 +1,203 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A small site to analyze: a page with a title, headings and one internal link
+func newTestSite(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!DOCTYPE html><html><head><title>Test page</title></head>
+			<body><h1>Welcome</h1><h2>Section</h2><p>Some text.</p><a href="/about">About</a></body></html>`)
+	})
+	mux.HandleFunc("/about", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<!DOCTYPE html><html><head><title>About</title></head><body>About us</body></html>`)
+	})
+	site := httptest.NewServer(mux)
+	t.Cleanup(site.Close)
+	return site
+}
+
+type createdAnalysis struct {
+	ID  int    `json:"id"`
+	URL string `json:"url"`
+}
+
+type createResponse struct {
+	Data       []createdAnalysis `json:"data"`
+	ExistURLs  []createdAnalysis `json:"existURLs"`
+	FailedURLs []gin.H           `json:"failedURLs"`
+}
+
+// Take analyses through the steps the frontend sends after creating them: queued, running and the result
+func runPipeline(t *testing.T, r http.Handler, token string, ids ...int) {
+	t.Helper()
+	for _, step := range []string{"queued", "running", "result"} {
+		if code := doJSON(t, r, http.MethodPost, "/analyses/"+step, token, gin.H{"ids": ids}, nil); code != http.StatusOK {
+			t.Fatalf("%s: status %d", step, code)
+		}
+	}
+}
+
+func TestCreateAndListAnalyses(t *testing.T) {
+	r := newTestRouter()
+	site := newTestSite(t)
+	token := registerUser(t, r, "alice")
+
+	var created createResponse
+	if code := doJSON(t, r, http.MethodPost, "/analyses/create", token, gin.H{"urls": []string{site.URL + "/"}}, &created); code != http.StatusOK {
+		t.Fatalf("create: status %d", code)
+	}
+	if len(created.Data) != 1 || created.Data[0].ID == 0 {
+		t.Fatalf("create: data %+v, want one new analysis", created.Data)
+	}
+
+	// The same page again is reported as existing, not created twice
+	var again createResponse
+	if code := doJSON(t, r, http.MethodPost, "/analyses/create", token, gin.H{"urls": []string{site.URL + "/"}}, &again); code != http.StatusOK {
+		t.Fatalf("create again: status %d", code)
+	}
+	if len(again.Data) != 0 || len(again.ExistURLs) != 1 || again.ExistURLs[0].ID != created.Data[0].ID {
+		t.Errorf("create again: data %+v, existURLs %+v, want only analysis %d as existing", again.Data, again.ExistURLs, created.Data[0].ID)
+	}
+
+	var list struct {
+		Data []struct {
+			ID                 int    `json:"id"`
+			Title              string `json:"title"`
+			Status             string `json:"status"`
+			InternalLinksCount int    `json:"internal_links_count"`
+		} `json:"data"`
+		Total int `json:"total"`
+	}
+	if code := doJSON(t, r, http.MethodGet, "/analyses", token, nil, &list); code != http.StatusOK {
+		t.Fatalf("list: status %d", code)
+	}
+	if list.Total != 1 || len(list.Data) != 1 {
+		t.Fatalf("list: total %d, data %+v, want one analysis", list.Total, list.Data)
+	}
+	if got := list.Data[0]; got.ID != created.Data[0].ID || got.Title != "Test page" || got.Status != "queued" || got.InternalLinksCount != 1 {
+		t.Errorf("list: got %+v, want analysis %d titled %q, queued, with 1 internal link", got, created.Data[0].ID, "Test page")
+	}
+
+	// Another user sees none of it
+	other := registerUser(t, r, "bob")
+	if code := doJSON(t, r, http.MethodGet, "/analyses", other, nil, &list); code != http.StatusOK || list.Total != 0 {
+		t.Errorf("list of another user: status %d, total %d, want no analyses", code, list.Total)
+	}
+}
+
+func TestCreateAnalysesReportsEachURL(t *testing.T) {
+	r := newTestRouter()
+	site := newTestSite(t)
+	token := registerUser(t, r, "alice")
+
+	// An invalid URL fails on its own and the same page with credentials in the URL is the analysis just created
+	withCredentials := strings.Replace(site.URL, "://", "://user:password@", 1) + "/"
+	urls := []string{site.URL + "/", "not a url", withCredentials}
+	var created createResponse
+	if code := doJSON(t, r, http.MethodPost, "/analyses/create", token, gin.H{"urls": urls}, &created); code != http.StatusOK {
+		t.Fatalf("create: status %d", code)
+	}
+	if len(created.Data) != 1 || created.Data[0].URL != site.URL+"/" {
+		t.Errorf("create: data %+v, want only %s", created.Data, site.URL+"/")
+	}
+	if len(created.FailedURLs) != 1 || created.FailedURLs[0]["url"] != "not a url" || created.FailedURLs[0]["error"] == nil {
+		t.Errorf("create: failedURLs %+v, want the invalid URL with its error", created.FailedURLs)
+	}
+	if len(created.ExistURLs) != 1 || created.ExistURLs[0].URL != withCredentials || len(created.Data) == 1 && created.ExistURLs[0].ID != created.Data[0].ID {
+		t.Errorf("create: existURLs %+v, want %s as the created analysis", created.ExistURLs, withCredentials)
+	}
+}
+
+func TestAnalysisRuns(t *testing.T) {
+	r := newTestRouter()
+	site := newTestSite(t)
+	token := registerUser(t, r, "alice")
+
+	var created createResponse
+	if code := doJSON(t, r, http.MethodPost, "/analyses/create", token, gin.H{"urls": []string{site.URL + "/"}}, &created); code != http.StatusOK || len(created.Data) != 1 {
+		t.Fatalf("create: status %d, data %+v", code, created.Data)
+	}
+	id := created.Data[0].ID
+	runPipeline(t, r, token, id)
+
+	type run struct {
+		ID         int             `json:"id"`
+		AnalysisID int             `json:"analysis_id"`
+		SnapshotID *int            `json:"snapshot_id"`
+		Status     string          `json:"status"`
+		StatusCode int             `json:"status_code"`
+		Result     json.RawMessage `json:"result"`
+	}
+	var runs struct {
+		Data       []run `json:"data"`
+		NextCursor *int  `json:"next_cursor"`
+	}
+	if code := doJSON(t, r, http.MethodGet, fmt.Sprintf("/analyses/%d/runs", id), token, nil, &runs); code != http.StatusOK {
+		t.Fatalf("runs: status %d", code)
+	}
+	if len(runs.Data) != 1 || runs.NextCursor != nil {
+		t.Fatalf("runs: data %+v, next cursor %v, want one run for the whole chain", runs.Data, runs.NextCursor)
+	}
+	first := runs.Data[0]
+	if first.AnalysisID != id || first.Status != "done" || first.StatusCode != http.StatusOK || first.SnapshotID == nil {
+		t.Errorf("runs: got %+v, want a done run of analysis %d with status code 200 and a snapshot", first, id)
+	}
+	if len(first.Result) != 0 {
+		t.Errorf("runs: the list carries the result of run %d", first.ID)
+	}
+
+	// The latest run and the run by id are the same, with the full result
+	for _, path := range []string{fmt.Sprintf("/analyses/%d/runs/latest", id), fmt.Sprintf("/analyses/%d/runs/%d", id, first.ID)} {
+		var one struct {
+			Data run `json:"data"`
+		}
+		if code := doJSON(t, r, http.MethodGet, path, token, nil, &one); code != http.StatusOK {
+			t.Fatalf("%s: status %d", path, code)
+		}
+		if one.Data.ID != first.ID || len(one.Data.Result) == 0 {
+			t.Errorf("%s: got run %d with %d bytes of result, want run %d with its result", path, one.Data.ID, len(one.Data.Result), first.ID)
+		}
+	}
+
+	// The snapshot of the run is stored with its body
+	var snapshot struct {
+		Data struct {
+			ID         int `json:"id"`
+			StatusCode int `json:"status_code"`
+		} `json:"data"`
+	}
+	if code := doJSON(t, r, http.MethodGet, fmt.Sprintf("/analyses/%d/snapshots/latest", id), token, nil, &snapshot); code != http.StatusOK || snapshot.Data.ID != *first.SnapshotID {
+		t.Errorf("latest snapshot: status %d, id %d, want snapshot %d", code, snapshot.Data.ID, *first.SnapshotID)
+	}
+
+	// Runs of other users' analyses and unknown runs are not found
+	other := registerUser(t, r, "bob")
+	tests := []struct {
+		name  string
+		path  string
+		token string
+	}{
+		{"list of another user", fmt.Sprintf("/analyses/%d/runs", id), other},
+		{"latest of another user", fmt.Sprintf("/analyses/%d/runs/latest", id), other},
+		{"unknown run", fmt.Sprintf("/analyses/%d/runs/%d", id, first.ID+1), token},
+		{"unknown analysis", fmt.Sprintf("/analyses/%d/runs", id+1), token},
+	}
+	for _, tt := range tests {
+		if code := doJSON(t, r, http.MethodGet, tt.path, tt.token, nil, nil); code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", tt.name, code, http.StatusNotFound)
+		}
+	}
+}
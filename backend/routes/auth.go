@@ -8,10 +8,8 @@ import (
 	// Import time for token expiration date settings
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	// Import token for token-based authentication
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/kiwiscode/go-react-crawler/db"
 
 	"github.com/gin-gonic/gin"
 	// Import bcrypt to hash the password
@@ -52,23 +50,14 @@ func registerHandler(c *gin.Context) {
 
 
 	// Insert a new user with three parameters: username, email, and password. Use the username and email from request body, and convert the password string to the hashed password
-	_, err = db.DB.Exec("INSERT INTO users (username, email, password) VALUES (?, ?, ?)", req.Username, req.Email, string(hashedPass))
+	// The ID of the newly created user is returned by the repository
+	userID, err := repos.Users.Create(req.Username, req.Email, string(hashedPass))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Username or email already exists"})
 		return
 	}
 
 
-	// Define userID and set its type to integer
-	var userID int64
-	// Find the row of the newly created user in the database using the email from the request body, and assign the ID to the userID variable
-	err = db.DB.QueryRow("SELECT id FROM users WHERE email = ?", req.Email).Scan(&userID)
-	if err != nil {
-    c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user ID"})
-    return
-	}
-
-
 
 	// Get the JWT_SECRET from the .env file.
 	secret := os.Getenv("JWT_SECRET")
@@ -116,23 +105,8 @@ func loginHandler(c *gin.Context) {
 		return
 	}
 
-	// Create a User structure
-	var user struct {
-		ID       int64
-		Username string
-		Email    string
-		Password string 
-	}
-
-
-	// Query the users table to find a user by email or username and scan the result into the user struct
-	err := db.DB.QueryRow(`
-		SELECT id, username, email, password
-		FROM users
-		WHERE email = ? OR username = ?
-	`, req.Identifier, req.Identifier).Scan(
-		&user.ID, &user.Username, &user.Email, &user.Password,
-	)
+	// Find a user by email or username
+	user, err := repos.Users.FindByIdentifier(req.Identifier)
 
 	// If unauthorized (i.e., email, username, or password mismatch), notify the client
 	if err != nil {
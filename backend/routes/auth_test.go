@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRegisterAndLogin(t *testing.T) {
+	r := newTestRouter()
+	registerUser(t, r, "alice")
+
+	// The username and the email are both taken now
+	for _, body := range []gin.H{
+		{"username": "alice", "email": "other@example.com", "password": "secret1"},
+		{"username": "other", "email": "alice@example.com", "password": "secret1"},
+	} {
+		if code := doJSON(t, r, http.MethodPost, "/register", "", body, nil); code != http.StatusBadRequest {
+			t.Errorf("register %v: status %d, want %d", body, code, http.StatusBadRequest)
+		}
+	}
+	if code := doJSON(t, r, http.MethodPost, "/register", "", gin.H{"username": "bob", "email": "bob@example.com", "password": "short"}, nil); code != http.StatusBadRequest {
+		t.Errorf("register with a short password: status %d, want %d", code, http.StatusBadRequest)
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		password   string
+		want       int
+	}{
+		{"username", "alice", "secret1", http.StatusOK},
+		{"email", "alice@example.com", "secret1", http.StatusOK},
+		{"wrong password", "alice", "secret2", http.StatusUnauthorized},
+		{"unknown user", "nobody", "secret1", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp struct {
+				Token string `json:"token"`
+			}
+			code := doJSON(t, r, http.MethodPost, "/login", "", gin.H{"identifier": tt.identifier, "password": tt.password}, &resp)
+			if code != tt.want {
+				t.Fatalf("login: status %d, want %d", code, tt.want)
+			}
+			if code != http.StatusOK {
+				return
+			}
+			// The token opens the routes behind the middleware
+			if code := doJSON(t, r, http.MethodGet, "/analyses", resp.Token, nil, nil); code != http.StatusOK {
+				t.Errorf("list with the login token: status %d, want %d", code, http.StatusOK)
+			}
+		})
+	}
+
+	if code := doJSON(t, r, http.MethodGet, "/analyses", "not-a-token", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("list with an invalid token: status %d, want %d", code, http.StatusUnauthorized)
+	}
+}
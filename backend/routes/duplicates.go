@@ -0,0 +1,131 @@
+package routes
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// Default similarity for near-duplicates, 0.95 allows 3 of the 64 SimHash bits to differ
+const defaultDuplicateSimilarity = 0.95
+
+// A page inside a duplicate group
+type duplicatePage struct {
+	ID       int    `json:"id"`
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Distance int    `json:"distance,omitempty"` // bits different from the first page of the cluster
+}
+
+// Lists near-duplicate clusters by content fingerprint, plus exact duplicate titles and meta descriptions /analyses/duplicates?similarity=0.95
+func duplicatesHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	// The similarity is a share of matching fingerprint bits, turn it into the number of bits allowed to differ
+	similarity := defaultDuplicateSimilarity
+	if value := c.Query("similarity"); value != "" {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed <= 0 || parsed > 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "similarity must be a number between 0 and 1"})
+			return
+		}
+		similarity = parsed
+	}
+	maxDistance := int(math.Floor((1 - similarity) * 64))
+
+	// Fetch every fingerprinted page of the user
+	urls, err := repos.Analyses.Fingerprinted(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on URLs"})
+		return
+	}
+
+	var pages []duplicatePage
+	var fingerprints []uint64
+	for _, url := range urls {
+		fingerprint, err := utils.ParseSimHash(url.ContentSimHash)
+		if err != nil {
+			// Skip values that were not written by SimHash
+			continue
+		}
+		pages = append(pages, duplicatePage{ID: url.ID, URL: url.URL, Title: url.Title})
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	// Near-duplicate clusters, every member gets its distance to the first page of its cluster
+	clusters := []gin.H{}
+	for _, indexes := range utils.ClusterSimHashes(fingerprints, maxDistance) {
+		members := []duplicatePage{}
+		for _, i := range indexes {
+			page := pages[i]
+			page.Distance = utils.HammingDistance(fingerprints[indexes[0]], fingerprints[i])
+			members = append(members, page)
+		}
+		clusters = append(clusters, gin.H{
+			"size":  len(members),
+			"pages": members,
+		})
+	}
+
+	// Exact duplicates of titles and meta descriptions
+	titles, err := exactDuplicates(userID, repository.SharedTitle)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on duplicate titles"})
+		return
+	}
+	descriptions, err := exactDuplicates(userID, repository.SharedMetaDescription)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on duplicate meta descriptions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"similarity":                  similarity,
+		"max_distance":                maxDistance,
+		"clusters":                    clusters,
+		"duplicate_titles":            titles,
+		"duplicate_meta_descriptions": descriptions,
+	})
+}
+
+// Group the user's pages that share the exact same non-empty title or meta description
+func exactDuplicates(userID int, column repository.SharedColumn) ([]gin.H, error) {
+	urls, err := repos.Analyses.SharingValue(userID, column)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []gin.H{}
+	var current string
+	var members []duplicatePage
+	flush := func() {
+		if len(members) > 1 {
+			groups = append(groups, gin.H{"value": current, "pages": members})
+		}
+	}
+	for _, url := range urls {
+		value := url.Title
+		if column == repository.SharedMetaDescription {
+			value = url.MetaDescription
+		}
+		if value != current {
+			flush()
+			current = value
+			members = nil
+		}
+		members = append(members, duplicatePage{ID: url.ID, URL: url.URL, Title: url.Title})
+	}
+	flush()
+	return groups, nil
+}
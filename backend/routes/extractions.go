@@ -0,0 +1,363 @@
+package routes
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// Request structures
+type ExtractionRuleReq struct {
+	Name         string `json:"name" binding:"required"`
+	SelectorType string `json:"selector_type" binding:"required"`
+	Selector     string `json:"selector" binding:"required"`
+	Attribute    string `json:"attribute"`
+	Multiple     bool   `json:"multiple"`
+}
+
+type RuleIDsReq struct {
+	RuleIDs []int `json:"rule_ids"`
+}
+
+func ExtractionRoutes(r *gin.Engine) {
+	// Route declarations
+	r.GET("/extraction_rules", auth.JWTAuthMiddleware(), listExtractionRulesHandler)
+	r.POST("/extraction_rules", auth.JWTAuthMiddleware(), createExtractionRuleHandler)
+	r.DELETE("/extraction_rules/:id", auth.JWTAuthMiddleware(), deleteExtractionRuleHandler)
+	r.PUT("/analyses/:id/extraction_rules", auth.JWTAuthMiddleware(), setAnalysisExtractionRulesHandler)
+	r.GET("/analyses/:id/extractions", auth.JWTAuthMiddleware(), getAnalysisExtractionsHandler)
+	r.GET("/extractions/export", auth.JWTAuthMiddleware(), exportExtractionsHandler)
+}
+
+// List the extraction rules of the user /extraction_rules
+func listExtractionRulesHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	rules, err := repos.Rules.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on extraction rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rules})
+}
+
+// Create a named CSS or XPath extraction rule /extraction_rules
+func createExtractionRuleHandler(c *gin.Context) {
+	var req ExtractionRuleReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	rule := utils.ExtractionRule{
+		Name:         strings.TrimSpace(req.Name),
+		SelectorType: strings.ToLower(req.SelectorType),
+		Selector:     req.Selector,
+		Attribute:    strings.TrimSpace(req.Attribute),
+		Multiple:     req.Multiple,
+	}
+
+	// Reject selectors that do not compile, otherwise the rule would silently extract nothing
+	if err := utils.ValidateExtractionRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	insertedID, err := repos.Rules.Create(userID, rule)
+	if err != nil {
+		if err == repository.ErrDuplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": "A rule with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save extraction rule"})
+		return
+	}
+
+	rule.ID = insertedID
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Extraction rule created",
+		"data":    rule,
+	})
+}
+
+// Delete an extraction rule, it is detached from every analysis as well /extraction_rules/:id
+func deleteExtractionRuleHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	if err := repos.Rules.Delete(id, userID); err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Extraction rule not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete extraction rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Extraction rule deleted successfully"})
+}
+
+// Replace the set of rules attached to an analysis, they are applied from the next run on /analyses/:id/extraction_rules
+func setAnalysisExtractionRulesHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	var req RuleIDsReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	// Verify that the logged-in user owns the analysis
+	existing, err := repos.Analyses.Find(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+	if existing.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not authorized to update this URL"})
+		return
+	}
+
+	// Only rules of the same user can be attached
+	owned, err := repos.Rules.ListByIDs(userID, req.RuleIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on extraction rules"})
+		return
+	}
+	for _, ruleID := range req.RuleIDs {
+		if !slices.ContainsFunc(owned, func(rule utils.ExtractionRule) bool { return rule.ID == ruleID }) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Extraction rule %d not found", ruleID)})
+			return
+		}
+	}
+
+	if err := repos.Rules.SetForAnalysis(id, userID, req.RuleIDs); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update extraction rules"})
+		return
+	}
+
+	rules, err := repos.Rules.ForAnalysis(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on extraction rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Extraction rules updated",
+		"data":    rules,
+	})
+}
+
+// Return the attached rules and the values extracted by the last run /analyses/:id/extractions
+func getAnalysisExtractionsHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	analysis, err := repos.Analyses.Get(id, userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	extracted := map[string][]string{}
+	if len(analysis.ExtractedData) > 0 {
+		if err := json.Unmarshal(analysis.ExtractedData, &extracted); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse extracted data"})
+			return
+		}
+	}
+
+	rules, err := repos.Rules.ForAnalysis(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on extraction rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":        id,
+		"url":       analysis.URL,
+		"rules":     rules,
+		"extracted": extracted,
+	})
+}
+
+// Export the extracted values of all the user's analyses as CSV (one row per value) or JSON /extractions/export?format=csv&rule=price,
+// ?project and ?tag narrow it down like the listings
+func exportExtractionsHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+	// Optional filter on a single rule name
+	ruleFilter := c.Query("rule")
+
+	// Optional ?project and ?tag filters, the analyses they keep are looked up first
+	var filter repository.AnalysisFilter
+	if err := parseProjectAndTags(c, &filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var kept map[int]bool
+	if filter.ProjectID != nil || len(filter.Tags) > 0 {
+		urls, err := repos.Analyses.ListByUser(userID, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on URLs"})
+			return
+		}
+		kept = map[int]bool{}
+		for _, url := range urls {
+			kept[url.ID] = true
+		}
+	}
+
+	extractions, err := repos.Rules.Extractions(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on URLs"})
+		return
+	}
+
+	type pageExtraction struct {
+		ID        int                 `json:"id"`
+		URL       string              `json:"url"`
+		Extracted map[string][]string `json:"extracted"`
+	}
+	pages := []pageExtraction{}
+	for _, extraction := range extractions {
+		if kept != nil && !kept[extraction.ID] {
+			continue
+		}
+		page := pageExtraction{ID: extraction.ID, URL: extraction.URL}
+		if err := json.Unmarshal(extraction.ExtractedData, &page.Extracted); err != nil || page.Extracted == nil {
+			continue
+		}
+		if ruleFilter != "" {
+			values, ok := page.Extracted[ruleFilter]
+			if !ok {
+				continue
+			}
+			page.Extracted = map[string][]string{ruleFilter: values}
+		}
+		pages = append(pages, page)
+	}
+
+	if format == "json" {
+		c.Header("Content-Disposition", `attachment; filename="extractions.json"`)
+		c.JSON(http.StatusOK, gin.H{"data": pages})
+		return
+	}
+
+	// CSV: one line per extracted value, rule names in a stable order
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="extractions.csv"`)
+	c.Status(http.StatusOK)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"analysis_id", "url", "rule", "value"})
+	for _, page := range pages {
+		names := make([]string, 0, len(page.Extracted))
+		for name := range page.Extracted {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			for _, value := range page.Extracted[name] {
+				writer.Write([]string{strconv.Itoa(page.ID), csvCell(page.URL), csvCell(name), csvCell(value)})
+			}
+		}
+	}
+	writer.Flush()
+}
+
+// A CSV cell that spreadsheets show as text. Values come from scraped pages, one starting with = + - @ or a tab or
+// carriage return would be run as a formula, so it gets a leading quote
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
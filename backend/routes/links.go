@@ -0,0 +1,215 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// Links per page of the link lists when ?limit is not given, and the most a page can hold
+const (
+	defaultLinksPageSize = 100
+	maxLinksPageSize     = 1000
+)
+
+func LinkRoutes(r *gin.Engine) {
+	// Route declarations
+	r.GET("/analyses/:id/links", auth.JWTAuthMiddleware(), listOutboundLinksHandler)
+	r.GET("/links/inbound", auth.JWTAuthMiddleware(), listInboundLinksHandler)
+	r.GET("/links/domains", auth.JWTAuthMiddleware(), listLinkDomainsHandler)
+}
+
+// Replace the links of an analysis with the ones of its latest run. Invalid hrefs (inaccessible links) are broken, so are links
+// whose target answered with an error status or not at all, and links whose fragment is missing on the target document.
+// Targets that answered below 400 are ok, links the analysis did not request stay unchecked
+func saveLinks(urlID int, result *utils.AnalysisResult) error {
+	brokenAnchors := map[string]string{}
+	for _, anchor := range result.BrokenAnchors {
+		brokenAnchors[anchor.URL] = anchor.Reason
+	}
+
+	var links []models.Link
+	add := func(kind string, details []utils.LinkDetail) {
+		for _, detail := range details {
+			link := models.Link{Kind: kind, TargetURL: detail.URL, AnchorText: detail.Text, Rel: utils.TruncateRunes(detail.Rel, 255), CheckStatus: "unchecked"}
+			if kind == "inaccessible" {
+				link.CheckStatus, link.CheckError = "broken", "invalid_url"
+			} else {
+				link.TargetDomain = linkDomain(detail.URL)
+				switch {
+				case detail.CheckError != "":
+					link.CheckStatus, link.CheckError = "broken", "request_failed"
+				case detail.StatusCode >= 400:
+					link.CheckStatus, link.CheckError = "broken", "http_"+strconv.Itoa(detail.StatusCode)
+				case detail.StatusCode > 0:
+					link.CheckStatus = "ok"
+				}
+				// Broken anchors are reported under the href with its fragment, which URL has lost
+				if reason, ok := brokenAnchors[detail.ResolvedURL()]; ok {
+					link.CheckStatus, link.CheckError = "broken", reason
+				}
+			}
+			links = append(links, link)
+		}
+	}
+	add("internal", result.InternalLinks)
+	add("external", result.ExternalLinks)
+	add("inaccessible", result.InaccessibleLinks)
+
+	return repos.Links.Replace(urlID, links)
+}
+
+// Lowercased host of a link, empty for relative or unparsable URLs
+func linkDomain(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return utils.TruncateRunes(strings.ToLower(parsed.Hostname()), 255)
+}
+
+// Links found on one analysis /analyses/:id/links, filtered by ?kind (internal, external, inaccessible), ?status (unchecked, ok, broken)
+// and ?domain. Paged like the run history with ?limit and ?before
+func listOutboundLinksHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	// Make sure the analysis belongs to the user, so an unknown analysis is a 404 and not an empty list
+	if existing, err := repos.Analyses.Find(id); err != nil || existing.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+
+	listLinks(c, repository.LinkFilter{UserID: userID, AnalysisID: id})
+}
+
+// Links from the user's analyses to a URL /links/inbound?url=..., answers "which of my pages link to this URL?".
+// The URL is matched exactly, with ?kind and ?status filters and paging like the outbound list
+func listInboundLinksHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	target := strings.TrimSpace(c.Query("url"))
+	if target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url parameter is required"})
+		return
+	}
+
+	listLinks(c, repository.LinkFilter{UserID: userID, TargetURL: target})
+}
+
+// Write one page of the links matching filter plus the filters of the query string
+func listLinks(c *gin.Context, filter repository.LinkFilter) {
+	if !linkFilters(c, &filter) {
+		return
+	}
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err := strconv.ParseInt(beforeParam, 10, 64)
+		if err != nil || before < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before parameter"})
+			return
+		}
+		filter.Before = before
+	}
+	// One extra row tells whether there is another page
+	limit := filter.Limit
+	filter.Limit++
+
+	links, err := repos.Links.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on links"})
+		return
+	}
+
+	var nextCursor *int64
+	if len(links) > limit {
+		links = links[:limit]
+		nextCursor = &links[limit-1].ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": links, "next_cursor": nextCursor})
+}
+
+// Target domains of the user's links with how many links point there, how many of them are broken and from how many analyses
+// /links/domains. ?kind and ?status filter the links counted, ?domain picks one domain, ?limit caps the list (default 100)
+func listLinkDomainsHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	filter := repository.LinkFilter{UserID: userID}
+	if !linkFilters(c, &filter) {
+		return
+	}
+
+	domains, err := repos.Links.Domains(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on links"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": domains})
+}
+
+// Read ?limit, ?kind, ?status and ?domain into filter. Writes the error response itself for invalid values
+func linkFilters(c *gin.Context, filter *repository.LinkFilter) bool {
+	filter.Limit = defaultLinksPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxLinksPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxLinksPageSize)})
+			return false
+		}
+		filter.Limit = limit
+	}
+	if kind := c.Query("kind"); kind != "" {
+		if kind != "internal" && kind != "external" && kind != "inaccessible" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be internal, external or inaccessible"})
+			return false
+		}
+		filter.Kind = kind
+	}
+	if status := c.Query("status"); status != "" {
+		if status != "unchecked" && status != "ok" && status != "broken" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be unchecked, ok or broken"})
+			return false
+		}
+		filter.Status = status
+	}
+	if domain := c.Query("domain"); domain != "" {
+		filter.Domain = strings.ToLower(domain)
+	}
+	return true
+}
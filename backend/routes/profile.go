@@ -1,14 +1,11 @@
 package routes
 
 import (
-	"database/sql"
-	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/kiwiscode/go-react-crawler/db"
 	auth "github.com/kiwiscode/go-react-crawler/middleware"
-	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
 )
 
 
@@ -39,18 +36,11 @@ func profileHandler(c *gin.Context) {
 	userID := int(userIDFloat)
 
 
-	// Variable declarations
-	var id int
-	var username, email string
-
-
-	// Get user and set values to the variables
-	err := db.DB.QueryRow("SELECT id, username, email FROM users WHERE id = ?", userID).
-		Scan(&id, &username, &email)
-
+	// Get the user
+	user, err := repos.Users.FindByID(userID)
 	if err != nil {
 		// Check if user row exist
-		if err == sql.ErrNoRows {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			// Stop
 			return
@@ -60,47 +50,29 @@ func profileHandler(c *gin.Context) {
 	}
 
 
-	// Fetch the URLs related to the user from the URL table
-	rows, err := db.DB.Query("SELECT id, user_id, url, status, should_pause, title, html_version, internal_links_count, external_links_count, has_login_form, inaccessible_links_count, created_at, updated_at FROM urls WHERE user_id = ?", userID)
-    if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on URLs"})
-        return
-    }
-    defer rows.Close()
-
-
-	// Type declaration for URL in the models/url.go file
-	urls := []models.URL{}
-	    for rows.Next() {
-        var url models.URL
-        err := rows.Scan(
-            &url.ID,
-            &url.UserID,
-            &url.URL,
-            &url.Status,
-			&url.ShouldPause,
-            &url.Title,
-            &url.HTMLVersion,
-            &url.InternalLinksCount,
-            &url.ExternalLinksCount,
-            &url.HasLoginForm,
-            &url.InaccessibleLinksCount,
-            &url.CreatedAt,
-			&url.UpdatedAt,
-        )
-        if err != nil {
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "DB scan error"})
-            return
-        }
-        urls = append(urls, url)
-    }
+	// Fetch the URLs related to the user, the optional ?technology=WordPress filter keeps only the URLs where that technology was detected,
+	// ?project and ?tag those of a project or carrying tags
+	filter := repository.AnalysisFilter{Technology: c.Query("technology")}
+	if err := parseProjectAndTags(c, &filter); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	urls, err := repos.Analyses.ListByUser(userID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on URLs"})
+		return
+	}
+	if err := attachTags(urls); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on tags"})
+		return
+	}
 
 	// Send the answer to the client in JSON format
 	c.JSON(http.StatusOK, gin.H{
 		"user": gin.H{
-			"id":       id,
-			"username": username,
-			"email":    email,
+			"id":       user.ID,
+			"username": user.Username,
+			"email":    user.Email,
 		},
 		"urls": urls,
 	})
@@ -148,35 +120,13 @@ func deleteUserURLsHandler(c *gin.Context) {
 	// Float64 → int
 	userID := int(userIDFloat)
 
-	placeholders := ""
-	args := []interface{}{userID}
-
-
-	// Add a '?' placeholder for each ID in the req.IDs array coming from the JSON
-	for i, id := range req.IDs {
-		if i > 0 {
-			placeholders += ", "
-		}
-		placeholders += "?"
-		args = append(args, id)
-	}
-
-	// Query logic => DELETE FROM urls WHERE user_id = ? AND id IN (?, ?, ?)
-	query := fmt.Sprintf("DELETE FROM urls WHERE user_id = ? AND id IN (%s)", placeholders)
-	// Execute the query and assign the variables for values and error handling
-	result, err := db.DB.Exec(query, args...)
+	// Delete only the user's own URLs among the IDs
+	rowsAffected, err := repos.Analyses.DeleteForUser(userID, req.IDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on deleting URLs"})
 		return
 	}
 
-	// The number of affected (deleted) rows can be checked here from the table
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching rows affected"})
-		return
-	}
-
 	
 	// Send a JSON response with status OK (200) to the client and assign the message along with the number of affected rows to variables
 	c.JSON(http.StatusOK, gin.H{
@@ -0,0 +1,309 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// Request structures
+type ProjectReq struct {
+	Name        string                 `json:"name" binding:"required"`
+	Description string                 `json:"description"`
+	Settings    models.ProjectSettings `json:"settings"`
+}
+
+type MoveAnalysesReq struct {
+	AnalysisIDs []int `json:"analysis_ids"`
+	// Project to move the analyses to, null takes them out of their project
+	ProjectID *int `json:"project_id"`
+}
+
+// Longest project name, the size of the column
+const maxProjectNameLength = 100
+
+func ProjectRoutes(r *gin.Engine) {
+	// Route declarations
+	r.GET("/projects", auth.JWTAuthMiddleware(), listProjectsHandler)
+	r.POST("/projects", auth.JWTAuthMiddleware(), createProjectHandler)
+	r.GET("/projects/:id", auth.JWTAuthMiddleware(), getProjectHandler)
+	r.PUT("/projects/:id", auth.JWTAuthMiddleware(), updateProjectHandler)
+	r.DELETE("/projects/:id", auth.JWTAuthMiddleware(), deleteProjectHandler)
+	r.POST("/analyses/move", auth.JWTAuthMiddleware(), moveAnalysesHandler)
+}
+
+// The renderer of a project's analyses, the server's RENDERER when there is no project or it does not choose one
+func projectRenderer(project *models.Project) utils.Renderer {
+	if project == nil || project.Settings.Renderer == "" {
+		return utils.RendererFromEnv()
+	}
+	return utils.RendererByName(project.Settings.Renderer)
+}
+
+// The renderer of a run of an analysis, from the settings of its project
+func analysisRenderer(url *models.URL) utils.Renderer {
+	if url.ProjectID != nil {
+		if project, err := repos.Projects.Get(*url.ProjectID, url.UserID); err == nil {
+			return projectRenderer(project)
+		}
+	}
+	return projectRenderer(nil)
+}
+
+// Check a project request and turn it into the project to store
+func projectFromRequest(req ProjectReq, userID int) (*models.Project, error) {
+	project := &models.Project{
+		UserID:      userID,
+		Name:        strings.TrimSpace(req.Name),
+		Description: strings.TrimSpace(req.Description),
+		Settings:    req.Settings,
+	}
+	if project.Name == "" || utf8.RuneCountInString(project.Name) > maxProjectNameLength {
+		return nil, fmt.Errorf("name must be between 1 and %d characters", maxProjectNameLength)
+	}
+	project.Settings.Renderer = strings.ToLower(project.Settings.Renderer)
+	if r := project.Settings.Renderer; r != "" && r != utils.RendererStatic && r != utils.RendererCDP {
+		return nil, fmt.Errorf("settings.renderer must be %s or %s", utils.RendererStatic, utils.RendererCDP)
+	}
+	if retention := project.Settings.Retention; retention != nil {
+		if err := validateRetention(*retention); err != nil {
+			return nil, fmt.Errorf("settings.retention: %v", err)
+		}
+	}
+	// The default extraction rules have to be the user's own
+	slices.Sort(project.Settings.ExtractionRuleIDs)
+	project.Settings.ExtractionRuleIDs = slices.Compact(project.Settings.ExtractionRuleIDs)
+	if ids := project.Settings.ExtractionRuleIDs; len(ids) > 0 {
+		rules, err := repos.Rules.ListByIDs(userID, ids)
+		if err != nil {
+			return nil, err
+		}
+		if len(rules) != len(ids) {
+			return nil, fmt.Errorf("settings.extraction_rule_ids contains a rule that does not exist")
+		}
+	}
+	return project, nil
+}
+
+// List the user's projects with their number of analyses /projects
+func listProjectsHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	projects, err := repos.Projects.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": projects})
+}
+
+// Create a project with a name, a description and the default settings of its analyses /projects
+func createProjectHandler(c *gin.Context) {
+	var req ProjectReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	project, err := projectFromRequest(req, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id, err := repos.Projects.Create(project)
+	if err != nil {
+		if err == repository.ErrDuplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": "A project with this name already exists"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+		return
+	}
+
+	created, err := repos.Projects.Get(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on projects"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": created})
+}
+
+// One of the user's projects /projects/:id
+func getProjectHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	project, err := repos.Projects.Get(id, userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on projects"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": project})
+}
+
+// Replace the name, description and settings of a project /projects/:id. New settings apply to the analyses created afterwards,
+// except for the renderer which every run of the project's analyses reads
+func updateProjectHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	var req ProjectReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	project, err := projectFromRequest(req, userID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	project.ID = id
+
+	if err := repos.Projects.Update(project); err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		case repository.ErrDuplicate:
+			c.JSON(http.StatusConflict, gin.H{"error": "A project with this name already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+		}
+		return
+	}
+
+	updated, err := repos.Projects.Get(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on projects"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": updated})
+}
+
+// Delete a project /projects/:id, its analyses are kept without a project
+func deleteProjectHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	if err := repos.Projects.Delete(id, userID); err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Project deleted successfully"})
+}
+
+// Move analyses to a project, or out of their project with a null project_id /analyses/move
+func moveAnalysesHandler(c *gin.Context) {
+	var req MoveAnalysesReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// If there is no id at all, send an error
+	if len(req.AnalysisIDs) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No IDs provided"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	// Only the user's own analyses are moved, the others are skipped
+	moved, err := repos.Projects.MoveAnalyses(userID, req.AnalysisIDs, req.ProjectID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move analyses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"moved": moved, "project_id": req.ProjectID})
+}
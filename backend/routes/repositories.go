@@ -0,0 +1,11 @@
+package routes
+
+import "github.com/kiwiscode/go-react-crawler/repository"
+
+// All data is read and written through these, main sets the ones of the database and tests can set repository.NewMemory()
+var repos *repository.Repositories
+
+// Set the repositories the handlers use, before the routes are served
+func UseRepositories(r *repository.Repositories) {
+	repos = r
+}
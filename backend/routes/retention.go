@@ -0,0 +1,284 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
+)
+
+// Largest values a retention policy accepts
+const (
+	maxRetentionRuns = 100000
+	maxRetentionDays = 36500
+)
+
+// Janitor defaults: a pass every hour, rows deleted 500 at a time with a short pause in between so other queries get through
+const (
+	defaultJanitorInterval  = time.Hour
+	defaultJanitorBatchSize = 500
+	janitorBatchPause       = 50 * time.Millisecond
+)
+
+// Name of the database lock held during a janitor pass, so only one instance of the server prunes at a time
+const janitorLockName = "go-react-crawler.retention"
+
+// What one janitor pass removed
+type janitorReport struct {
+	Runs         int64
+	Snapshots    int64
+	Blobs        int64
+	OrphanLinks  int64
+	AnalysesSeen int
+}
+
+func RetentionRoutes(r *gin.Engine) {
+	// Route declarations
+	r.GET("/profile/retention", auth.JWTAuthMiddleware(), getRetentionHandler)
+	r.PUT("/profile/retention", auth.JWTAuthMiddleware(), updateRetentionHandler)
+}
+
+// The server default from RETENTION_KEEP_RUNS and RETENTION_KEEP_DAYS, empty keeps everything. SNAPSHOT_MAX_PER_ANALYSIS and
+// SNAPSHOT_RETENTION_DAYS, which pruned snapshots before there were policies, stand in for them when they are not set
+func defaultRetention() models.RetentionPolicy {
+	return models.RetentionPolicy{
+		KeepRuns: retentionSetting("RETENTION_KEEP_RUNS", "SNAPSHOT_MAX_PER_ANALYSIS"),
+		KeepDays: retentionSetting("RETENTION_KEEP_DAYS", "SNAPSHOT_RETENTION_DAYS"),
+	}
+}
+
+// The first of the variables that holds a number of 0 or more, nil when none does
+func retentionSetting(names ...string) *int {
+	for _, name := range names {
+		if value, err := strconv.Atoi(os.Getenv(name)); err == nil && value >= 0 {
+			return &value
+		}
+	}
+	return nil
+}
+
+// The policy that applies to an analysis: every field comes from the most specific level that sets it, the project
+// before the user before the server default. The result has both fields set
+func effectiveRetention(project *models.RetentionPolicy, user models.RetentionPolicy) models.RetentionPolicy {
+	levels := []models.RetentionPolicy{defaultRetention(), user}
+	if project != nil {
+		levels = append(levels, *project)
+	}
+	zero := 0
+	effective := models.RetentionPolicy{KeepRuns: &zero, KeepDays: &zero}
+	for _, level := range levels {
+		if level.KeepRuns != nil {
+			effective.KeepRuns = level.KeepRuns
+		}
+		if level.KeepDays != nil {
+			effective.KeepDays = level.KeepDays
+		}
+	}
+	return effective
+}
+
+// Check the values of a policy given by a user or a project
+func validateRetention(policy models.RetentionPolicy) error {
+	if runs := policy.KeepRuns; runs != nil && (*runs < 0 || *runs > maxRetentionRuns) {
+		return fmt.Errorf("keep_runs must be between 0 and %d", maxRetentionRuns)
+	}
+	if days := policy.KeepDays; days != nil && (*days < 0 || *days > maxRetentionDays) {
+		return fmt.Errorf("keep_days must be between 0 and %d", maxRetentionDays)
+	}
+	return nil
+}
+
+// The user's retention policy with the server default and the policy that results /profile/retention.
+// Projects can override it in their settings
+func getRetentionHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	user, err := repos.Users.FindByID(userID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": retentionResponse(user.Retention)})
+}
+
+// Replace the user's retention policy /profile/retention, a null field uses the server default and 0 keeps everything
+func updateRetentionHandler(c *gin.Context) {
+	var req models.RetentionPolicy
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if err := validateRetention(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	if err := repos.Users.SetRetention(userID, req); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": retentionResponse(req)})
+}
+
+func retentionResponse(policy models.RetentionPolicy) gin.H {
+	return gin.H{
+		"policy":    policy,
+		"default":   defaultRetention(),
+		"effective": effectiveRetention(nil, policy),
+	}
+}
+
+// Start pruning in the background, every RETENTION_JANITOR_INTERVAL_MINUTES (default 60, 0 turns the janitor off)
+func StartRetentionJanitor() {
+	interval := defaultJanitorInterval
+	if value := os.Getenv("RETENTION_JANITOR_INTERVAL_MINUTES"); value != "" {
+		minutes, err := strconv.Atoi(value)
+		if err != nil || minutes < 0 {
+			log.Printf("Invalid RETENTION_JANITOR_INTERVAL_MINUTES %q, using %s", value, defaultJanitorInterval)
+		} else if minutes == 0 {
+			log.Println("Retention janitor disabled")
+			return
+		} else {
+			interval = time.Duration(minutes) * time.Minute
+		}
+	}
+	batchSize := defaultJanitorBatchSize
+	if size, err := strconv.Atoi(os.Getenv("RETENTION_BATCH_SIZE")); err == nil && size > 0 {
+		batchSize = size
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			runJanitor(batchSize)
+			<-ticker.C
+		}
+	}()
+}
+
+// One janitor pass under the janitor lock, skipped when another instance holds it
+func runJanitor(batchSize int) {
+	release, locked, err := repos.Retention.TryLock(janitorLockName)
+	if err != nil {
+		log.Printf("Retention janitor: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer release()
+
+	started := time.Now()
+	report, err := pruneExpiredData(batchSize)
+	if err != nil {
+		log.Printf("Retention janitor stopped after an error: %v", err)
+	}
+	if report.Runs+report.Snapshots+report.Blobs+report.OrphanLinks > 0 || err != nil {
+		log.Printf("Retention janitor removed %d runs, %d snapshots, %d snapshot bodies and %d orphaned links of %d analyses in %s",
+			report.Runs, report.Snapshots, report.Blobs, report.OrphanLinks, report.AnalysesSeen, time.Since(started).Round(time.Millisecond))
+	}
+}
+
+// Walk the analyses by id in batches and drop the runs and snapshots their policy no longer keeps, then the link rows
+// and snapshot bodies nothing points to anymore. Deletes go by primary key in small batches, no table is locked as a whole
+func pruneExpiredData(batchSize int) (janitorReport, error) {
+	var report janitorReport
+	lastID := 0
+	for {
+		batch, err := repos.Retention.Policies(lastID, batchSize)
+		if err != nil {
+			return report, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, analysis := range batch {
+			lastID = analysis.AnalysisID
+			report.AnalysesSeen++
+			policy := effectiveRetention(analysis.Project, analysis.User)
+			if *policy.KeepRuns == 0 && *policy.KeepDays == 0 {
+				continue
+			}
+			var cutoff time.Time
+			if *policy.KeepDays > 0 {
+				cutoff = time.Now().AddDate(0, 0, -*policy.KeepDays)
+			}
+			// The runs go first, a deleted snapshot only clears the snapshot_id of its run
+			removed, err := inBatches(batchSize, func(limit int) (int64, error) {
+				return repos.Retention.PruneRuns(analysis.AnalysisID, *policy.KeepRuns, cutoff, limit)
+			})
+			report.Runs += removed
+			if err != nil {
+				return report, err
+			}
+			removed, err = inBatches(batchSize, func(limit int) (int64, error) {
+				return repos.Retention.PruneSnapshots(analysis.AnalysisID, *policy.KeepRuns, cutoff, limit)
+			})
+			report.Snapshots += removed
+			if err != nil {
+				return report, err
+			}
+		}
+		time.Sleep(janitorBatchPause)
+	}
+
+	// Link rows whose analysis is gone. The foreign key removes them with the analysis, these are left over from data
+	// written while it was not enforced
+	removed, err := inBatches(batchSize, repos.Retention.DeleteOrphanLinks)
+	report.OrphanLinks += removed
+	if err != nil {
+		return report, err
+	}
+	// Bodies used in the last hour are left alone so a run that is being saved right now never loses its body
+	removed, err = inBatches(batchSize, func(limit int) (int64, error) {
+		return repos.Retention.DeleteOrphanBlobs(time.Now().Add(-time.Hour), limit)
+	})
+	report.Blobs += removed
+	return report, err
+}
+
+// Call remove with batchSize until it removes less than that, with a short pause in between, and return how many
+// it removed in total
+func inBatches(batchSize int, remove func(limit int) (int64, error)) (int64, error) {
+	var removed int64
+	for {
+		deleted, err := remove(batchSize)
+		removed += deleted
+		if err != nil || deleted < int64(batchSize) {
+			return removed, err
+		}
+		time.Sleep(janitorBatchPause)
+	}
+}
@@ -0,0 +1,75 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/kiwiscode/go-react-crawler/repository"
+)
+
+func TestMain(m *testing.M) {
+	// The middleware reads the secret when the routes are declared
+	os.Setenv("JWT_SECRET", "test-secret")
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// A router with every route on fresh in-memory repositories
+func newTestRouter() *gin.Engine {
+	UseRepositories(repository.NewMemory())
+	r := gin.New()
+	AuthRoutes(r)
+	ProfileRoutes(r)
+	AnalyzeRoutes(r)
+	ExtractionRoutes(r)
+	SnapshotRoutes(r)
+	RunRoutes(r)
+	LinkRoutes(r)
+	SearchRoutes(r)
+	ProjectRoutes(r)
+	TagRoutes(r)
+	RetentionRoutes(r)
+	return r
+}
+
+// Send a request with an optional JSON body and bearer token, and decode the JSON response into out when it is not nil
+func doJSON(t *testing.T, r http.Handler, method, path, token string, body, out interface{}) int {
+	t.Helper()
+	var reader bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reader).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &reader)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// Register a user and return its token
+func registerUser(t *testing.T, r http.Handler, username string) string {
+	t.Helper()
+	var resp struct {
+		Token string `json:"token"`
+	}
+	body := gin.H{"username": username, "email": username + "@example.com", "password": "secret1"}
+	if code := doJSON(t, r, http.MethodPost, "/register", "", body, &resp); code != http.StatusOK || resp.Token == "" {
+		t.Fatalf("register %s: status %d, token %q", username, code, resp.Token)
+	}
+	return resp.Token
+}
@@ -0,0 +1,180 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// One analysis run to record, Result is nil when the analysis failed before producing one
+type analysisRun struct {
+	Status     string
+	Error      string
+	Result     *utils.AnalysisResult
+	SnapshotID int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+// Runs per page of the list when ?limit is not given, and the most a page can hold
+const (
+	defaultRunsPageSize = 50
+	maxRunsPageSize     = 200
+)
+
+func RunRoutes(r *gin.Engine) {
+	// Route declarations, :runId can also be "latest"
+	r.GET("/analyses/:id/runs", auth.JWTAuthMiddleware(), listAnalysisRunsHandler)
+	r.GET("/analyses/:id/runs/:runId", auth.JWTAuthMiddleware(), getAnalysisRunHandler)
+}
+
+// Outcome of a finished run: error when the page could not be fetched, done otherwise. The queued and running states
+// belong to the analysis row, a stored run is always over
+func runStatus(result *utils.AnalysisResult) string {
+	if result.ErrorURL != "" {
+		return "error"
+	}
+	return "done"
+}
+
+// Add a run to the history of the analysis. The urls row keeps the latest result for the table and detail page,
+// every run is kept here with its own result, status, timings and error
+func saveAnalysisRun(urlID int, run analysisRun) error {
+	stored := models.AnalysisRun{
+		AnalysisID: urlID,
+		Status:     run.Status,
+		Error:      run.Error,
+		StartedAt:  run.StartedAt,
+		FinishedAt: run.FinishedAt,
+		DurationMs: run.FinishedAt.Sub(run.StartedAt).Milliseconds(),
+	}
+	if run.SnapshotID > 0 {
+		stored.SnapshotID = &run.SnapshotID
+	}
+	if result := run.Result; result != nil {
+		stored.Result, _ = json.Marshal(result)
+		if result.Response != nil {
+			stored.FinalURL = result.Response.FinalURL
+			stored.StatusCode = result.Response.StatusCode
+		}
+		stored.InternalLinksCount = result.InternalLinksCount
+		stored.ExternalLinksCount = result.ExternalLinksCount
+		stored.InaccessibleLinksCount = result.InaccessibleLinksCount
+		stored.BrokenAnchorsCount = result.BrokenAnchorsCount
+		// A page that could not be fetched still produces a result, the reason is kept as the run's error
+		if stored.Error == "" && result.ErrorURL != "" {
+			stored.Error = fmt.Sprintf("%s: %s", result.ErrorURL, result.Error)
+		}
+	}
+
+	_, err := repos.Runs.Create(&stored)
+	return err
+}
+
+// List the runs of an analysis, newest first /analyses/:id/runs. Pages hold ?limit runs, ?before=<run id> continues after the
+// last run of the previous page (its id is returned as next_cursor)
+func listAnalysisRunsHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	limit := defaultRunsPageSize
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxRunsPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxRunsPageSize)})
+			return
+		}
+	}
+
+	// Make sure the analysis belongs to the user, so an unknown analysis is a 404 and not an empty list
+	if existing, err := repos.Analyses.Find(id); err != nil || existing.UserID != userID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+		return
+	}
+
+	before := 0
+	if beforeParam := c.Query("before"); beforeParam != "" {
+		before, err = strconv.Atoi(beforeParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid before parameter"})
+			return
+		}
+	}
+
+	// One extra run tells whether there is another page
+	runs, err := repos.Runs.List(id, before, limit+1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on analysis runs"})
+		return
+	}
+
+	var nextCursor *int
+	if len(runs) > limit {
+		runs = runs[:limit]
+		nextCursor = &runs[limit-1].ID
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": runs, "next_cursor": nextCursor})
+}
+
+// One run with its full result /analyses/:id/runs/:runId, /analyses/:id/runs/latest is the newest run
+func getAnalysisRunHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	// 0 is the newest run
+	runID := 0
+	if c.Param("runId") != "latest" {
+		runID, err = strconv.Atoi(c.Param("runId"))
+		if err != nil || runID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID parameter"})
+			return
+		}
+	}
+
+	run, err := repos.Runs.Get(id, userID, runID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Run not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": run})
+}
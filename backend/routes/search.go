@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+// Results of a search when ?limit is not given, and the most it can return
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// Runes of the page text kept for the search, long pages are searched by their beginning
+const searchContentLimit = 100000
+
+func SearchRoutes(r *gin.Engine) {
+	// Route declarations
+	r.GET("/search", auth.JWTAuthMiddleware(), searchHandler)
+}
+
+// Store the text of a run for the search: its title, the anchor texts of its links and the main text of the page
+func saveSearchDocument(urlID int, result *utils.AnalysisResult) error {
+	var linkTexts []string
+	seen := map[string]bool{}
+	for _, links := range [][]utils.LinkDetail{result.InternalLinks, result.ExternalLinks, result.InaccessibleLinks} {
+		for _, link := range links {
+			text := strings.TrimSpace(link.Text)
+			if text != "" && !seen[text] {
+				seen[text] = true
+				linkTexts = append(linkTexts, text)
+			}
+		}
+	}
+
+	doc := repository.SearchDocument{
+		AnalysisID: urlID,
+		Title:      utils.TruncateRunes(result.Title, 255),
+		LinkText:   utils.TruncateRunes(strings.Join(linkTexts, "\n"), searchContentLimit),
+	}
+	if result.Content != nil {
+		doc.Content = utils.TruncateRunes(result.Content.MainText, searchContentLimit)
+	}
+	return repos.Search.Index(doc)
+}
+
+// Search the user's analyses by title, URL, link text and page text /search?q=, best matches first with the matching
+// words highlighted
+func searchHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	terms := repository.SearchTerms(c.Query("q"))
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q must contain a word of at least 3 characters"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit)})
+			return
+		}
+	}
+
+	hits, err := repos.Search.Search(userID, terms, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on search"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": hits, "terms": terms})
+}
@@ -0,0 +1,225 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
+	"github.com/kiwiscode/go-react-crawler/utils"
+)
+
+func SnapshotRoutes(r *gin.Engine) {
+	// Route declarations, :snapshotId can also be "latest"
+	r.GET("/analyses/:id/snapshots", auth.JWTAuthMiddleware(), listSnapshotsHandler)
+	r.GET("/analyses/:id/snapshots/:snapshotId", auth.JWTAuthMiddleware(), getSnapshotHandler)
+	r.GET("/analyses/:id/snapshots/:snapshotId/body", auth.JWTAuthMiddleware(), getSnapshotBodyHandler)
+	r.GET("/analyses/:id/snapshots/:snapshotId/warc", auth.JWTAuthMiddleware(), getSnapshotWARCHandler)
+	r.GET("/analyses/:id/warc", auth.JWTAuthMiddleware(), getSnapshotWARCHandler)
+	r.GET("/analyses/:id/snapshots/:snapshotId/har", auth.JWTAuthMiddleware(), getSnapshotHARHandler)
+	r.GET("/analyses/:id/har", auth.JWTAuthMiddleware(), getSnapshotHARHandler)
+}
+
+// List the stored runs of an analysis, newest first /analyses/:id/snapshots
+func listSnapshotsHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	snapshots, err := repos.Snapshots.List(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on snapshots"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": snapshots})
+}
+
+// Metadata and response headers of one run /analyses/:id/snapshots/:snapshotId
+func getSnapshotHandler(c *gin.Context) {
+	snapshot, _, ok := loadSnapshot(c, false)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": snapshot})
+}
+
+// The stored body, shown inline or downloaded with ?download=true /analyses/:id/snapshots/:snapshotId/body
+func getSnapshotBodyHandler(c *gin.Context) {
+	snapshot, body, ok := loadSnapshot(c, true)
+	if !ok {
+		return
+	}
+	// The page request of the run failed, only the requests are kept for the exports
+	if snapshot.StatusCode == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No response stored for this run"})
+		return
+	}
+
+	contentType := snapshot.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		// Name the file after the last path segment of the page, like a browser's "save as"
+		name := "index"
+		if finalURL, err := url.Parse(snapshot.FinalURL); err == nil {
+			if base := path.Base(finalURL.Path); base != "" && base != "/" && base != "." {
+				name = base
+			}
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("snapshot-%d-%s", snapshot.ID, name)))
+	} else {
+		// The archived page must not run its scripts on our origin, the sandbox gives it an opaque origin and blocks scripts
+		c.Header("Content-Security-Policy", "sandbox")
+		c.Header("Content-Disposition", "inline")
+	}
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("ETag", `"`+snapshot.Hash+`"`)
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// The requests and responses of a run as a WARC file /analyses/:id/snapshots/:snapshotId/warc, /analyses/:id/warc is the latest run.
+// The file is written from the stored exchanges and their bodies, runs stored before that have the finished file
+func getSnapshotWARCHandler(c *gin.Context) {
+	export, ok := loadSnapshotExport(c)
+	if !ok {
+		return
+	}
+	// Runs stored before the export existed have none
+	if len(export.Exchanges) == 0 && len(export.WARC) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No WARC stored for this run"})
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("analysis-%s-snapshot-%d.warc.gz", c.Param("id"), export.SnapshotID)))
+	if len(export.Exchanges) == 0 {
+		c.Data(http.StatusOK, "application/warc", export.WARC)
+		return
+	}
+
+	var hashes []string
+	for _, exchange := range export.Exchanges {
+		if exchange.BodyHash != "" {
+			hashes = append(hashes, exchange.BodyHash)
+		}
+	}
+	bodies, err := repos.Snapshots.Bodies(hashes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read snapshot body"})
+		return
+	}
+	analysisID, _ := strconv.Atoi(c.Param("id"))
+	var warc bytes.Buffer
+	if err := utils.WriteWARC(&warc, analysisID, export.Exchanges, bodies); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to write WARC"})
+		return
+	}
+	c.Data(http.StatusOK, "application/warc", warc.Bytes())
+}
+
+// Requests, response headers, timings and redirects of a run as a HAR 1.2 file /analyses/:id/snapshots/:snapshotId/har,
+// /analyses/:id/har is the latest run. ?download=true makes it an attachment
+func getSnapshotHARHandler(c *gin.Context) {
+	export, ok := loadSnapshotExport(c)
+	if !ok {
+		return
+	}
+	// Runs stored before the export existed have none
+	if len(export.HAR) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No HAR stored for this run"})
+		return
+	}
+	if download, _ := strconv.ParseBool(c.Query("download")); download {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("analysis-%s-snapshot-%d.har", c.Param("id"), export.SnapshotID)))
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", export.HAR)
+}
+
+// Load what the exports of the run named by the route parameters are made from, the latest run when there is no :snapshotId.
+// Writes the error response itself when it fails
+func loadSnapshotExport(c *gin.Context) (*repository.SnapshotExport, bool) {
+	id, userID, snapshotID, ok := snapshotParams(c)
+	if !ok {
+		return nil, false
+	}
+
+	export, err := repos.Snapshots.Export(id, userID, snapshotID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, false
+	}
+	return export, true
+}
+
+// Load the snapshot named by the route parameters for the logged in user, writing the error response itself when it fails
+func loadSnapshot(c *gin.Context, withBody bool) (*models.Snapshot, []byte, bool) {
+	id, userID, snapshotID, ok := snapshotParams(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	// The body is only read from the database when it is asked for
+	snapshot, body, err := repos.Snapshots.Get(id, userID, snapshotID, withBody)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Snapshot not found"})
+			return nil, nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read snapshot body"})
+		return nil, nil, false
+	}
+	return snapshot, body, true
+}
+
+// The analysis id, user id and snapshot id (0 for the latest) of a snapshot route, writing the error response itself
+// when one is invalid
+func snapshotParams(c *gin.Context) (int, int, int, bool) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return 0, 0, 0, false
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return 0, 0, 0, false
+	}
+	userID := int(userIDFloat)
+
+	snapshotID := 0
+	if snapshotParam := c.Param("snapshotId"); snapshotParam != "" && snapshotParam != "latest" {
+		snapshotID, err = strconv.Atoi(snapshotParam)
+		if err != nil || snapshotID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid snapshot ID parameter"})
+			return 0, 0, 0, false
+		}
+	}
+	return id, userID, snapshotID, true
+}
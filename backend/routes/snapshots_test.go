@@ -0,0 +1,102 @@
+package routes
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Create and run an analysis of a page nothing listens on and return its id and URL
+func createRefusedAnalysis(t *testing.T, r http.Handler, token string) (int, string) {
+	t.Helper()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	pageURL := closed.URL + "/"
+	closed.Close()
+
+	var created createResponse
+	if code := doJSON(t, r, http.MethodPost, "/analyses/create", token, gin.H{"urls": []string{pageURL}}, &created); code != http.StatusOK || len(created.Data) != 1 {
+		t.Fatalf("create: status %d, data %+v", code, created.Data)
+	}
+	runPipeline(t, r, token, created.Data[0].ID)
+	return created.Data[0].ID, pageURL
+}
+
+// Send an authenticated GET and return the status and the raw body
+func doGet(t *testing.T, r http.Handler, path, token string) (int, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec.Code, rec.Body.Bytes()
+}
+
+// A page whose request got no response still has its request in the WARC
+func TestRefusedPageWARC(t *testing.T) {
+	r := newTestRouter()
+	token := registerUser(t, r, "alice")
+	id, pageURL := createRefusedAnalysis(t, r, token)
+
+	code, body := doGet(t, r, fmt.Sprintf("/analyses/%d/warc", id), token)
+	if code != http.StatusOK {
+		t.Fatalf("warc: status %d, body %s", code, body)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	warc, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"WARC-Type: request", "WARC-Target-URI: " + pageURL, "error: "} {
+		if !strings.Contains(string(warc), want) {
+			t.Errorf("warc: no %q in\n%s", want, warc)
+		}
+	}
+	if strings.Contains(string(warc), "WARC-Type: response") {
+		t.Errorf("warc: a response record for a request that got none")
+	}
+
+	// There is no page body to show
+	if code, _ := doGet(t, r, fmt.Sprintf("/analyses/%d/snapshots/latest/body", id), token); code != http.StatusNotFound {
+		t.Errorf("body: status %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+// A page whose request got no response still exports a HAR, the entry carries the error instead of a response
+func TestRefusedPageHAR(t *testing.T) {
+	r := newTestRouter()
+	token := registerUser(t, r, "alice")
+	id, pageURL := createRefusedAnalysis(t, r, token)
+
+	var har struct {
+		Log struct {
+			Entries []struct {
+				Request struct {
+					URL string `json:"url"`
+				} `json:"request"`
+				Response struct {
+					Status int    `json:"status"`
+					Error  string `json:"_error"`
+				} `json:"response"`
+			} `json:"entries"`
+		} `json:"log"`
+	}
+	if code := doJSON(t, r, http.MethodGet, fmt.Sprintf("/analyses/%d/har", id), token, nil, &har); code != http.StatusOK {
+		t.Fatalf("har: status %d", code)
+	}
+	if len(har.Log.Entries) != 1 {
+		t.Fatalf("har: %d entries, want the page request only", len(har.Log.Entries))
+	}
+	if entry := har.Log.Entries[0]; entry.Request.URL != pageURL || entry.Response.Status != 0 || entry.Response.Error == "" {
+		t.Errorf("har: entry %+v, want a request of %s with status 0 and its error", entry, pageURL)
+	}
+}
@@ -0,0 +1,213 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	auth "github.com/kiwiscode/go-react-crawler/middleware"
+	"github.com/kiwiscode/go-react-crawler/models"
+	"github.com/kiwiscode/go-react-crawler/repository"
+)
+
+// Request structures
+type TagsReq struct {
+	Tags []string `json:"tags"`
+}
+
+type TagRenameReq struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// Longest tag name, the size of the column, and the most tags an analysis can carry
+const (
+	maxTagLength       = 50
+	maxTagsPerAnalysis = 20
+)
+
+func TagRoutes(r *gin.Engine) {
+	// Route declarations
+	r.GET("/tags", auth.JWTAuthMiddleware(), listTagsHandler)
+	r.PUT("/tags/:name", auth.JWTAuthMiddleware(), renameTagHandler)
+	r.DELETE("/tags/:name", auth.JWTAuthMiddleware(), deleteTagHandler)
+	r.PUT("/analyses/:id/tags", auth.JWTAuthMiddleware(), setAnalysisTagsHandler)
+}
+
+// Tags are compared without case and surrounding spaces, commas separate the tags of the ?tag filter so they cannot be part of one
+func normalizeTag(name string) (string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if name == "" || utf8.RuneCountInString(name) > maxTagLength {
+		return "", fmt.Errorf("tags must be between 1 and %d characters", maxTagLength)
+	}
+	if strings.Contains(name, ",") {
+		return "", fmt.Errorf("tags cannot contain commas")
+	}
+	return name, nil
+}
+
+// Attach the tags of each analysis to it, for the listings
+func attachTags(urls []models.URL) error {
+	ids := make([]int, len(urls))
+	for i, url := range urls {
+		ids[i] = url.ID
+	}
+	tags, err := repos.Tags.ForAnalyses(ids)
+	if err != nil {
+		return err
+	}
+	for i := range urls {
+		urls[i].Tags = tags[urls[i].ID]
+	}
+	return nil
+}
+
+// List the user's tags with their number of analyses /tags
+func listTagsHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	tags, err := repos.Tags.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "DB error on tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tags})
+}
+
+// Replace the tags of an analysis /analyses/:id/tags, tags that do not exist yet are created
+func setAnalysisTagsHandler(c *gin.Context) {
+	// Convert the id parameter from string to integer
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID parameter"})
+		return
+	}
+
+	var req TagsReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	tags := []string{}
+	for _, tag := range req.Tags {
+		name, err := normalizeTag(tag)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !slices.Contains(tags, name) {
+			tags = append(tags, name)
+		}
+	}
+	if len(tags) > maxTagsPerAnalysis {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("An analysis can have at most %d tags", maxTagsPerAnalysis)})
+		return
+	}
+
+	if err := repos.Tags.SetForAnalysis(userID, id, tags); err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Analysis not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tags"})
+		return
+	}
+
+	slices.Sort(tags)
+	c.JSON(http.StatusOK, gin.H{"data": tags})
+}
+
+// Rename a tag on all the analyses carrying it /tags/:name
+func renameTagHandler(c *gin.Context) {
+	var req TagRenameReq
+	// Take the body part of the HTTP request as JSON
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	name, err := normalizeTag(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	newName, err := normalizeTag(req.Name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := repos.Tags.Rename(userID, name, newName); err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		case repository.ErrDuplicate:
+			c.JSON(http.StatusConflict, gin.H{"error": "A tag with this name already exists"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename tag"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"name": newName}})
+}
+
+// Remove a tag from all the user's analyses /tags/:name
+func deleteTagHandler(c *gin.Context) {
+	// Get the userID from the Gin context
+	userIDVal, _ := c.Get("userID")
+	userIDFloat, ok := userIDVal.(float64)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid userID"})
+		return
+	}
+	userID := int(userIDFloat)
+
+	name, err := normalizeTag(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	if err := repos.Tags.Delete(userID, name); err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
@@ -2,18 +2,39 @@ package utils
 
 // ### with Colly and React SPA pages
 // When using Colly to scrape pages served by React (or other client-side rendered frameworks), the scraper receives only the initial static HTML served by the server, which typically does not include the dynamically rendered content such as `<h1>`, `<h2>`, or page titles that React generates on the client side.
+// For such pages configure a browser renderer (RENDERER=cdp, see renderer.go): the rendered DOM is analyzed as well and compared with the static result.
 import (
+	"bytes"
+	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/PuerkitoBio/goquery"
 	"github.com/gocolly/colly"
+	"golang.org/x/net/html"
 )
 
 // link detail type structure
 type LinkDetail struct {
     URL        string `json:"url"`
     Text       string `json:"text,omitempty"`
+    Rel        string `json:"rel,omitempty"`
+    // Outcome of requesting the target (see checkLinks): the status code, or why no response came back
+    StatusCode int    `json:"status_code,omitempty"`
+    CheckError string `json:"check_error,omitempty"`
+
+    // The href resolved against the page with its fragment, broken anchors are reported under it
+    resolved string
+}
+
+// The href resolved against the page, fragment included. URL drops the fragment of relative links and is empty for "#id"
+func (l LinkDetail) ResolvedURL() string {
+	if l.resolved != "" {
+		return l.resolved
+	}
+	return l.URL
 }
 
 // Analysis result type structure
@@ -29,11 +50,68 @@ type AnalysisResult struct {
 	InaccessibleLinks []LinkDetail       `json:"inaccessible_links"`
 	HasLoginForm      bool           `json:"has_login_form"`
 	ErrorURL          string         `json:"error_url,omitempty"`
+	Error             string         `json:"error,omitempty"` // why the request of ErrorURL failed
+	Response          *ResponseMeta  `json:"response,omitempty"`
+	Security          *SecurityAudit `json:"security,omitempty"`
+	Technologies      []Technology   `json:"technologies"`
+	Resources         *ResourceInventory `json:"resources,omitempty"`
+	Content           *ContentAnalysis   `json:"content,omitempty"`
+	MetaDescription   string             `json:"meta_description"`
+	ContentSimHash    string             `json:"content_simhash,omitempty"`
+	Extracted         map[string][]string `json:"extracted,omitempty"`
+	Charset           *CharsetReport      `json:"charset,omitempty"`
+	BrokenAnchorsCount int                `json:"broken_anchors_count"`
+	BrokenAnchors     []BrokenAnchor      `json:"broken_anchors"`
+	Kind              string              `json:"kind"` // html, pdf, image, feed, json, xml or other
+	Document          *DocumentInfo       `json:"document,omitempty"`
+	Rendered          *RenderComparison   `json:"rendered,omitempty"`
+	Snapshot          *Snapshot           `json:"-"` // raw response, stored separately
+
+	// Every request of the analysis in the order they were made, for the WARC and HAR exports
+	exchanges []*traceHop
+
+}
+
+// Longest meta description kept, the length of the meta_description column
+const maxMetaDescriptionLength = 1024
+
+// The first max runes of s
+func TruncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max])
+}
 
+// Optional settings of an analysis
+type AnalyzeOptions struct {
+	// User-defined fields to extract from the page
+	ExtractionRules []ExtractionRule
+	// Renders the page a second time (for example in a headless browser) and compares it with the static fetch, nil means no second pass
+	Renderer Renderer
 }
 
 func AnalyzeURL(targetURL string) (*AnalysisResult, error) {
+	return AnalyzeURLWithOptions(targetURL, AnalyzeOptions{})
+}
+
+func AnalyzeURLWithOptions(targetURL string, opts AnalyzeOptions) (*AnalysisResult, error) {
 	c := colly.NewCollector()
+	// Hard limit on the page body, enforced after decompression by the tracer and again by colly
+	bodyLimit := maxBodyBytes()
+	c.MaxBodySize = int(bodyLimit)
+
+	// Route every request through the tracing transport to capture status codes, redirects, headers and timings
+	tracer := newTraceTransport()
+	tracer.maxBodyBytes = bodyLimit
+	// Resources and anchor targets are fetched through their own tracer so the main one only sees the page and its redirects
+	fetchTracer := newFetchTracer()
+	fetchClient := &http.Client{Timeout: 10 * time.Second, Transport: fetchTracer}
+	c.WithTransport(tracer)
+	// Length of the (decompressed) body colly handed to the callbacks
+	var bodySize int64
+	// Page source, used by the HTML patterns of the technology rules
+	var pageHTML []byte
 
 	result := &AnalysisResult{
 		HeadingCounts: make(map[string]int),
@@ -42,82 +120,195 @@ func AnalyzeURL(targetURL string) (*AnalysisResult, error) {
 	parsedURL, _ := url.Parse(targetURL)
 	domain := parsedURL.Host
 
-	// HTML version
-	// It's difficult to extract the HTML version from the response body (because Colly provides a plain body, not a DOM)
-	// Therefore, an alternative approach can be used to extract the HTML version
+	// Charset: colly would transcode from the declared charset only, so it is made to pass the bytes through
+	// and the body is decoded here before any HTML callback runs
+	c.OnRequest(func(r *colly.Request) {
+		r.ResponseCharacterEncoding = rawBodyEncoding
+	})
 	c.OnResponse(func(r *colly.Response) {
-		body := string(r.Body)
-		if strings.Contains(body, "<!DOCTYPE html>") {
-			result.HTMLVersion = "HTML5"
-		} else if strings.Contains(body, "-//W3C//DTD XHTML 1.0") {
-			result.HTMLVersion = "XHTML 1.0"
-		} else {
-			result.HTMLVersion = "Unknown"
+		r.Body = restoreRawBody(tracer.heldBOM(), r.Body)
+		bodySize = int64(len(r.Body))
+		result.Snapshot = newSnapshot(targetURL, r.Request.URL.String(), r.StatusCode, r.Headers, r.Body)
+		if isTextContent(r.Headers.Get("Content-Type")) {
+			r.Body, result.Charset = normalizeCharset(r.Body, r.Headers.Get("Content-Type"))
 		}
 	})
 
-	// Page title
-	c.OnHTML("title", func(e *colly.HTMLElement) {
-		result.Title = e.Text
+	// Document kind: PDFs, images, feeds, JSON and XML get their own metadata instead of the HTML analysis
+	c.OnResponse(func(r *colly.Response) {
+		contentType := r.Headers.Get("Content-Type")
+		result.Kind = resultKind(contentType, r.Body)
+		if result.Kind == ResultKindHTML {
+			return
+		}
+		result.Document = analyzeDocument(result.Kind, contentType, r.Body)
+		result.Title = result.Document.Title
+		// Links inside a PDF are counted like the links of a page
+		for _, href := range result.Document.Links {
+			link, err := url.Parse(href)
+			if err != nil {
+				continue
+			}
+			linkDetail := LinkDetail{URL: r.Request.AbsoluteURL(href)}
+			if link.Host == "" || strings.Contains(link.Host, domain) {
+				result.InternalLinksCount++
+				result.InternalLinks = append(result.InternalLinks, linkDetail)
+			} else {
+				result.ExternalLinksCount++
+				result.ExternalLinks = append(result.ExternalLinks, linkDetail)
+			}
+		}
 	})
 
-	// Heading counts
-	for i := 1; i <= 6; i++ {
-    tag := "h" + strconv.Itoa(i)
-    c.OnHTML(tag, func(e *colly.HTMLElement) {
-        result.HeadingCounts[tag]++
-    })
+	// Everything read from the markup comes from one streaming pass of the tokenizer, colly never builds a DOM
+	var mixedContent []LinkDetail
+	// Script sources and the generator meta tag for technology fingerprinting
+	var scriptSrcs []string
+	var metaGenerator string
+	// Subresources (scripts, stylesheets, iframes, fonts and preloads) for the resource inventory
+	var resources []Resource
+	var pageURL *url.URL
+	// Fragment links (#pricing, /docs#install) and the anchors of this page, verified once the page is parsed
+	var fragmentLinks []fragmentLink
+	var pageIDs map[string]bool
+	var anchorPageURL *url.URL
+	c.OnResponse(func(r *colly.Response) {
+		// Other documents have no markup to scan
+		if result.Kind != ResultKindHTML {
+			return
+		}
+		pageHTML = r.Body
+		pageURL = r.Request.URL
+		scan := scanPage(bytes.NewReader(r.Body), r.Request.URL)
+		applyPageScan(result, scan, r.Body, r.Request.URL, domain, opts.ExtractionRules)
+		mixedContent = scan.MixedContent
+		scriptSrcs = scan.ScriptSrcs
+		metaGenerator = scan.MetaGenerator
+		resources = scan.Resources
+
+		for _, scanned := range scan.Links {
+			// colly's AbsoluteURL drops the fragment, so fragment links are resolved against the page URL
+			if link, err := r.Request.URL.Parse(strings.TrimSpace(scanned.Href)); err == nil && (link.Scheme == "http" || link.Scheme == "https") && !ignoredFragment(link.Fragment) {
+				fragmentLinks = append(fragmentLinks, fragmentLink{url: link, text: strings.Join(strings.Fields(scanned.Text), " ")})
+			}
+		}
+
+		anchorPageURL = r.Request.URL
+		pageIDs = scan.AnchorIDs
+	})
+
+	// Set error handler
+	c.OnError(func(r *colly.Response, err error) {
+		result.ErrorURL = r.Request.URL.String()
+		result.Error = err.Error()
+		bodySize = int64(len(r.Body))
+		// Error pages are kept too, colly has not touched their body
+		if r.StatusCode > 0 {
+			result.Snapshot = newSnapshot(targetURL, r.Request.URL.String(), r.StatusCode, r.Headers, r.Body)
+		}
+	})
+
+
+	c.Visit(targetURL)
+
+	// Response metadata and timing of the final request in the chain
+	result.Response = tracer.ResponseMeta(bodySize)
+	if result.Response != nil && bodyLimit > 0 && bodySize >= bodyLimit {
+		result.Response.BodyTruncated = true
+	}
+	// Security headers, cookies, mixed content and certificate of the analyzed origin
+	result.Security = auditSecurity(tracer.Hops(), mixedContent)
+	// CMS, frameworks, analytics, CDN and server software used by the page
+	result.Technologies = detectTechnologies(tracer.TechnologyInput(metaGenerator, scriptSrcs, pageHTML))
+	// Subresources grouped by origin, page weight and the performance budget
+	if result.Response != nil {
+		if pageURL == nil {
+			pageURL, _ = url.Parse(result.Response.FinalURL)
+		}
+		result.Resources = inventoryResources(pageURL, resources, result.Response.CompressedSize, fetchClient)
+	}
+
+	// Status of every link target, so broken links are known without following them
+	checkLinks(fetchClient, result.InternalLinks, result.ExternalLinks)
+
+	// Fragments pointing to ids or names that do not exist on the target document
+	if anchorPageURL != nil {
+		result.BrokenAnchors = checkFragmentLinks(anchorPageURL, pageIDs, fragmentLinks, fetchClient)
+		result.BrokenAnchorsCount = len(result.BrokenAnchors)
+	}
+
+	result.exchanges = mergeHops(tracer.Hops(), fetchTracer.Hops())
+
+	// Client-side rendered pages: analyze the DOM produced by the renderer and flag what differs from the static HTML
+	if opts.Renderer != nil && result.Kind == ResultKindHTML {
+		result.Rendered = analyzeRendered(targetURL, result, opts.Renderer, opts)
 	}
 
+	return result, nil
+}
+
+// Fill the fields read from the markup (title, headings, links, main text and extracted fields) from one scan of the page
+func applyPageScan(result *AnalysisResult, scan *pageScan, body []byte, pageURL *url.URL, domain string, rules []ExtractionRule) {
+	result.HTMLVersion = scan.HTMLVersion
+	result.Title = scan.Title
+	for tag, count := range scan.HeadingCounts {
+		result.HeadingCounts[tag] = count
+	}
+	result.HasLoginForm = scan.HasLoginForm
+	// The description is stored in a VARCHAR(1024) column
+	result.MetaDescription = TruncateRunes(scan.MetaDescription, maxMetaDescriptionLength)
+
 	// Link analysis
-	c.OnHTML("a[href]", func(e *colly.HTMLElement) {
-		href := e.Attr("href")
-		link, err := url.Parse(href)
+	for _, scanned := range scan.Links {
+		if scanned.Tag != "a" {
+			continue
+		}
+
+		link, err := url.Parse(scanned.Href)
 		if err != nil {
 			result.InaccessibleLinksCount++
 			result.InaccessibleLinks = append(result.InaccessibleLinks, LinkDetail{
-			URL:  href,
-			Text: e.Text,
-		})
-			return
+				URL:  scanned.Href,
+				Text: scanned.Text,
+				Rel:  scanned.Rel,
+			})
+			continue
 		}
 
 		fullURL := link.String()
 		if !link.IsAbs() {
-		fullURL = e.Request.AbsoluteURL(href)
+			fullURL = scanned.AbsoluteURL
 		}
 
 		linkDetail := LinkDetail{
-		URL:  fullURL,
-		Text: e.Text,
+			URL:  fullURL,
+			Text: scanned.Text,
+			Rel:  scanned.Rel,
+		}
+		// Resolved the way fragment links are, so a broken anchor can be found again on its link
+		if resolved, err := pageURL.Parse(strings.TrimSpace(scanned.Href)); err == nil {
+			linkDetail.resolved = resolved.String()
 		}
 
-		
 		if link.Host == "" || strings.Contains(link.Host, domain) {
 			result.InternalLinksCount++
 			result.InternalLinks = append(result.InternalLinks, linkDetail)
 		} else {
 			result.ExternalLinksCount++
-					result.ExternalLinks = append(result.ExternalLinks, linkDetail)
-
+			result.ExternalLinks = append(result.ExternalLinks, linkDetail)
 		}
-	})
+	}
 
-	// Login form check
-	c.OnHTML("form", func(e *colly.HTMLElement) {
-		if strings.Contains(strings.ToLower(e.Text), "login") || e.ChildAttr("input[type='password']", "type") == "password" {
-			result.HasLoginForm = true
+	// Main text: word count, readability, language and keyword density
+	result.Content = analyzeMainText(scan.MainText, scan.Lang, len(body))
+	// Fingerprint of the main text for near-duplicate detection
+	if result.Content.WordCount > 0 {
+		result.ContentSimHash = FormatSimHash(SimHash(result.Content.MainText))
+	}
+	// Custom fields from the extraction rules attached to this analysis. Selectors need a DOM, so it is only built when there are rules
+	if len(rules) > 0 {
+		if root, err := html.Parse(bytes.NewReader(body)); err == nil {
+			result.Extracted = extractFields(goquery.NewDocumentFromNode(root).Find("html").First(), rules)
 		}
-	})
-
-	// Set error handler
-	c.OnError(func(r *colly.Response, err error) {
-		result.ErrorURL = r.Request.URL.String()
-	})
-
-
-	c.Visit(targetURL)
-	
-
-	return result, nil
+	}
 }
@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+// A link whose #fragment does not match any id or name on the target document
+type BrokenAnchor struct {
+	URL       string `json:"url"`
+	Text      string `json:"text,omitempty"`
+	Fragment  string `json:"fragment"`
+	TargetURL string `json:"target_url"` // the document the fragment should be on
+	SamePage  bool   `json:"same_page"`
+	Reason    string `json:"reason"` // missing_anchor or target_unavailable
+	Detail    string `json:"detail,omitempty"`
+}
+
+// A link with a fragment, collected while the page is parsed
+type fragmentLink struct {
+	url  *url.URL
+	text string
+}
+
+// Default number of other pages fetched to verify cross-page fragments, ANCHOR_CHECK_MAX_PAGES overrides it
+const defaultAnchorMaxPages = 20
+
+// Number of target pages fetched in parallel
+const anchorFetchWorkers = 4
+
+// Largest target page read when looking for anchors
+const anchorMaxBytes = 5 * 1024 * 1024
+
+// Every id, plus the name of <a> elements (the legacy way of declaring an anchor)
+func collectAnchorIDs(doc *goquery.Selection) map[string]bool {
+	ids := map[string]bool{}
+	doc.Find("[id]").Each(func(_ int, s *goquery.Selection) {
+		if id, _ := s.Attr("id"); id != "" {
+			ids[id] = true
+		}
+	})
+	doc.Find("a[name]").Each(func(_ int, s *goquery.Selection) {
+		if name, _ := s.Attr("name"); name != "" {
+			ids[name] = true
+		}
+	})
+	return ids
+}
+
+// Fragments that never point to an element: empty and #top scroll to the top, #! and #/ are client-side routes, #:~: is a text fragment
+func ignoredFragment(fragment string) bool {
+	return fragment == "" ||
+		strings.EqualFold(fragment, "top") ||
+		strings.HasPrefix(fragment, "!") ||
+		strings.HasPrefix(fragment, "/") ||
+		strings.HasPrefix(fragment, ":~:")
+}
+
+// Check each fragment link against the anchors of its target document. Same-page links use pageIDs,
+// links to other pages of the same host are verified by fetching those pages (each at most once)
+func checkFragmentLinks(pageURL *url.URL, pageIDs map[string]bool, links []fragmentLink, client *http.Client) []BrokenAnchor {
+	broken := []BrokenAnchor{}
+	pageDocument := documentURL(pageURL)
+
+	// Group the cross-page links by target document so every page is fetched once
+	targets := map[string][]fragmentLink{}
+	var order []string
+	for _, link := range links {
+		target := documentURL(link.url)
+		if target == pageDocument {
+			if !pageIDs[link.url.Fragment] {
+				broken = append(broken, BrokenAnchor{
+					URL:       link.url.String(),
+					Text:      link.text,
+					Fragment:  link.url.Fragment,
+					TargetURL: target,
+					SamePage:  true,
+					Reason:    "missing_anchor",
+				})
+			}
+			continue
+		}
+		// Fragments on other sites are not ours to check
+		if !strings.EqualFold(link.url.Hostname(), pageURL.Hostname()) {
+			continue
+		}
+		if _, ok := targets[target]; !ok {
+			order = append(order, target)
+		}
+		targets[target] = append(targets[target], link)
+	}
+
+	maxPages := int(envInt64("ANCHOR_CHECK_MAX_PAGES", defaultAnchorMaxPages))
+	if len(order) > maxPages {
+		order = order[:maxPages]
+	}
+
+	anchors := fetchAnchorTargets(client, order)
+	for _, target := range order {
+		found := anchors[target]
+		for _, link := range targets[target] {
+			anchor := BrokenAnchor{
+				URL:       link.url.String(),
+				Text:      link.text,
+				Fragment:  link.url.Fragment,
+				TargetURL: target,
+			}
+			switch {
+			case found.err != nil:
+				anchor.Reason = "target_unavailable"
+				anchor.Detail = found.err.Error()
+			case found.ids == nil:
+				// Not an HTML document (a PDF #page=2 for example), nothing to verify
+				continue
+			case !found.ids[link.url.Fragment]:
+				anchor.Reason = "missing_anchor"
+			default:
+				continue
+			}
+			broken = append(broken, anchor)
+		}
+	}
+	return broken
+}
+
+// The URL without its fragment, which is what identifies the document
+func documentURL(u *url.URL) string {
+	document := *u
+	document.Fragment = ""
+	document.RawFragment = ""
+	return document.String()
+}
+
+type anchorTarget struct {
+	ids map[string]bool // nil when the target is not HTML
+	err error
+}
+
+// Fetch the target pages with a small worker pool and collect their anchors
+func fetchAnchorTargets(client *http.Client, targets []string) map[string]anchorTarget {
+	found := make(map[string]anchorTarget, len(targets))
+	var mu sync.Mutex
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+
+	for w := 0; w < anchorFetchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				ids, err := fetchAnchorIDs(client, target)
+				mu.Lock()
+				found[target] = anchorTarget{ids: ids, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, target := range targets {
+		jobs <- target
+	}
+	close(jobs)
+	wg.Wait()
+	return found
+}
+
+func fetchAnchorIDs(client *http.Client, target string) (map[string]bool, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(strings.ToLower(contentType), "html") {
+		return nil, nil
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, anchorMaxBytes), contentType)
+	if err != nil {
+		return nil, err
+	}
+	root, err := html.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return collectAnchorIDs(goquery.NewDocumentFromNode(root).Selection), nil
+}
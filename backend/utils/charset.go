@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"bytes"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/saintfish/chardet"
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// How the page was decoded, and whether the declarations and the content agree
+type CharsetReport struct {
+	HeaderCharset      string   `json:"header_charset,omitempty"`
+	MetaCharset        string   `json:"meta_charset,omitempty"`
+	BOMCharset         string   `json:"bom_charset,omitempty"`
+	DetectedCharset    string   `json:"detected_charset,omitempty"`
+	DetectedConfidence int      `json:"detected_confidence,omitempty"`
+	UsedCharset        string   `json:"used_charset"`
+	Source             string   `json:"source"` // bom, header, meta, detected or default
+	Transcoded         bool     `json:"transcoded"`
+	Mismatch           bool     `json:"mismatch"`
+	Notes              []string `json:"notes,omitempty"`
+}
+
+// <meta charset="x"> and <meta http-equiv="Content-Type" content="text/html; charset=x">
+var metaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_:.\-]+)`)
+
+// Only the start of the document is searched for a meta charset, like browsers do
+const metaCharsetPrescanBytes = 2048
+
+// x-user-defined maps every byte to its own code point, so colly decoding the body with it loses nothing
+// and restoreRawBody gets the original bytes back. A byte order mark would make colly ignore it, the tracer
+// takes the mark off first (see traceTransport.holdBOM)
+const rawBodyEncoding = "x-user-defined"
+
+// Sniffing results below this confidence are not trusted over the fallback
+const minDetectConfidence = 50
+
+// Decode the body into UTF-8. The encoding is taken from the BOM, the Content-Type header or the meta tag (in that order, as in browsers),
+// unless the declared UTF-8 is not valid UTF-8; without a usable declaration the encoding is sniffed
+func normalizeCharset(body []byte, contentType string) ([]byte, *CharsetReport) {
+	report := &CharsetReport{}
+
+	if _, params, err := mime.ParseMediaType(contentType); err == nil && params["charset"] != "" {
+		report.HeaderCharset = canonicalCharset(params["charset"])
+	}
+	prescan := body
+	if len(prescan) > metaCharsetPrescanBytes {
+		prescan = prescan[:metaCharsetPrescanBytes]
+	}
+	if m := metaCharsetPattern.FindSubmatch(prescan); m != nil {
+		report.MetaCharset = canonicalCharset(string(m[1]))
+	}
+	report.BOMCharset = bomCharset(body)
+
+	// Sniff the content as well, it tells us when a declaration is wrong
+	if result, err := chardet.NewHtmlDetector().DetectBest(body); err == nil && result != nil {
+		report.DetectedCharset = canonicalCharset(result.Charset)
+		report.DetectedConfidence = result.Confidence
+	}
+
+	validUTF8 := utf8.Valid(body)
+	switch {
+	case report.BOMCharset != "":
+		report.UsedCharset, report.Source = report.BOMCharset, "bom"
+	case report.HeaderCharset != "" && (report.HeaderCharset != "utf-8" || validUTF8):
+		report.UsedCharset, report.Source = report.HeaderCharset, "header"
+	case report.MetaCharset != "" && (report.MetaCharset != "utf-8" || validUTF8):
+		report.UsedCharset, report.Source = report.MetaCharset, "meta"
+	case validUTF8:
+		report.UsedCharset, report.Source = "utf-8", "detected"
+	case report.DetectedCharset != "" && report.DetectedConfidence >= minDetectConfidence:
+		report.UsedCharset, report.Source = report.DetectedCharset, "detected"
+	default:
+		// The HTML standard falls back to windows-1252 for unlabelled legacy pages
+		report.UsedCharset, report.Source = "windows-1252", "default"
+	}
+
+	if (report.HeaderCharset == "utf-8" || report.MetaCharset == "utf-8") && !validUTF8 {
+		report.Notes = append(report.Notes, "declared UTF-8 but the content is not valid UTF-8")
+	}
+	if report.HeaderCharset != "" && report.MetaCharset != "" && report.HeaderCharset != report.MetaCharset {
+		report.Notes = append(report.Notes, "Content-Type header declares "+report.HeaderCharset+" but the meta tag declares "+report.MetaCharset)
+	}
+	declared := report.HeaderCharset
+	if declared == "" {
+		declared = report.MetaCharset
+	}
+	// Pure ASCII reads the same in every ASCII-compatible charset, and valid UTF-8 declared as UTF-8 needs no second opinion
+	sniffable := !isASCII(body) && !(declared == "utf-8" && validUTF8)
+	if declared == "" {
+		report.Notes = append(report.Notes, "no charset declared")
+	} else if sniffable && report.DetectedConfidence >= minDetectConfidence && report.DetectedCharset != declared {
+		report.Notes = append(report.Notes, "declared "+declared+" but the content looks like "+report.DetectedCharset)
+	}
+	report.Mismatch = declared != "" && len(report.Notes) > 0
+
+	decoded, ok := decodeCharset(body, report.UsedCharset)
+	if !ok {
+		report.Notes = append(report.Notes, "unsupported charset "+report.UsedCharset+", content kept as is")
+		return bytes.ToValidUTF8(body, []byte("�")), report
+	}
+	report.Transcoded = report.UsedCharset != "utf-8"
+	return decoded, report
+}
+
+// Transcode body from the named charset to UTF-8. Invalid sequences become U+FFFD so the text is always safe for utf8mb4 columns
+func decodeCharset(body []byte, name string) ([]byte, bool) {
+	if name == "utf-8" {
+		body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+		return bytes.ToValidUTF8(body, []byte("�")), true
+	}
+
+	enc, _ := charset.Lookup(name)
+	if enc == nil {
+		return nil, false
+	}
+	decoded, _, err := transform.Bytes(unicode.BOMOverride(enc.NewDecoder()), body)
+	if err != nil {
+		return nil, false
+	}
+	return bytes.ToValidUTF8(decoded, []byte("�")), true
+}
+
+// Map any charset label (Shift_JIS, sjis, latin1, GB-18030, ...) to its WHATWG name, or a lowercase label when it is unknown
+func canonicalCharset(label string) string {
+	label = strings.ToLower(strings.Trim(strings.TrimSpace(label), `"'`))
+	if _, name := charset.Lookup(label); name != "" {
+		return name
+	}
+	// chardet writes some names with extra dashes (GB-18030, ISO-2022-JP is fine)
+	if _, name := charset.Lookup(strings.ReplaceAll(label, "-", "")); name != "" {
+		return name
+	}
+	return label
+}
+
+func bomCharset(body []byte) string {
+	switch {
+	case bytes.HasPrefix(body, []byte("\xef\xbb\xbf")):
+		return "utf-8"
+	case bytes.HasPrefix(body, []byte("\xfe\xff")):
+		return "utf-16be"
+	case bytes.HasPrefix(body, []byte("\xff\xfe")):
+		return "utf-16le"
+	default:
+		return ""
+	}
+}
+
+func isASCII(body []byte) bool {
+	for _, b := range body {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// HTML, XML and other text responses are decoded, binary responses are left alone
+func isTextContent(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/") || strings.Contains(mediaType, "html") || strings.Contains(mediaType, "xml")
+}
+
+// Undo colly's x-user-defined decoding and put the byte order mark the tracer held back in front, to get the bytes as they were sent
+func restoreRawBody(bom, body []byte) []byte {
+	raw, _, err := transform.Bytes(charmap.XUserDefined.NewEncoder(), body)
+	if err != nil {
+		raw = body
+	}
+	return append(append([]byte(nil), bom...), raw...)
+}
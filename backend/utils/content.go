@@ -0,0 +1,292 @@
+package utils
+
+import (
+	"bytes"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Frequency of a term in the main text
+type TermDensity struct {
+	Term    string  `json:"term"`
+	Count   int     `json:"count"`
+	Density float64 `json:"density"` // percent of all words
+}
+
+// Content analysis type structure
+type ContentAnalysis struct {
+	WordCount        int           `json:"word_count"`
+	SentenceCount    int           `json:"sentence_count"`
+	TextLength       int           `json:"text_length"`
+	TextToHTMLRatio  float64       `json:"text_to_html_ratio"` // percent
+	ReadingEase      float64       `json:"reading_ease"`       // Flesch reading ease, 0-100, higher is easier
+	ReadingLevel     string        `json:"reading_level"`
+	DeclaredLanguage string        `json:"declared_language,omitempty"`
+	DetectedLanguage string        `json:"detected_language,omitempty"`
+	LanguageMismatch bool          `json:"language_mismatch"`
+	TopTerms         []TermDensity `json:"top_terms"`
+	ThinContent      bool          `json:"thin_content"`
+	MainText         string        `json:"-"`
+}
+
+// Pages with fewer words than this are reported as thin content
+const thinContentWords = 300
+
+// Number of terms returned in TopTerms
+const topTermsLimit = 10
+
+// Elements that hold block level text, words in neighbouring blocks must not be glued together
+var blockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "td": true, "th": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "main": true, "blockquote": true, "pre": true,
+	"dd": true, "dt": true, "figcaption": true, "title": true,
+}
+
+// Analyze the main text the streaming scan took from the page. lang is the declared language and htmlSize the length of the page source
+func analyzeMainText(text string, lang string, htmlSize int) *ContentAnalysis {
+	analysis := &ContentAnalysis{TopTerms: []TermDensity{}}
+	analysis.DeclaredLanguage = lang
+	analysis.MainText = text
+	analysis.TextLength = len(text)
+	if htmlSize > 0 {
+		analysis.TextToHTMLRatio = round2(float64(len(text)) / float64(htmlSize) * 100)
+	}
+
+	words := tokenizeWords(text)
+	analysis.WordCount = len(words)
+	analysis.SentenceCount = countSentences(text)
+	analysis.ThinContent = analysis.WordCount < thinContentWords
+	if analysis.WordCount == 0 {
+		return analysis
+	}
+
+	// Flesch reading ease, the syllable heuristic is tuned for English but gives a usable relative score for other Latin-script languages
+	syllables := 0
+	for _, word := range words {
+		syllables += countSyllables(word)
+	}
+	sentences := max(analysis.SentenceCount, 1)
+	ease := 206.835 - 1.015*(float64(len(words))/float64(sentences)) - 84.6*(float64(syllables)/float64(len(words)))
+	analysis.ReadingEase = round2(math.Max(0, math.Min(100, ease)))
+	analysis.ReadingLevel = readingLevel(analysis.ReadingEase)
+
+	analysis.DetectedLanguage = detectLanguage(words)
+	if analysis.DeclaredLanguage != "" && analysis.DetectedLanguage != "" {
+		declared := strings.SplitN(strings.ReplaceAll(analysis.DeclaredLanguage, "_", "-"), "-", 2)[0]
+		analysis.LanguageMismatch = declared != analysis.DetectedLanguage
+	}
+
+	analysis.TopTerms = topTerms(words, analysis.DetectedLanguage)
+	return analysis
+}
+
+// The visible text of a page as it is collected. The end of a block element ends a sentence, unless no text came since the
+// last one: empty cells, nested blocks and empty paragraphs add no stray periods
+type mainText struct {
+	sb      strings.Builder
+	hasText bool
+	// Blocks separate words, the space is written before the next text so a period can still follow the last word
+	space bool
+}
+
+func (t *mainText) WriteString(text string) {
+	t.Write([]byte(text))
+}
+
+// Trailing white space is held back like the space after a block, so the period of the block follows the last word
+func (t *mainText) Write(text []byte) {
+	trimmed := bytes.TrimRightFunc(text, unicode.IsSpace)
+	if len(trimmed) > 0 {
+		t.separate()
+		t.sb.Write(trimmed)
+		t.hasText = true
+	}
+	if len(trimmed) < len(text) {
+		t.space = true
+	}
+}
+
+func (t *mainText) separate() {
+	if t.space {
+		t.sb.WriteString(" ")
+		t.space = false
+	}
+}
+
+func (t *mainText) startBlock() {
+	t.space = true
+}
+
+func (t *mainText) endBlock() {
+	if t.hasText {
+		t.sb.WriteString(".")
+		t.hasText = false
+	}
+	t.space = true
+}
+
+// The text with runs of white space collapsed
+func (t *mainText) String() string {
+	return strings.Join(strings.Fields(t.sb.String()), " ")
+}
+
+// Split text into lowercase words, keeping letters and digits only
+func tokenizeWords(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	words := fields[:0]
+	for _, field := range fields {
+		field = strings.Trim(field, "'")
+		if field != "" && strings.IndexFunc(field, unicode.IsLetter) >= 0 {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// Count sentences by their terminating punctuation. Block elements add a period in mainText so headings and list items count too, runs of punctuation count once
+func countSentences(text string) int {
+	count := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case r == '.' || r == '!' || r == '?' || r == '。':
+			if inWord {
+				count++
+			}
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			inWord = true
+		}
+	}
+	if inWord {
+		count++
+	}
+	return count
+}
+
+// Approximate syllables as groups of vowels, ignoring a silent trailing e
+func countSyllables(word string) int {
+	count := 0
+	prevVowel := false
+	runes := []rune(word)
+	for _, r := range runes {
+		vowel := strings.ContainsRune("aeiouyáéíóúàèìòùâêîôûäëïöüåæøœıə", r)
+		if vowel && !prevVowel {
+			count++
+		}
+		prevVowel = vowel
+	}
+	if len(runes) > 2 && runes[len(runes)-1] == 'e' && count > 1 && !strings.ContainsRune("aeiouy", runes[len(runes)-2]) {
+		count--
+	}
+	return max(count, 1)
+}
+
+func readingLevel(ease float64) string {
+	switch {
+	case ease >= 90:
+		return "very easy"
+	case ease >= 70:
+		return "easy"
+	case ease >= 60:
+		return "standard"
+	case ease >= 50:
+		return "fairly difficult"
+	case ease >= 30:
+		return "difficult"
+	default:
+		return "very difficult"
+	}
+}
+
+// Most frequent words, leaving out stop words of the detected language and very short words
+func topTerms(words []string, language string) []TermDensity {
+	stop := stopWords[language]
+	counts := map[string]int{}
+	for _, word := range words {
+		if len([]rune(word)) < 3 || stop[word] || englishStopWords[word] {
+			continue
+		}
+		counts[word]++
+	}
+
+	terms := make([]TermDensity, 0, len(counts))
+	for term, count := range counts {
+		terms = append(terms, TermDensity{
+			Term:    term,
+			Count:   count,
+			Density: round2(float64(count) / float64(len(words)) * 100),
+		})
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if terms[i].Count != terms[j].Count {
+			return terms[i].Count > terms[j].Count
+		}
+		return terms[i].Term < terms[j].Term
+	})
+	if len(terms) > topTermsLimit {
+		terms = terms[:topTermsLimit]
+	}
+	return terms
+}
+
+// Guess the language by which stop word list covers the most words. Returns an empty string when the text is too short or nothing stands out
+func detectLanguage(words []string) string {
+	if len(words) < 20 {
+		return ""
+	}
+
+	best, bestHits, secondHits := "", 0, 0
+	for language, list := range stopWords {
+		hits := 0
+		for _, word := range words {
+			if list[word] {
+				hits++
+			}
+		}
+		if hits > bestHits || (hits == bestHits && language < best) {
+			best, bestHits, secondHits = language, hits, bestHits
+		} else if hits > secondHits {
+			secondHits = hits
+		}
+	}
+
+	// At least 5% of the words must be stop words and the winner must be clearly ahead
+	if bestHits*20 < len(words) || bestHits == secondHits {
+		return ""
+	}
+	return best
+}
+
+func round2(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+func wordSet(words string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(words) {
+		set[word] = true
+	}
+	return set
+}
+
+var englishStopWords = wordSet("the and for are but not you all any can had her was one our out has him his how its may new now old see two who did get let put say she too use that with have this will your from they know want been good much some time very when come here just like long make many more only over such take than them well were what about after again also back because before being between both could down each even first into most other should still their there these those through under where which while would")
+
+// Common words per ISO 639-1 language code, used for language detection and to leave filler words out of the top terms
+var stopWords = map[string]map[string]bool{
+	"en": englishStopWords,
+	"de": wordSet("der die das und ist nicht sie ich mit sich des auf für von den dem ein eine einer eines zu im auch als wie bei oder aus nach noch wird werden hat sind war wir ihr sein kann nur über durch dass aber wenn schon"),
+	"fr": wordSet("le la les et est des une un du en que qui dans pour pas sur par au aux avec ce cette son sa ses il elle nous vous ils sont mais ou plus être avoir fait comme tout leur"),
+	"es": wordSet("el la los las y es de del en que un una por con para se no su sus al lo como más pero este esta son está ha fue ser muy también hay entre sobre todo"),
+	"it": wordSet("il lo la le gli e è di del della che un una per con non si da in al alla sono come più ma anche questo questa nel nella dei delle ha essere tutto"),
+	"nl": wordSet("de het een en van is dat die in op te met voor zijn niet aan er maar om ook als bij nog wordt door naar dan wel uit tot kan deze"),
+	"pt": wordSet("o a os as e é de do da dos das em que um uma para com não por se no na mais como mas foi ao ele ela são também seu sua pelo pela"),
+	"tr": wordSet("ve bir bu da de için ile çok daha olan olarak gibi ama en her şey ne var mı mi değil ben sen biz siz onlar kadar sonra önce veya ya"),
+	"sv": wordSet("och i att det som en är på för med av till den har de inte om ett men var jag så eller kan vi från när alla"),
+	"pl": wordSet("i w na z nie się do to że jest o jak po co ale od tak za przez dla jego jej są być może już tylko"),
+}
@@ -0,0 +1,294 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// What kind of document the analyzed URL returned, the frontend picks the view from it
+const (
+	ResultKindHTML  = "html"
+	ResultKindPDF   = "pdf"
+	ResultKindImage = "image"
+	ResultKindFeed  = "feed"
+	ResultKindJSON  = "json"
+	ResultKindXML   = "xml"
+	ResultKindOther = "other"
+)
+
+// Metadata of a non-HTML document. Only the fields of its kind are filled
+type DocumentInfo struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Title       string `json:"title,omitempty"`
+	// PDF
+	PageCount int      `json:"page_count,omitempty"`
+	Links     []string `json:"links,omitempty"`
+	// Image
+	Format string `json:"format,omitempty"` // png, jpeg, gif, webp, bmp, tiff or svg
+	Width  int    `json:"width,omitempty"`
+	Height int    `json:"height,omitempty"`
+	// Feed (rss or atom)
+	FeedFormat string `json:"feed_format,omitempty"`
+	ItemCount  int    `json:"item_count,omitempty"`
+	// XML and JSON
+	RootElement string `json:"root_element,omitempty"`
+	JSONType    string `json:"json_type,omitempty"` // object, array, string, number, boolean or null
+	Error       string `json:"error,omitempty"`
+}
+
+// Classify the response by its Content-Type, sniffing the body when the header is missing or generic
+func resultKind(contentType string, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType == "" || mediaType == "application/octet-stream" || mediaType == "text/plain" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+		// DetectContentType does not know JSON
+		if mediaType == "text/plain" && json.Valid(body) {
+			return ResultKindJSON
+		}
+	}
+
+	switch {
+	case strings.Contains(mediaType, "html"):
+		return ResultKindHTML
+	case mediaType == "application/pdf":
+		return ResultKindPDF
+	case strings.HasPrefix(mediaType, "image/"):
+		return ResultKindImage
+	case mediaType == "application/rss+xml" || mediaType == "application/atom+xml":
+		return ResultKindFeed
+	case strings.HasSuffix(mediaType, "json"):
+		return ResultKindJSON
+	case strings.HasSuffix(mediaType, "xml"):
+		// Many feeds are served as plain text/xml or application/xml
+		switch xmlRootElement(body) {
+		case "rss", "feed", "RDF":
+			return ResultKindFeed
+		}
+		return ResultKindXML
+	default:
+		return ResultKindOther
+	}
+}
+
+// Collect the metadata of a non-HTML document of the given kind
+func analyzeDocument(kind, contentType string, body []byte) *DocumentInfo {
+	info := &DocumentInfo{
+		ContentType: contentType,
+		Size:        int64(len(body)),
+	}
+
+	switch kind {
+	case ResultKindPDF:
+		analyzePDF(info, body)
+	case ResultKindImage:
+		analyzeImage(info, body)
+	case ResultKindFeed:
+		analyzeFeed(info, body)
+	case ResultKindXML:
+		info.RootElement = xmlRootElement(body)
+		if info.RootElement == "" {
+			info.Error = "not well-formed XML"
+		}
+	case ResultKindJSON:
+		analyzeJSON(info, body)
+	}
+	return info
+}
+
+// Title from the document information dictionary, page count and the URI link annotations of every page
+func analyzePDF(info *DocumentInfo, body []byte) {
+	// The PDF reader panics on some malformed files instead of returning an error
+	defer func() {
+		if r := recover(); r != nil {
+			info.Error = fmt.Sprintf("unreadable PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		info.Error = err.Error()
+		return
+	}
+
+	info.Title = strings.TrimSpace(reader.Trailer().Key("Info").Key("Title").Text())
+	info.PageCount = reader.NumPage()
+
+	seen := map[string]bool{}
+	for i := 1; i <= info.PageCount; i++ {
+		annots := reader.Page(i).V.Key("Annots")
+		for j := 0; j < annots.Len(); j++ {
+			annot := annots.Index(j)
+			if annot.Key("Subtype").Name() != "Link" {
+				continue
+			}
+			uri := strings.TrimSpace(annot.Key("A").Key("URI").RawString())
+			if uri != "" && !seen[uri] {
+				seen[uri] = true
+				info.Links = append(info.Links, uri)
+			}
+		}
+	}
+}
+
+// Format and dimensions from the image header, SVG sizes come from its width, height or viewBox attributes
+func analyzeImage(info *DocumentInfo, body []byte) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err == nil {
+		info.Format, info.Width, info.Height = format, config.Width, config.Height
+		return
+	}
+	if xmlRootElement(body) == "svg" {
+		info.Format = "svg"
+		info.Width, info.Height = svgSize(body)
+		return
+	}
+	info.Error = "unsupported image format"
+}
+
+func svgSize(body []byte) (int, int) {
+	decoder := newXMLDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return 0, 0
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var width, height int
+		var viewBox string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = svgLength(attr.Value)
+			case "height":
+				height = svgLength(attr.Value)
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
+		// Without explicit sizes the viewBox (min-x min-y width height) defines them
+		if (width == 0 || height == 0) && viewBox != "" {
+			if fields := strings.Fields(strings.ReplaceAll(viewBox, ",", " ")); len(fields) == 4 {
+				width, height = svgLength(fields[2]), svgLength(fields[3])
+			}
+		}
+		return width, height
+	}
+}
+
+// "120", "120px" or "120.5" as whole pixels, relative units such as % or em are not resolved
+func svgLength(value string) int {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return int(number)
+}
+
+// Feed title and the number of RSS items or Atom entries
+func analyzeFeed(info *DocumentInfo, body []byte) {
+	decoder := newXMLDecoder(body)
+	depth := 0
+	inTitle := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			info.Error = err.Error()
+			break
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "rss", "RDF":
+				info.FeedFormat = "rss"
+			case "feed":
+				if depth == 1 {
+					info.FeedFormat = "atom"
+				}
+			case "item", "entry":
+				info.ItemCount++
+			case "title":
+				// The feed title is the first title, before any item or entry
+				inTitle = info.Title == "" && info.ItemCount == 0
+			}
+		case xml.EndElement:
+			depth--
+			inTitle = false
+		case xml.CharData:
+			if inTitle {
+				info.Title += strings.TrimSpace(string(t))
+			}
+		}
+	}
+}
+
+// The top-level JSON value type, or an error when the body is not valid JSON
+func analyzeJSON(info *DocumentInfo, body []byte) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		info.Error = "invalid JSON: " + err.Error()
+		return
+	}
+	switch value.(type) {
+	case map[string]interface{}:
+		info.JSONType = "object"
+	case []interface{}:
+		info.JSONType = "array"
+	case string:
+		info.JSONType = "string"
+	case float64:
+		info.JSONType = "number"
+	case bool:
+		info.JSONType = "boolean"
+	default:
+		info.JSONType = "null"
+	}
+}
+
+// Local name of the first element, or an empty string when the body is not XML
+func xmlRootElement(body []byte) string {
+	decoder := newXMLDecoder(body)
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// The body has already been transcoded to UTF-8, so the encoding in the XML declaration is ignored
+func newXMLDecoder(body []byte) *xml.Decoder {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	return decoder
+}
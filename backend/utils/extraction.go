@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+// Selector types of an extraction rule
+const (
+	SelectorCSS   = "css"
+	SelectorXPath = "xpath"
+)
+
+// A user-defined field to pull out of each page
+type ExtractionRule struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	SelectorType string `json:"selector_type"` // css or xpath
+	Selector     string `json:"selector"`
+	Attribute    string `json:"attribute,omitempty"` // empty means the text content
+	Multiple     bool   `json:"multiple"`            // keep every match instead of only the first
+}
+
+// Check that the rule can be compiled before it is saved
+func ValidateExtractionRule(rule ExtractionRule) error {
+	if strings.TrimSpace(rule.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if strings.TrimSpace(rule.Selector) == "" {
+		return fmt.Errorf("selector is required")
+	}
+	// Lengths of the extraction_rules columns
+	if utf8.RuneCountInString(rule.Name) > 100 {
+		return fmt.Errorf("name must be at most 100 characters")
+	}
+	if utf8.RuneCountInString(rule.Selector) > 1024 {
+		return fmt.Errorf("selector must be at most 1024 characters")
+	}
+	if utf8.RuneCountInString(rule.Attribute) > 100 {
+		return fmt.Errorf("attribute must be at most 100 characters")
+	}
+
+	switch rule.SelectorType {
+	case SelectorCSS:
+		if _, err := cascadia.Compile(rule.Selector); err != nil {
+			return fmt.Errorf("invalid CSS selector: %v", err)
+		}
+	case SelectorXPath:
+		if _, err := xpath.Compile(rule.Selector); err != nil {
+			return fmt.Errorf("invalid XPath expression: %v", err)
+		}
+	default:
+		return fmt.Errorf("selector_type must be %q or %q", SelectorCSS, SelectorXPath)
+	}
+	return nil
+}
+
+// Apply the rules to the document and return the values per rule name. A rule that matches nothing maps to an empty list
+func extractFields(doc *goquery.Selection, rules []ExtractionRule) map[string][]string {
+	extracted := map[string][]string{}
+	if len(doc.Nodes) == 0 {
+		return extracted
+	}
+
+	for _, rule := range rules {
+		var values []string
+		switch rule.SelectorType {
+		case SelectorCSS:
+			values = extractCSS(doc, rule)
+		case SelectorXPath:
+			values = extractXPath(doc.Nodes[0], rule)
+		}
+
+		if !rule.Multiple && len(values) > 1 {
+			values = values[:1]
+		}
+		if values == nil {
+			values = []string{}
+		}
+		extracted[rule.Name] = values
+	}
+	return extracted
+}
+
+func extractCSS(doc *goquery.Selection, rule ExtractionRule) []string {
+	selector, err := cascadia.Compile(rule.Selector)
+	if err != nil {
+		return nil
+	}
+
+	var values []string
+	doc.FindMatcher(selector).Each(func(_ int, s *goquery.Selection) {
+		if value, ok := selectionValue(s, rule.Attribute); ok {
+			values = append(values, value)
+		}
+	})
+	return values
+}
+
+func selectionValue(s *goquery.Selection, attribute string) (string, bool) {
+	if attribute == "" {
+		return strings.Join(strings.Fields(s.Text()), " "), true
+	}
+	value, ok := s.Attr(attribute)
+	return strings.TrimSpace(value), ok
+}
+
+// XPath expressions can select nodes or compute a value such as count(//a) or string(//h1)
+func extractXPath(root *html.Node, rule ExtractionRule) []string {
+	expr, err := xpath.Compile(rule.Selector)
+	if err != nil {
+		return nil
+	}
+
+	switch result := expr.Evaluate(htmlquery.CreateXPathNavigator(root)).(type) {
+	case *xpath.NodeIterator:
+		var values []string
+		for result.MoveNext() {
+			node := result.Current().(*htmlquery.NodeNavigator).Current()
+			// An attribute step like //meta/@content lands on the attribute itself
+			if result.Current().NodeType() == xpath.AttributeNode {
+				values = append(values, strings.TrimSpace(result.Current().Value()))
+				continue
+			}
+			if rule.Attribute != "" {
+				if htmlquery.ExistsAttr(node, rule.Attribute) {
+					values = append(values, strings.TrimSpace(htmlquery.SelectAttr(node, rule.Attribute)))
+				}
+				continue
+			}
+			values = append(values, strings.Join(strings.Fields(htmlquery.InnerText(node)), " "))
+		}
+		return values
+	case string:
+		return []string{strings.TrimSpace(result)}
+	case float64:
+		return []string{strconv.FormatFloat(result, 'f', -1, 64)}
+	case bool:
+		return []string{strconv.FormatBool(result)}
+	default:
+		return nil
+	}
+}
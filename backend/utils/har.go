@@ -0,0 +1,323 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// HAR 1.2 (http://www.softwareishard.com/blog/har-12-spec/) of an analysis, readable by browser devtools and HAR viewers.
+// Bodies are left out, the snapshot and the WARC file of the run have them
+
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Pages   []HARPage  `json:"pages"`
+	Entries []HAREntry `json:"entries"`
+}
+
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type HARPage struct {
+	StartedDateTime string         `json:"startedDateTime"`
+	ID              string         `json:"id"`
+	Title           string         `json:"title"`
+	PageTimings     HARPageTimings `json:"pageTimings"`
+}
+
+type HARPageTimings struct {
+	OnContentLoad float64 `json:"onContentLoad"`
+	OnLoad        float64 `json:"onLoad"`
+}
+
+type HAREntry struct {
+	Pageref         string      `json:"pageref,omitempty"`
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	// Set when no response came back (DNS failure, refused connection, timeout)
+	Error string `json:"_error,omitempty"`
+}
+
+type HARContent struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+}
+
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// Timings in milliseconds, -1 when the phase did not happen (a reused connection has no dns or connect)
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+const harPageID = "page_1"
+
+// Build the HAR of an analysis: one page and an entry for every request the collector made, redirects,
+// fetched resources and anchor targets included. Returns nil when nothing was requested
+func BuildHAR(result *AnalysisResult) *HAR {
+	if len(result.exchanges) == 0 {
+		return nil
+	}
+
+	har := &HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "go-react-crawler", Version: "1.0"},
+		Pages:   []HARPage{},
+		Entries: []HAREntry{},
+	}}
+
+	first := result.exchanges[0]
+	page := HARPage{
+		StartedDateTime: harDate(first.start),
+		ID:              harPageID,
+		Title:           strings.TrimSpace(result.Title),
+		PageTimings:     HARPageTimings{OnContentLoad: -1, OnLoad: -1},
+	}
+	if result.Response != nil {
+		page.PageTimings.OnLoad = result.Response.Timing.TotalMs
+	}
+	har.Log.Pages = append(har.Log.Pages, page)
+
+	for _, hop := range result.exchanges {
+		if hop.Request == nil {
+			continue
+		}
+		har.Log.Entries = append(har.Log.Entries, harEntry(hop))
+	}
+	return har
+}
+
+func harEntry(hop *traceHop) HAREntry {
+	req := hop.Request
+	entry := HAREntry{
+		Pageref:         harPageID,
+		StartedDateTime: harDate(hop.start),
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     harCookies(req.Cookies()),
+			Headers:     harHeaders(req.Header),
+			QueryString: []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    0,
+		},
+		Response: HARResponse{
+			Cookies:     []HARCookie{},
+			Headers:     []HARNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, HARNameValue{Name: name, Value: value})
+		}
+	}
+	if host, _, err := net.SplitHostPort(hop.remoteAddr); err == nil {
+		entry.ServerIPAddress = host
+	}
+
+	if resp := hop.Response; resp != nil {
+		entry.Request.HTTPVersion = harProto(resp.Proto)
+		entry.Response.Status = resp.StatusCode
+		entry.Response.StatusText = http.StatusText(resp.StatusCode)
+		entry.Response.HTTPVersion = harProto(resp.Proto)
+		entry.Response.Cookies = harCookies(resp.Cookies())
+		entry.Response.Headers = harHeaders(resp.Header)
+		entry.Response.BodySize = hop.bodyBytes
+		entry.Response.Content = HARContent{
+			Size:     harContentSize(hop),
+			MimeType: resp.Header.Get("Content-Type"),
+		}
+		if compression := entry.Response.Content.Size - hop.bodyBytes; compression > 0 {
+			entry.Response.Content.Compression = compression
+		}
+		// Location as sent, resolved against the request so relative redirects are usable
+		if location := resp.Header.Get("Location"); location != "" {
+			entry.Response.RedirectURL = location
+			if resolved, err := req.URL.Parse(location); err == nil {
+				entry.Response.RedirectURL = resolved.String()
+			}
+		}
+		if hop.bodyTruncated {
+			entry.Comment = "body larger than the export limit, content size is approximate"
+		}
+	} else if hop.err != nil {
+		entry.Response.Error = hop.err.Error()
+	}
+
+	entry.Timings = hop.harTimings()
+	for _, phase := range []float64{entry.Timings.Blocked, entry.Timings.DNS, entry.Timings.Connect, entry.Timings.Send, entry.Timings.Wait, entry.Timings.Receive} {
+		if phase > 0 {
+			entry.Time += phase
+		}
+	}
+	entry.Time = math.Round(entry.Time*1000) / 1000
+	return entry
+}
+
+// Map the recorded timestamps onto the HAR phases. connect includes the TLS handshake, like the spec asks
+func (h *traceHop) harTimings() HARTimings {
+	ms := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return -1
+		}
+		return float64(to.Sub(from).Microseconds()) / 1000
+	}
+
+	timings := HARTimings{
+		DNS:     ms(h.dnsStart, h.dnsDone),
+		Connect: ms(h.connStart, h.connDone),
+		SSL:     ms(h.tlsStart, h.tlsDone),
+		Send:    ms(h.gotConn, h.wroteReq),
+		Wait:    ms(h.wroteReq, h.firstByte),
+		Receive: ms(h.firstByte, h.bodyDone),
+	}
+	if !h.tlsDone.IsZero() && !h.connStart.IsZero() {
+		timings.Connect = ms(h.connStart, h.tlsDone)
+	}
+
+	// Whatever happened before the connection was ready and is not dns or connect is time spent queued
+	timings.Blocked = ms(h.start, h.gotConn)
+	if timings.Blocked >= 0 {
+		for _, phase := range []float64{timings.DNS, timings.Connect} {
+			if phase > 0 {
+				timings.Blocked -= phase
+			}
+		}
+		timings.Blocked = math.Max(math.Round(timings.Blocked*1000)/1000, 0)
+	}
+
+	// HAR requires send, wait and receive to be non-negative
+	for _, phase := range []*float64{&timings.Send, &timings.Wait, &timings.Receive} {
+		if *phase < 0 {
+			*phase = 0
+		}
+	}
+	return timings
+}
+
+// Decoded size of the body. The page itself is fetched with gzip kept, so the size after decompression is counted here
+func harContentSize(hop *traceHop) int64 {
+	if !strings.EqualFold(hop.Response.Header.Get("Content-Encoding"), "gzip") {
+		return hop.bodyBytes
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(hop.body.Bytes()))
+	if err != nil {
+		return hop.bodyBytes
+	}
+	defer gz.Close()
+	// Capped like the analysis itself, a small gzip body can expand to gigabytes
+	size, _ := io.Copy(io.Discard, io.LimitReader(gz, maxBodyBytes()))
+	return size
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			headers = append(headers, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+func harCookies(cookies []*http.Cookie) []HARCookie {
+	harCookies := []HARCookie{}
+	for _, cookie := range cookies {
+		harCookie := HARCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			harCookie.Expires = harDate(cookie.Expires)
+		}
+		harCookies = append(harCookies, harCookie)
+	}
+	return harCookies
+}
+
+func harProto(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+// ISO 8601 with milliseconds, the format HAR viewers expect
+func harDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000Z")
+}
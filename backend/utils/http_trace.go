@@ -0,0 +1,358 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// One response in the chain of redirects that led to the analyzed page
+type RedirectHop struct {
+	URL        string `json:"url"`
+	StatusCode int    `json:"status_code"`
+	Location   string `json:"location,omitempty"`
+}
+
+// Timing breakdown of the final request, all values are in milliseconds
+type TimingBreakdown struct {
+	DNSMs      float64 `json:"dns_ms"`
+	ConnectMs  float64 `json:"connect_ms"`
+	TLSMs      float64 `json:"tls_ms"`
+	TTFBMs     float64 `json:"ttfb_ms"`
+	DownloadMs float64 `json:"download_ms"`
+	TotalMs    float64 `json:"total_ms"`
+}
+
+// HTTP response metadata type structure
+type ResponseMeta struct {
+	FinalURL         string            `json:"final_url"`
+	StatusCode       int               `json:"status_code"`
+	RedirectChain    []RedirectHop     `json:"redirect_chain"`
+	Headers          map[string]string `json:"headers"`
+	ContentType      string            `json:"content_type"`
+	ContentEncoding  string            `json:"content_encoding,omitempty"`
+	CompressedSize   int64             `json:"compressed_size"`
+	UncompressedSize int64             `json:"uncompressed_size"`
+	Timing           TimingBreakdown   `json:"timing"`
+	// The body was cut at the size limit (ANALYZE_MAX_BODY_BYTES), the analysis covers the first part of the page only
+	BodyTruncated bool `json:"body_truncated,omitempty"`
+}
+
+// Everything the transport saw for a single round trip
+type traceHop struct {
+	Request  *http.Request
+	Response *http.Response
+
+	start     time.Time
+	dnsStart  time.Time
+	dnsDone   time.Time
+	connStart time.Time
+	connDone  time.Time
+	tlsStart  time.Time
+	tlsDone   time.Time
+	gotConn   time.Time
+	wroteReq  time.Time
+	firstByte time.Time
+	bodyDone  time.Time
+	bodyBytes int64
+	tlsState  *tls.ConnectionState
+	err       error
+
+	// Raw body as read from the wire (up to exchangeBodyLimit) and the peer address, for the WARC and HAR exports
+	body          bytes.Buffer
+	bodyTruncated bool
+	remoteAddr    string
+	// Byte order mark taken off the start of the body handed to the client, see holdBOM
+	bom []byte
+}
+
+// Largest body kept per exchange for the exports, larger bodies are truncated
+const exchangeBodyLimit = 10 * 1024 * 1024
+
+// traceTransport is handed to colly with WithTransport, so every request of an analysis (including redirects) goes through it
+type traceTransport struct {
+	base http.RoundTripper
+	// Ask for gzip explicitly and keep it, for colly which decompresses by itself
+	requestGzip bool
+	// Hard limit for the decompressed body handed to the client, 0 means no limit
+	maxBodyBytes int64
+	// Take a byte order mark off the body before the client sees it. colly lets a BOM override the encoding it is told
+	// to use, the page would be decoded before normalizeCharset gets its bytes
+	holdBOM bool
+	mu      sync.Mutex
+	hops    []*traceHop
+}
+
+func newTraceTransport() *traceTransport {
+	return &traceTransport{base: http.DefaultTransport.(*http.Transport).Clone(), requestGzip: true, holdBOM: true}
+}
+
+// Tracer for the extra requests of an analysis (resources, anchor targets). Go decompresses these transparently
+func newFetchTracer() *traceTransport {
+	return &traceTransport{base: http.DefaultTransport.(*http.Transport).Clone()}
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	hop := &traceHop{start: time.Now()}
+
+	// Attach an httptrace hook to the request so each phase of the connection gets a timestamp
+	trace := &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { hop.dnsStart = time.Now() },
+		DNSDone:              func(httptrace.DNSDoneInfo) { hop.dnsDone = time.Now() },
+		ConnectStart:         func(string, string) { hop.connStart = time.Now() },
+		ConnectDone:          func(string, string, error) { hop.connDone = time.Now() },
+		TLSHandshakeStart:    func() { hop.tlsStart = time.Now() },
+		TLSHandshakeDone:     func(state tls.ConnectionState, _ error) { hop.tlsDone = time.Now(); hop.tlsState = &state },
+		GotFirstResponseByte: func() { hop.firstByte = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { hop.wroteReq = time.Now() },
+		GotConn: func(info httptrace.GotConnInfo) {
+			hop.gotConn = time.Now()
+			if info.Conn != nil {
+				hop.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+	}
+	req = req.Clone(httptrace.WithClientTrace(req.Context(), trace))
+
+	// Ask for gzip ourselves, then Go does not decompress transparently and we can count the bytes on the wire (colly decompresses gzip itself)
+	if t.requestGzip && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	hop.Request = req
+
+	t.mu.Lock()
+	t.hops = append(t.hops, hop)
+	t.mu.Unlock()
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		hop.err = err
+		return nil, err
+	}
+	hop.Response = resp
+	resp.Body = &countingBody{ReadCloser: resp.Body, hop: hop}
+	if t.maxBodyBytes > 0 {
+		limitBody(hop, resp, t.maxBodyBytes)
+	}
+	if t.holdBOM {
+		resp.Body = &bomHolder{ReadCloser: resp.Body, hop: hop}
+	}
+	return resp, nil
+}
+
+// Body that keeps a leading UTF-8 or UTF-16 byte order mark on the hop instead of passing it on
+type bomHolder struct {
+	io.ReadCloser
+	hop     *traceHop
+	checked bool
+	pending []byte
+}
+
+func (b *bomHolder) Read(p []byte) (int, error) {
+	if !b.checked {
+		b.checked = true
+		head := make([]byte, 3)
+		n, err := io.ReadFull(b.ReadCloser, head)
+		head = head[:n]
+		if bom := bomCharset(head); bom != "" {
+			size := 2
+			if bom == "utf-8" {
+				size = 3
+			}
+			b.hop.bom, head = head[:size], head[size:]
+		}
+		b.pending = head
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return 0, err
+		}
+		if len(b.pending) == 0 && err != nil {
+			return 0, io.EOF
+		}
+	}
+	if len(b.pending) > 0 {
+		n := copy(p, b.pending)
+		b.pending = b.pending[n:]
+		return n, nil
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// Byte order mark held back from the body of the last response
+func (t *traceTransport) heldBOM() []byte {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.hops) == 0 {
+		return nil
+	}
+	return t.hops[len(t.hops)-1].bom
+}
+
+// Cap the body at limit bytes after decompression. A small gzip body can expand to gigabytes, so a gzipped page is decompressed
+// here and the client gets a plain body. The hop keeps its own copy of the headers as they came over the wire
+func limitBody(hop *traceHop, resp *http.Response, limit int64) {
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && !resp.Uncompressed {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			// Not really gzip, let the client fail on it like it would without the limit
+			return
+		}
+		wire := *resp
+		wire.Header = resp.Header.Clone()
+		hop.Response = &wire
+
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+		resp.Body = limitedBody{Reader: io.LimitReader(gz, limit), Closer: resp.Body}
+		return
+	}
+	resp.Body = limitedBody{Reader: io.LimitReader(resp.Body, limit), Closer: resp.Body}
+}
+
+type limitedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// Hops of several tracers in the order the requests started
+func mergeHops(groups ...[]*traceHop) []*traceHop {
+	var merged []*traceHop
+	for _, hops := range groups {
+		merged = append(merged, hops...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].start.Before(merged[j].start)
+	})
+	return merged
+}
+
+// Snapshot of the hops recorded so far
+func (t *traceTransport) Hops() []*traceHop {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*traceHop(nil), t.hops...)
+}
+
+// Build the response metadata for the last request in the chain. uncompressedSize is the length of the body colly handed to the callbacks
+func (t *traceTransport) ResponseMeta(uncompressedSize int64) *ResponseMeta {
+	hops := t.Hops()
+	if len(hops) == 0 {
+		return nil
+	}
+
+	meta := &ResponseMeta{
+		RedirectChain: []RedirectHop{},
+		Headers:       map[string]string{},
+	}
+
+	// Every hop goes into the redirect chain, the final one has no Location
+	for _, hop := range hops {
+		if hop.Response == nil {
+			continue
+		}
+		meta.RedirectChain = append(meta.RedirectChain, RedirectHop{
+			URL:        hop.Request.URL.String(),
+			StatusCode: hop.Response.StatusCode,
+			Location:   hop.Response.Header.Get("Location"),
+		})
+	}
+
+	final := hops[len(hops)-1]
+	meta.FinalURL = final.Request.URL.String()
+	if final.Response != nil {
+		meta.StatusCode = final.Response.StatusCode
+		for name, values := range final.Response.Header {
+			meta.Headers[name] = strings.Join(values, ", ")
+		}
+		meta.ContentType = final.Response.Header.Get("Content-Type")
+		meta.ContentEncoding = final.Response.Header.Get("Content-Encoding")
+	}
+
+	meta.CompressedSize = final.bodyBytes
+	meta.UncompressedSize = uncompressedSize
+	// Without a content encoding the body on the wire is the body we analyzed
+	if meta.ContentEncoding == "" && uncompressedSize == 0 {
+		meta.UncompressedSize = final.bodyBytes
+	}
+
+	meta.Timing = final.timing()
+	return meta
+}
+
+// Convert the recorded timestamps of a hop into durations
+func (h *traceHop) timing() TimingBreakdown {
+	ms := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return 0
+		}
+		return float64(to.Sub(from).Microseconds()) / 1000
+	}
+
+	end := h.bodyDone
+	if end.IsZero() {
+		end = h.firstByte
+	}
+
+	return TimingBreakdown{
+		DNSMs:      ms(h.dnsStart, h.dnsDone),
+		ConnectMs:  ms(h.connStart, h.connDone),
+		TLSMs:      ms(h.tlsStart, h.tlsDone),
+		TTFBMs:     ms(h.start, h.firstByte),
+		DownloadMs: ms(h.firstByte, h.bodyDone),
+		TotalMs:    ms(h.start, end),
+	}
+}
+
+// Response body wrapper that counts the bytes read from the wire and notes when reading finished
+type countingBody struct {
+	io.ReadCloser
+	hop *traceHop
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hop.bodyBytes += int64(n)
+	if room := exchangeBodyLimit - b.hop.body.Len(); room < n {
+		b.hop.body.Write(p[:room])
+		b.hop.bodyTruncated = true
+	} else {
+		b.hop.body.Write(p[:n])
+	}
+	if err == io.EOF && b.hop.bodyDone.IsZero() {
+		b.hop.bodyDone = time.Now()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	if b.hop.bodyDone.IsZero() {
+		b.hop.bodyDone = time.Now()
+	}
+	return b.ReadCloser.Close()
+}
+
+// Headers and cookies of the final response (cookies from the whole chain) combined with what the callbacks collected from the page
+func (t *traceTransport) TechnologyInput(metaGenerator string, scriptSrcs []string, html []byte) technologyInput {
+	input := technologyInput{
+		Headers:       http.Header{},
+		MetaGenerator: metaGenerator,
+		ScriptSrcs:    scriptSrcs,
+		HTML:          html,
+	}
+	for _, hop := range t.Hops() {
+		if hop.Response == nil {
+			continue
+		}
+		input.Headers = hop.Response.Header
+		input.Cookies = append(input.Cookies, hop.Response.Cookies()...)
+	}
+	return input
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Default number of distinct link targets requested per analysis, LINK_CHECK_MAX overrides it. Links beyond it stay unchecked
+const defaultLinkCheckMax = 100
+
+// Number of link targets requested in parallel
+const linkCheckWorkers = 8
+
+type linkCheck struct {
+	status int
+	err    error
+}
+
+// Request the targets of the given links and record the status code, or the error when no response came back, on every
+// link to them. Each document is requested once (the fragment does not count), with HEAD and with GET when HEAD is not allowed
+func checkLinks(client *http.Client, lists ...[]LinkDetail) {
+	var targets []string
+	seen := map[string]bool{}
+	maxTargets := int(envInt64("LINK_CHECK_MAX", defaultLinkCheckMax))
+	for _, links := range lists {
+		for _, link := range links {
+			target, ok := linkCheckTarget(link.URL)
+			if !ok || seen[target] || len(targets) >= maxTargets {
+				continue
+			}
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+
+	checks := make(map[string]linkCheck, len(targets))
+	var mu sync.Mutex
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < linkCheckWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range jobs {
+				status, err := requestLinkTarget(client, target)
+				mu.Lock()
+				checks[target] = linkCheck{status: status, err: err}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, target := range targets {
+		jobs <- target
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, links := range lists {
+		for i := range links {
+			target, _ := linkCheckTarget(links[i].URL)
+			check, ok := checks[target]
+			if !ok {
+				continue
+			}
+			links[i].StatusCode = check.status
+			if check.err != nil {
+				links[i].CheckError = check.err.Error()
+			}
+		}
+	}
+}
+
+// The document an http or https link points to
+func linkCheckTarget(link string) (string, bool) {
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return "", false
+	}
+	return documentURL(parsed), true
+}
+
+// Status code of the target. Servers that refuse HEAD (405, 501) are asked again with GET, the body is not read
+func requestLinkTarget(client *http.Client, target string) (int, error) {
+	status, err := requestLinkStatus(client, http.MethodHead, target)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = requestLinkStatus(client, http.MethodGet, target)
+	}
+	return status, err
+}
+
+func requestLinkStatus(client *http.Client, method, target string) (int, error) {
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
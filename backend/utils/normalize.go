@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Query parameters dropped by NormalizeURL when URL_TRACKING_PARAMS is not set, a trailing * matches any suffix
+var DefaultTrackingParams = []string{
+	"utm_*", "gclid", "dclid", "gbraid", "wbraid", "fbclid", "msclkid", "yclid", "twclid", "igshid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "_hsenc", "_hsmi", "mkt_tok",
+}
+
+// Ports implied by the scheme, dropped from normalized URLs
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// The tracking parameters from URL_TRACKING_PARAMS (comma-separated, same format as DefaultTrackingParams), or the defaults
+func TrackingParamsFromEnv() []string {
+	value := strings.TrimSpace(os.Getenv("URL_TRACKING_PARAMS"))
+	if value == "" {
+		return DefaultTrackingParams
+	}
+	var params []string
+	for _, param := range strings.Split(value, ",") {
+		if param = strings.ToLower(strings.TrimSpace(param)); param != "" {
+			params = append(params, param)
+		}
+	}
+	return params
+}
+
+// NormalizeURL with the tracking parameters of TrackingParamsFromEnv
+func NormalizeURLFromEnv(raw string) (string, error) {
+	return NormalizeURL(raw, TrackingParamsFromEnv())
+}
+
+// The form of an absolute URL used to recognise the same page written differently (RFC 3986 section 6): lowercase scheme
+// and host, IDN hosts in punycode, no user information, no default port, no dot segments, percent-encoding with uppercase
+// hex and only where needed, query parameters sorted and without the tracking ones, no fragment.
+// "HTTP://user@Example.com:80/a/../?utm_source=x" becomes "http://example.com/"
+func NormalizeURL(raw string, trackingParams []string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("%q is not an absolute URL", raw)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", fmt.Errorf("invalid host in %q: %v", raw, err)
+	}
+	if port := u.Port(); port != "" && port != defaultPorts[scheme] {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+
+	var b strings.Builder
+	// Credentials are left out, they do not change the page and must not be stored with the normalized URL
+	b.WriteString(scheme + "://" + host)
+
+	path := removeDotSegments(normalizePercentEncoding(u.EscapedPath()))
+	if path == "" {
+		path = "/"
+	}
+	b.WriteString(path)
+
+	if query := normalizeQuery(u.RawQuery, trackingParams); query != "" {
+		b.WriteString("?" + query)
+	}
+	return b.String(), nil
+}
+
+// Lowercase, without the trailing dot of a fully qualified name, internationalized names in their ASCII (punycode) form
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", fmt.Errorf("empty host")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if strings.Contains(host, ":") {
+			return "[" + ip.String() + "]", nil
+		}
+		return host, nil
+	}
+	return idna.Lookup.ToASCII(host)
+}
+
+// Query parameters sorted by name then value, tracking ones and empty ones dropped
+func normalizeQuery(rawQuery string, trackingParams []string) string {
+	type param struct{ name, pair string }
+	var params []param
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		pair = normalizePercentEncoding(pair)
+		name, _, _ := strings.Cut(pair, "=")
+		decoded, err := url.QueryUnescape(name)
+		if err != nil {
+			decoded = name
+		}
+		if isTrackingParam(strings.ToLower(decoded), trackingParams) {
+			continue
+		}
+		params = append(params, param{name, pair})
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		if params[i].name != params[j].name {
+			return params[i].name < params[j].name
+		}
+		return params[i].pair < params[j].pair
+	})
+
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p.pair
+	}
+	return strings.Join(pairs, "&")
+}
+
+func isTrackingParam(name string, trackingParams []string) bool {
+	for _, tracking := range trackingParams {
+		if prefix, ok := strings.CutSuffix(tracking, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == tracking {
+			return true
+		}
+	}
+	return false
+}
+
+// Decode percent-encoded unreserved characters, uppercase the hex digits of the others and encode bytes that cannot
+// appear as they are
+func normalizePercentEncoding(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			decoded := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(decoded) {
+				b.WriteByte(decoded)
+			} else {
+				b.WriteString("%" + strings.ToUpper(s[i+1:i+3]))
+			}
+			i += 2
+		case c == '%' || c <= ' ' || c >= 0x7f || strings.IndexByte(`"<>\^`+"`{|}", c) >= 0:
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// The remove_dot_segments algorithm of RFC 3986 section 5.2.4
+func removeDotSegments(path string) string {
+	var output []string
+	for path != "" {
+		switch {
+		case strings.HasPrefix(path, "../"):
+			path = path[3:]
+		case strings.HasPrefix(path, "./"):
+			path = path[2:]
+		case strings.HasPrefix(path, "/./"):
+			path = path[2:]
+		case path == "/.":
+			path = "/"
+		case strings.HasPrefix(path, "/../"):
+			path = path[3:]
+			if len(output) > 0 {
+				output = output[:len(output)-1]
+			}
+		case path == "/..":
+			path = "/"
+			if len(output) > 0 {
+				output = output[:len(output)-1]
+			}
+		case path == "." || path == "..":
+			path = ""
+		default:
+			// Move the first segment, with its leading slash, to the output
+			end := strings.IndexByte(path[1:], '/')
+			if end < 0 {
+				output = append(output, path)
+				path = ""
+			} else {
+				output = append(output, path[:end+1])
+				path = path[end+1:]
+			}
+		}
+	}
+	return strings.Join(output, "")
+}
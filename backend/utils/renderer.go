@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// Renderer names, RENDERER selects one of them
+const (
+	RendererStatic = "static"
+	RendererCDP    = "cdp"
+)
+
+// Defaults of the CDP renderer, CDP_TIMEOUT_SECONDS and CDP_SETTLE_MS override them
+const (
+	defaultCDPTimeout = 30 * time.Second
+	defaultCDPSettle  = time.Second
+)
+
+// The document a renderer produced for a URL
+type RenderedPage struct {
+	URL      string `json:"url"`
+	FinalURL string `json:"final_url"` // after redirects and client-side navigation
+	HTML     string `json:"-"`
+}
+
+// A Renderer turns a URL into the HTML of the page after its scripts ran, which is analyzed next to the page as served.
+// The static renderer is no renderer at all, the analysis then only looks at the fetched page
+type Renderer interface {
+	Name() string
+	Render(targetURL string) (*RenderedPage, error)
+}
+
+// Headless Chrome over the Chrome DevTools Protocol. Endpoint is the browser's DevTools address,
+// either http://host:9222 or the ws://host:9222/devtools/browser/... URL from /json/version
+type CDPRenderer struct {
+	Endpoint string
+	// Upper bound for loading and rendering one page
+	Timeout time.Duration
+	// Extra wait after the load event so client-side frameworks can finish rendering
+	Settle time.Duration
+}
+
+func (r CDPRenderer) Name() string {
+	return RendererCDP
+}
+
+func (r CDPRenderer) Render(targetURL string) (*RenderedPage, error) {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = defaultCDPTimeout
+	}
+
+	// Every render gets its own tab in the remote browser, closed again by cancel
+	allocCtx, cancelAlloc := chromedp.NewRemoteAllocator(context.Background(), r.Endpoint)
+	defer cancelAlloc()
+	ctx, cancelTab := chromedp.NewContext(allocCtx)
+	defer cancelTab()
+	ctx, cancelTimeout := context.WithTimeout(ctx, timeout)
+	defer cancelTimeout()
+
+	page := &RenderedPage{URL: targetURL}
+	err := chromedp.Run(ctx,
+		chromedp.Navigate(targetURL),
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		chromedp.Sleep(r.Settle),
+		chromedp.Location(&page.FinalURL),
+		chromedp.OuterHTML("html", &page.HTML, chromedp.ByQuery),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("render with headless browser at %s: %v", r.Endpoint, err)
+	}
+	return page, nil
+}
+
+// The renderer configured with RENDERER (static or cdp) and CDP_ENDPOINT, nil for static. A cdp renderer without an endpoint falls back to static
+func RendererFromEnv() Renderer {
+	return RendererByName(os.Getenv("RENDERER"))
+}
+
+// The cdp renderer configured with CDP_ENDPOINT like RendererFromEnv, or nil for static
+func RendererByName(name string) Renderer {
+	if strings.EqualFold(name, RendererCDP) && os.Getenv("CDP_ENDPOINT") != "" {
+		settle := defaultCDPSettle
+		if ms, err := strconv.Atoi(os.Getenv("CDP_SETTLE_MS")); err == nil && ms >= 0 {
+			settle = time.Duration(ms) * time.Millisecond
+		}
+		return CDPRenderer{
+			Endpoint: os.Getenv("CDP_ENDPOINT"),
+			Timeout:  time.Duration(envInt64("CDP_TIMEOUT_SECONDS", int64(defaultCDPTimeout/time.Second))) * time.Second,
+			Settle:   settle,
+		}
+	}
+	return nil
+}
+
+// One field that came out differently in the static and the rendered analysis
+type RenderDifference struct {
+	Field    string      `json:"field"`
+	Static   interface{} `json:"static"`
+	Rendered interface{} `json:"rendered"`
+}
+
+// The analysis of the rendered DOM, stored next to the static one
+type RenderComparison struct {
+	Renderer    string             `json:"renderer"`
+	FinalURL    string             `json:"final_url,omitempty"`
+	Result      *AnalysisResult    `json:"result,omitempty"`
+	Differences []RenderDifference `json:"differences"`
+	Differs     bool               `json:"differs"`
+	Error       string             `json:"error,omitempty"`
+}
+
+// Render the page with the given renderer and analyze the resulting DOM. Only the markup is analyzed again, what came
+// from the network (resources, fragment targets, technologies) is taken from the static result instead of being fetched twice
+func analyzeRendered(targetURL string, static *AnalysisResult, renderer Renderer, opts AnalyzeOptions) *RenderComparison {
+	comparison := &RenderComparison{Renderer: renderer.Name(), Differences: []RenderDifference{}}
+
+	page, err := renderer.Render(targetURL)
+	if err != nil {
+		comparison.Error = err.Error()
+		return comparison
+	}
+	if page.FinalURL == "" {
+		page.FinalURL = targetURL
+	}
+	comparison.FinalURL = page.FinalURL
+
+	// Links and the base URL resolve against the URL the browser ended up on, internal links are those of the analyzed domain
+	pageURL, err := url.Parse(page.FinalURL)
+	if err != nil {
+		comparison.Error = err.Error()
+		return comparison
+	}
+	domain := pageURL.Host
+	if target, err := url.Parse(targetURL); err == nil {
+		domain = target.Host
+	}
+
+	body := []byte(page.HTML)
+	rendered := &AnalysisResult{
+		HeadingCounts: make(map[string]int),
+		Kind:          ResultKindHTML,
+		// Response, security and charset describe the fetch, they only make sense for the static result
+		Technologies:       static.Technologies,
+		Resources:          static.Resources,
+		BrokenAnchors:      static.BrokenAnchors,
+		BrokenAnchorsCount: static.BrokenAnchorsCount,
+	}
+	applyPageScan(rendered, scanPage(bytes.NewReader(body), pageURL), body, pageURL, domain, opts.ExtractionRules)
+	comparison.Result = rendered
+
+	comparison.Differences = compareResults(static, rendered)
+	comparison.Differs = len(comparison.Differences) > 0
+	return comparison
+}
+
+// Fields that client-side rendering typically changes
+func compareResults(static, rendered *AnalysisResult) []RenderDifference {
+	differences := []RenderDifference{}
+	add := func(field string, a, b interface{}) {
+		if a != b {
+			differences = append(differences, RenderDifference{Field: field, Static: a, Rendered: b})
+		}
+	}
+
+	add("title", strings.TrimSpace(static.Title), strings.TrimSpace(rendered.Title))
+	add("meta_description", static.MetaDescription, rendered.MetaDescription)
+	for i := 1; i <= 6; i++ {
+		tag := "h" + strconv.Itoa(i)
+		add("heading_counts."+tag, static.HeadingCounts[tag], rendered.HeadingCounts[tag])
+	}
+	add("internal_links_count", static.InternalLinksCount, rendered.InternalLinksCount)
+	add("external_links_count", static.ExternalLinksCount, rendered.ExternalLinksCount)
+	add("has_login_form", static.HasLoginForm, rendered.HasLoginForm)
+	add("word_count", contentWordCount(static.Content), contentWordCount(rendered.Content))
+	return differences
+}
+
+func contentWordCount(content *ContentAnalysis) int {
+	if content == nil {
+		return 0
+	}
+	return content.WordCount
+}
@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// A subresource referenced by the page. The size and caching fields are only filled when resources are fetched
+type Resource struct {
+	URL             string `json:"url"`
+	Type            string `json:"type"` // script, stylesheet, iframe, font or preload
+	Origin          string `json:"origin"`
+	ThirdParty      bool   `json:"third_party"`
+	StatusCode      int    `json:"status_code,omitempty"`
+	TransferSize    int64  `json:"transfer_size,omitempty"`
+	ContentType     string `json:"content_type,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+	CacheControl    string `json:"cache_control,omitempty"`
+	ETag            string `json:"etag,omitempty"`
+	LastModified    string `json:"last_modified,omitempty"`
+	Cacheable       bool   `json:"cacheable,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+// Resources loaded from the same origin
+type ResourceOrigin struct {
+	Origin       string     `json:"origin"`
+	ThirdParty   bool       `json:"third_party"`
+	Requests     int        `json:"requests"`
+	TransferSize int64      `json:"transfer_size"`
+	Resources    []Resource `json:"resources"`
+}
+
+// One line of the performance budget report
+type BudgetCheck struct {
+	Metric string `json:"metric"`
+	Limit  int64  `json:"limit"`
+	Actual int64  `json:"actual"`
+	Passed bool   `json:"passed"`
+}
+
+// Resource inventory type structure
+type ResourceInventory struct {
+	FirstParty            []ResourceOrigin `json:"first_party"`
+	ThirdParty            []ResourceOrigin `json:"third_party"`
+	Fetched               bool             `json:"fetched"`
+	TotalRequests         int              `json:"total_requests"`
+	ThirdPartyRequests    int              `json:"third_party_requests"`
+	PageWeight            int64            `json:"page_weight"`
+	UncompressedResources int              `json:"uncompressed_resources"`
+	UncachedResources     int              `json:"uncached_resources"`
+	Budget                []BudgetCheck    `json:"budget"`
+	WithinBudget          bool             `json:"within_budget"`
+}
+
+// Performance budget defaults, each can be overridden with the matching PERF_BUDGET_* environment variable
+const (
+	defaultBudgetPageWeight         = 2 * 1024 * 1024
+	defaultBudgetRequests           = 80
+	defaultBudgetThirdPartyRequests = 30
+)
+
+// Number of resources fetched in parallel when RESOURCE_FETCH is enabled
+const resourceFetchWorkers = 6
+
+// Largest resource body read when measuring sizes
+const resourceMaxBytes = 10 * 1024 * 1024
+
+// Build the inventory from the collected resources. documentSize is the transfer size of the page itself, client fetches the resources when RESOURCE_FETCH is on
+func inventoryResources(pageURL *url.URL, resources []Resource, documentSize int64, client *http.Client) *ResourceInventory {
+	inventory := &ResourceInventory{
+		FirstParty: []ResourceOrigin{},
+		ThirdParty: []ResourceOrigin{},
+	}
+	if pageURL == nil {
+		return inventory
+	}
+
+	// The same file is often referenced twice (preload and script), the browser requests it once
+	seen := map[string]bool{}
+	unique := []Resource{}
+	for _, resource := range resources {
+		if resource.URL == "" || seen[resource.URL] {
+			continue
+		}
+		seen[resource.URL] = true
+		resource.Origin, resource.ThirdParty = resourceOrigin(pageURL, resource.URL)
+		unique = append(unique, resource)
+	}
+
+	if envBool("RESOURCE_FETCH") {
+		fetchResources(client, unique)
+		inventory.Fetched = true
+	}
+
+	// Group by origin, first-party and third-party separately
+	groups := map[string]*ResourceOrigin{}
+	for _, resource := range unique {
+		group, ok := groups[resource.Origin]
+		if !ok {
+			group = &ResourceOrigin{Origin: resource.Origin, ThirdParty: resource.ThirdParty}
+			groups[resource.Origin] = group
+		}
+		group.Resources = append(group.Resources, resource)
+		group.Requests++
+		group.TransferSize += resource.TransferSize
+
+		if resource.ThirdParty {
+			inventory.ThirdPartyRequests++
+		}
+		if inventory.Fetched && resource.Error == "" {
+			if resource.ContentEncoding == "" && isCompressible(resource.ContentType) {
+				inventory.UncompressedResources++
+			}
+			if !resource.Cacheable {
+				inventory.UncachedResources++
+			}
+		}
+	}
+	for _, group := range groups {
+		if group.ThirdParty {
+			inventory.ThirdParty = append(inventory.ThirdParty, *group)
+		} else {
+			inventory.FirstParty = append(inventory.FirstParty, *group)
+		}
+	}
+	sortOrigins(inventory.FirstParty)
+	sortOrigins(inventory.ThirdParty)
+
+	// The document counts as a request and towards the weight as well
+	inventory.TotalRequests = len(unique) + 1
+	inventory.PageWeight = documentSize
+	for _, resource := range unique {
+		inventory.PageWeight += resource.TransferSize
+	}
+
+	// Check against the budget; page weight is only known when the resources were fetched
+	inventory.WithinBudget = true
+	addCheck := func(metric string, limit, actual int64) {
+		check := BudgetCheck{Metric: metric, Limit: limit, Actual: actual, Passed: actual <= limit}
+		inventory.Budget = append(inventory.Budget, check)
+		if !check.Passed {
+			inventory.WithinBudget = false
+		}
+	}
+	addCheck("requests", envInt64("PERF_BUDGET_MAX_REQUESTS", defaultBudgetRequests), int64(inventory.TotalRequests))
+	addCheck("third_party_requests", envInt64("PERF_BUDGET_MAX_THIRD_PARTY_REQUESTS", defaultBudgetThirdPartyRequests), int64(inventory.ThirdPartyRequests))
+	if inventory.Fetched {
+		addCheck("page_weight", envInt64("PERF_BUDGET_MAX_PAGE_WEIGHT", defaultBudgetPageWeight), inventory.PageWeight)
+	}
+
+	return inventory
+}
+
+// Origin of a resource and whether it belongs to another site than the page (compared by registrable domain, so cdn.example.com is first-party on www.example.com)
+func resourceOrigin(pageURL *url.URL, resourceURL string) (string, bool) {
+	u, err := url.Parse(resourceURL)
+	if err != nil || u.Host == "" {
+		return pageURL.Scheme + "://" + pageURL.Host, false
+	}
+	origin := u.Scheme + "://" + u.Host
+	return origin, registrableDomain(u.Hostname()) != registrableDomain(pageURL.Hostname())
+}
+
+func registrableDomain(host string) string {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(strings.ToLower(host))
+	if err != nil {
+		// IP addresses and single label hosts are their own site
+		return strings.ToLower(host)
+	}
+	return domain
+}
+
+// Fetch every resource with a small worker pool and record size, compression and caching headers
+func fetchResources(client *http.Client, resources []Resource) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < resourceFetchWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fetchResource(client, &resources[i])
+			}
+		}()
+	}
+	for i := range resources {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func fetchResource(client *http.Client, resource *Resource) {
+	req, err := http.NewRequest("GET", resource.URL, nil)
+	if err != nil {
+		resource.Error = err.Error()
+		return
+	}
+	// Ask for compression like a browser would and keep it, so the transfer size is what goes over the wire
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		resource.Error = err.Error()
+		return
+	}
+	defer resp.Body.Close()
+
+	size, err := io.Copy(io.Discard, io.LimitReader(resp.Body, resourceMaxBytes))
+	if err != nil {
+		resource.Error = err.Error()
+	}
+
+	resource.StatusCode = resp.StatusCode
+	resource.TransferSize = size
+	resource.ContentType = resp.Header.Get("Content-Type")
+	resource.ContentEncoding = resp.Header.Get("Content-Encoding")
+	resource.CacheControl = resp.Header.Get("Cache-Control")
+	resource.ETag = resp.Header.Get("ETag")
+	resource.LastModified = resp.Header.Get("Last-Modified")
+	resource.Cacheable = isCacheable(resp.Header)
+}
+
+// A response can be reused by the browser when it has a positive max-age or Expires, or at least a validator
+func isCacheable(header http.Header) bool {
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	if strings.Contains(cacheControl, "no-store") {
+		return false
+	}
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if strings.HasPrefix(directive, "max-age=") {
+			maxAge, _ := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			return maxAge > 0
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires.After(time.Now())
+	}
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// Text based responses that should be served compressed
+func isCompressible(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	for _, kind := range []string{"text/", "javascript", "json", "xml", "svg"} {
+		if strings.Contains(contentType, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify a <link> element by its rel and as attributes, an empty string means it does not load anything we track
+func linkResourceType(rel, as, href string) string {
+	rel = strings.ToLower(rel)
+	switch {
+	case strings.Contains(rel, "stylesheet"):
+		return "stylesheet"
+	case strings.Contains(rel, "preload") && strings.EqualFold(as, "font"):
+		return "font"
+	case strings.Contains(rel, "preload"), strings.Contains(rel, "prefetch"):
+		return "preload"
+	}
+	lower := strings.ToLower(href)
+	for _, ext := range []string{".woff2", ".woff", ".ttf", ".otf", ".eot"} {
+		if strings.Contains(lower, ext) {
+			return "font"
+		}
+	}
+	return ""
+}
+
+func sortOrigins(origins []ResourceOrigin) {
+	sort.Slice(origins, func(i, j int) bool {
+		if origins[i].Requests != origins[j].Requests {
+			return origins[i].Requests > origins[j].Requests
+		}
+		return origins[i].Origin < origins[j].Origin
+	})
+}
+
+// Read a true/false setting from the environment
+func envBool(name string) bool {
+	value, _ := strconv.ParseBool(os.Getenv(name))
+	return value
+}
+
+// Read a numeric setting from the environment, falling back to def when unset or invalid
+func envInt64(name string, def int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(name), 10, 64)
+	if err != nil || value <= 0 {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,414 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Result of checking one security header
+type HeaderCheck struct {
+	Name    string   `json:"name"`
+	Present bool     `json:"present"`
+	Value   string   `json:"value,omitempty"`
+	Quality string   `json:"quality"` // good, weak, missing or not_applicable
+	Notes   []string `json:"notes,omitempty"`
+}
+
+// Security flags of a cookie set by the page
+type CookieCheck struct {
+	Name     string   `json:"name"`
+	Secure   bool     `json:"secure"`
+	HttpOnly bool     `json:"http_only"`
+	SameSite string   `json:"same_site"`
+	Issues   []string `json:"issues,omitempty"`
+}
+
+// TLS connection and certificate details of the origin
+type CertificateInfo struct {
+	TLSVersion      string    `json:"tls_version"`
+	CipherSuite     string    `json:"cipher_suite"`
+	Subject         string    `json:"subject"`
+	Issuer          string    `json:"issuer"`
+	NotAfter        time.Time `json:"not_after"`
+	DaysUntilExpiry int       `json:"days_until_expiry"`
+	ChainValid      bool      `json:"chain_valid"`
+	ChainError      string    `json:"chain_error,omitempty"`
+}
+
+// Security audit type structure
+type SecurityAudit struct {
+	Origin       string           `json:"origin"`
+	HTTPS        bool             `json:"https"`
+	Headers      []HeaderCheck    `json:"headers"`
+	Cookies      []CookieCheck    `json:"cookies"`
+	MixedContent []LinkDetail     `json:"mixed_content"`
+	Certificate  *CertificateInfo `json:"certificate,omitempty"`
+	Score        int              `json:"score"`
+	Grade        string           `json:"grade"`
+	Issues       []string         `json:"issues"`
+}
+
+// HSTS max-age below six months is considered weak
+const hstsMinMaxAge = 15552000
+
+// Certificates expiring within this many days lower the grade
+const certExpiryWarningDays = 14
+
+// Audit the security headers, cookies, mixed content and certificate of the final response in the chain
+func auditSecurity(hops []*traceHop, mixedContent []LinkDetail) *SecurityAudit {
+	if len(hops) == 0 {
+		return nil
+	}
+	final := hops[len(hops)-1]
+
+	target := final.Request.URL
+	audit := &SecurityAudit{
+		Origin:       target.Scheme + "://" + target.Host,
+		HTTPS:        target.Scheme == "https",
+		Headers:      []HeaderCheck{},
+		Cookies:      []CookieCheck{},
+		MixedContent: []LinkDetail{},
+		Issues:       []string{},
+	}
+	score := 100
+	penalize := func(points int, issue string) {
+		score -= points
+		audit.Issues = append(audit.Issues, issue)
+	}
+
+	if !audit.HTTPS {
+		penalize(30, "Page is not served over HTTPS")
+	}
+
+	// Security headers of the final response
+	header := http.Header{}
+	if final.Response != nil {
+		header = final.Response.Header
+	}
+	for _, check := range []struct {
+		name    string
+		penalty int
+		grade   func(value string, header http.Header, https bool) (string, []string)
+	}{
+		{"Strict-Transport-Security", 20, gradeHSTS},
+		{"Content-Security-Policy", 20, gradeCSP},
+		{"X-Frame-Options", 10, gradeFrameOptions},
+		{"X-Content-Type-Options", 10, gradeContentTypeOptions},
+		{"Referrer-Policy", 5, gradeReferrerPolicy},
+		{"Permissions-Policy", 5, gradePermissionsPolicy},
+	} {
+		value := header.Get(check.name)
+		quality, notes := check.grade(value, header, audit.HTTPS)
+		audit.Headers = append(audit.Headers, HeaderCheck{
+			Name:    check.name,
+			Present: value != "",
+			Value:   value,
+			Quality: quality,
+			Notes:   notes,
+		})
+
+		switch quality {
+		case "missing":
+			penalize(check.penalty, check.name+" header is missing")
+		case "weak":
+			penalize(check.penalty/2, check.name+" header is weak")
+		}
+	}
+
+	// Cookies set anywhere along the redirect chain
+	cookiePenalty := 0
+	for _, hop := range hops {
+		if hop.Response == nil {
+			continue
+		}
+		for _, cookie := range hop.Response.Cookies() {
+			check := checkCookie(cookie, audit.HTTPS)
+			cookiePenalty += 5 * len(check.Issues)
+			audit.Cookies = append(audit.Cookies, check)
+		}
+	}
+	if cookiePenalty > 0 {
+		if cookiePenalty > 15 {
+			cookiePenalty = 15
+		}
+		penalize(cookiePenalty, "Cookies are missing security flags")
+	}
+
+	// Mixed content only matters on HTTPS pages
+	if audit.HTTPS && len(mixedContent) > 0 {
+		audit.MixedContent = mixedContent
+		penalize(15, "Page references resources over plain HTTP")
+	}
+
+	// Certificate and TLS connection
+	if audit.HTTPS {
+		audit.Certificate = inspectCertificate(final)
+		cert := audit.Certificate
+		if cert != nil {
+			if !cert.ChainValid {
+				penalize(30, "Certificate chain is not valid")
+			} else if cert.DaysUntilExpiry < certExpiryWarningDays {
+				penalize(10, "Certificate expires in "+strconv.Itoa(cert.DaysUntilExpiry)+" days")
+			}
+			if cert.TLSVersion == "TLS 1.0" || cert.TLSVersion == "TLS 1.1" {
+				penalize(20, "Outdated TLS version "+cert.TLSVersion)
+			}
+		}
+	}
+
+	if score < 0 {
+		score = 0
+	}
+	audit.Score = score
+	audit.Grade = securityGrade(score)
+	return audit
+}
+
+// Map a score between 0 and 100 to a letter grade
+func securityGrade(score int) string {
+	switch {
+	case score >= 95:
+		return "A+"
+	case score >= 85:
+		return "A"
+	case score >= 70:
+		return "B"
+	case score >= 55:
+		return "C"
+	case score >= 40:
+		return "D"
+	default:
+		return "F"
+	}
+}
+
+func gradeHSTS(value string, _ http.Header, https bool) (string, []string) {
+	if !https {
+		// Browsers ignore HSTS over plain HTTP, the missing HTTPS is already penalized
+		return "not_applicable", nil
+	}
+	if value == "" {
+		return "missing", nil
+	}
+
+	var notes []string
+	maxAge := -1
+	for _, directive := range strings.Split(value, ";") {
+		directive = strings.TrimSpace(strings.ToLower(directive))
+		if strings.HasPrefix(directive, "max-age=") {
+			maxAge, _ = strconv.Atoi(strings.Trim(strings.TrimPrefix(directive, "max-age="), `"`))
+		}
+	}
+	if maxAge < hstsMinMaxAge {
+		notes = append(notes, "max-age should be at least 15552000 (180 days)")
+	}
+	if !strings.Contains(strings.ToLower(value), "includesubdomains") {
+		notes = append(notes, "includeSubDomains is not set")
+	}
+
+	if maxAge < hstsMinMaxAge {
+		return "weak", notes
+	}
+	return "good", notes
+}
+
+func gradeCSP(value string, _ http.Header, _ bool) (string, []string) {
+	if value == "" {
+		return "missing", nil
+	}
+
+	var notes []string
+	lower := strings.ToLower(value)
+	if strings.Contains(lower, "'unsafe-inline'") {
+		notes = append(notes, "allows 'unsafe-inline'")
+	}
+	if strings.Contains(lower, "'unsafe-eval'") {
+		notes = append(notes, "allows 'unsafe-eval'")
+	}
+	for _, directive := range strings.Split(lower, ";") {
+		fields := strings.Fields(directive)
+		for _, source := range fields[min(1, len(fields)):] {
+			if source == "*" {
+				notes = append(notes, fields[0]+" allows any source")
+			}
+		}
+	}
+	if !strings.Contains(lower, "default-src") && !strings.Contains(lower, "script-src") {
+		notes = append(notes, "neither default-src nor script-src is set")
+	}
+
+	if len(notes) > 0 {
+		return "weak", notes
+	}
+	return "good", nil
+}
+
+func gradeFrameOptions(value string, header http.Header, _ bool) (string, []string) {
+	// CSP frame-ancestors supersedes X-Frame-Options
+	if strings.Contains(strings.ToLower(header.Get("Content-Security-Policy")), "frame-ancestors") {
+		if value == "" {
+			return "good", []string{"covered by CSP frame-ancestors"}
+		}
+	}
+	if value == "" {
+		return "missing", nil
+	}
+
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "DENY", "SAMEORIGIN":
+		return "good", nil
+	default:
+		return "weak", []string{"value should be DENY or SAMEORIGIN"}
+	}
+}
+
+func gradeContentTypeOptions(value string, _ http.Header, _ bool) (string, []string) {
+	if value == "" {
+		return "missing", nil
+	}
+	if strings.ToLower(strings.TrimSpace(value)) != "nosniff" {
+		return "weak", []string{"value should be nosniff"}
+	}
+	return "good", nil
+}
+
+func gradeReferrerPolicy(value string, _ http.Header, _ bool) (string, []string) {
+	if value == "" {
+		return "missing", nil
+	}
+
+	// When several policies are listed the browser uses the last one it supports
+	policies := strings.Split(value, ",")
+	policy := strings.ToLower(strings.TrimSpace(policies[len(policies)-1]))
+	switch policy {
+	case "unsafe-url", "no-referrer-when-downgrade":
+		return "weak", []string{policy + " leaks full URLs to other origins"}
+	default:
+		return "good", nil
+	}
+}
+
+func gradePermissionsPolicy(value string, _ http.Header, _ bool) (string, []string) {
+	if value == "" {
+		return "missing", nil
+	}
+	if strings.Contains(value, "*") {
+		return "weak", []string{"grants features to all origins"}
+	}
+	return "good", nil
+}
+
+// Check the Secure, HttpOnly and SameSite flags of a cookie
+func checkCookie(cookie *http.Cookie, https bool) CookieCheck {
+	check := CookieCheck{
+		Name:     cookie.Name,
+		Secure:   cookie.Secure,
+		HttpOnly: cookie.HttpOnly,
+		SameSite: sameSiteName(cookie.SameSite),
+	}
+
+	if https && !cookie.Secure {
+		check.Issues = append(check.Issues, "Secure flag is missing")
+	}
+	if !cookie.HttpOnly {
+		check.Issues = append(check.Issues, "HttpOnly flag is missing")
+	}
+	switch cookie.SameSite {
+	case http.SameSiteDefaultMode:
+		check.Issues = append(check.Issues, "SameSite is not set")
+	case http.SameSiteNoneMode:
+		if !cookie.Secure {
+			check.Issues = append(check.Issues, "SameSite=None requires the Secure flag")
+		}
+	}
+	return check
+}
+
+func sameSiteName(mode http.SameSite) string {
+	switch mode {
+	case http.SameSiteLaxMode:
+		return "Lax"
+	case http.SameSiteStrictMode:
+		return "Strict"
+	case http.SameSiteNoneMode:
+		return "None"
+	default:
+		return ""
+	}
+}
+
+// Read the TLS details of the final response. If the request failed the handshake, connect again without verification so the certificate can still be reported
+func inspectCertificate(hop *traceHop) *CertificateInfo {
+	if hop.Response != nil && hop.Response.TLS != nil {
+		state := hop.Response.TLS
+		info := certificateInfo(state)
+		info.ChainValid = len(state.VerifiedChains) > 0
+		return info
+	}
+
+	host := hop.Request.URL.Hostname()
+	port := hop.Request.URL.Port()
+	if port == "" {
+		port = "443"
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(host, port), &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	info := certificateInfo(&state)
+	if len(state.PeerCertificates) == 0 {
+		return info
+	}
+
+	// Verify the chain ourselves to find out why the original request was rejected
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err = state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       host,
+		Intermediates: intermediates,
+	})
+	info.ChainValid = err == nil
+	if err != nil {
+		info.ChainError = err.Error()
+	}
+	return info
+}
+
+func certificateInfo(state *tls.ConnectionState) *CertificateInfo {
+	info := &CertificateInfo{
+		TLSVersion:  tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+	}
+	if len(state.PeerCertificates) > 0 {
+		leaf := state.PeerCertificates[0]
+		info.Subject = leaf.Subject.CommonName
+		info.Issuer = leaf.Issuer.String()
+		info.NotAfter = leaf.NotAfter
+		info.DaysUntilExpiry = int(time.Until(leaf.NotAfter).Hours() / 24)
+	}
+	return info
+}
+
+// Report whether a resource reference is loaded over plain HTTP from an HTTPS page
+func isMixedContent(pageURL *url.URL, ref string) bool {
+	if pageURL == nil || pageURL.Scheme != "https" {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(ref)), "http://")
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+)
+
+// Number of consecutive words hashed together, so word order matters and not only the vocabulary
+const simHashShingleSize = 3
+
+// 64-bit SimHash of a text over word shingles. Texts that share most of their shingles end up a few bits apart
+func SimHash(text string) uint64 {
+	words := tokenizeWords(text)
+	if len(words) == 0 {
+		return 0
+	}
+
+	// Short texts are hashed word by word
+	size := simHashShingleSize
+	if len(words) < size {
+		size = 1
+	}
+
+	var weights [64]int
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		for _, word := range words[i : i+size] {
+			h.Write([]byte(word))
+			h.Write([]byte{' '})
+		}
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+	return fingerprint
+}
+
+// Number of differing bits between two fingerprints
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Fingerprints are stored as 16 hex characters, which every database handles (unlike unsigned 64-bit integers)
+func FormatSimHash(fingerprint uint64) string {
+	return fmt.Sprintf("%016x", fingerprint)
+}
+
+func ParseSimHash(value string) (uint64, error) {
+	return strconv.ParseUint(value, 16, 64)
+}
+
+// Group fingerprints whose distance is at most maxDistance, directly or through other members (single linkage).
+// Returns the index lists of groups with more than one member
+func ClusterSimHashes(fingerprints []uint64, maxDistance int) [][]int {
+	parent := make([]int, len(fingerprints))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := 0; i < len(fingerprints); i++ {
+		for j := i + 1; j < len(fingerprints); j++ {
+			if HammingDistance(fingerprints[i], fingerprints[j]) <= maxDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	var order []int
+	for i := range fingerprints {
+		root := find(i)
+		if _, ok := groups[root]; !ok {
+			order = append(order, root)
+		}
+		groups[root] = append(groups[root], i)
+	}
+
+	clusters := [][]int{}
+	for _, root := range order {
+		if len(groups[root]) > 1 {
+			clusters = append(clusters, groups[root])
+		}
+	}
+	return clusters
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The response behind an analysis as it came over the wire (decompressed, before charset transcoding)
+type Snapshot struct {
+	URL        string
+	FinalURL   string
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+	FetchedAt  time.Time
+}
+
+// The snapshot kept for a run: the page response, or when the page request got none (DNS failure, refused connection,
+// TLS error, timeout) one with status 0 and no body, so the requests that were made still go into the WARC and HAR exports.
+// nil when nothing was requested
+func (r *AnalysisResult) RunSnapshot() *Snapshot {
+	if r.Snapshot != nil || len(r.exchanges) == 0 {
+		return r.Snapshot
+	}
+	last := r.exchanges[len(r.exchanges)-1]
+	finalURL := r.ErrorURL
+	if finalURL == "" && last.Request != nil {
+		finalURL = last.Request.URL.String()
+	}
+	return &Snapshot{URL: finalURL, FinalURL: finalURL, Headers: http.Header{}, Body: []byte{}, FetchedAt: r.exchanges[0].start}
+}
+
+// Content address of the body, identical bodies share one stored blob
+func (s *Snapshot) Hash() string {
+	return BodyHash(s.Body)
+}
+
+// Bodies are stored gzipped, HTML usually shrinks to a fifth
+func CompressSnapshotBody(body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gz.Write(body); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func DecompressSnapshotBody(compressed []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return io.ReadAll(gz)
+}
+
+func newSnapshot(targetURL string, finalURL string, statusCode int, headers *http.Header, body []byte) *Snapshot {
+	snapshot := &Snapshot{
+		URL:        targetURL,
+		FinalURL:   finalURL,
+		StatusCode: statusCode,
+		Headers:    http.Header{},
+		Body:       append([]byte(nil), body...),
+		FetchedAt:  time.Now(),
+	}
+	if headers != nil {
+		snapshot.Headers = headers.Clone()
+	}
+	return snapshot
+}
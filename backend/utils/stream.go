@@ -0,0 +1,549 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Default hard limit for the page body (after decompression), ANALYZE_MAX_BODY_BYTES overrides it. Larger pages are analyzed up to the limit
+const defaultMaxBodyBytes = 10 * 1024 * 1024
+
+func maxBodyBytes() int64 {
+	return envInt64("ANALYZE_MAX_BODY_BYTES", defaultMaxBodyBytes)
+}
+
+// Everything the analysis reads from the markup of a page, collected in a single pass of the x/net/html tokenizer.
+// No DOM is built, the tokenizer only keeps the current token and the scan keeps a stack of open element names
+type pageScan struct {
+	HTMLVersion     string
+	Title           string
+	HeadingCounts   map[string]int
+	Links           []scannedLink
+	HasLoginForm    bool
+	MixedContent    []LinkDetail
+	ScriptSrcs      []string
+	Resources       []Resource
+	MetaGenerator   string
+	MetaDescription string
+	Lang            string
+	MainText        string
+	AnchorIDs       map[string]bool
+}
+
+// An <a href> or <area href> with its raw href, the href resolved like colly's AbsoluteURL, the link text and the rel attribute
+type scannedLink struct {
+	Tag         string
+	Href        string
+	AbsoluteURL string
+	Text        string
+	Rel         string
+}
+
+// The attributes the scan looks at, read once per tag without keeping the others
+type scannedAttrs struct {
+	id, name, href, src, data, rel, as, content, role, typ, lang string
+	hasHref, hasSrc, hasData, hasName                            bool
+}
+
+type openElement struct {
+	tag         string
+	block       bool
+	boilerplate bool
+}
+
+// Text collected below one candidate root of the main content (main or [role=main], the first article, the whole document)
+type textCollector struct {
+	root int // stack index of the root element, -1 for the document, -2 when not open
+	done bool
+	text mainText
+}
+
+// Elements that never have content or an end tag, they are not pushed on the stack
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// Elements removed before the main text is taken
+var boilerplateElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true,
+}
+
+// Start tags that close an open <p>, the optional end tag the HTML parser inserts
+var closesParagraph = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "details": true, "div": true, "dl": true,
+	"fieldset": true, "figcaption": true, "figure": true, "footer": true, "form": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "main": true, "menu": true,
+	"nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true, "ul": true,
+}
+
+type pageScanner struct {
+	scan    *pageScan
+	pageURL *url.URL
+	baseURL *url.URL
+
+	stack []openElement
+	// Index of the innermost open boilerplate element, -1 when none is open
+	boilerplate int
+	// Open head or title elements, their text is not part of the page text
+	headDepth int
+
+	main      textCollector
+	article   textCollector
+	document  textCollector
+	articles  int
+	inSVG     int
+	titleOpen bool
+	titleText strings.Builder
+	titleSeen bool
+
+	anchorIndex int // stack index of the open link, -1 when none
+	anchorHref  string
+	anchorRel   string
+	anchorText  bytes.Buffer // reused for every link
+
+	formIndex    int // stack index of the open form, -1 when none
+	formText     strings.Builder
+	formPassword bool
+}
+
+// Tokenize the page once and collect the title, headings, links, forms, subresources, meta tags, anchors and main text.
+// pageURL is the final URL of the page, relative references resolve against it (or against <base href>)
+func scanPage(r io.Reader, pageURL *url.URL) *pageScan {
+	s := &pageScanner{
+		scan: &pageScan{
+			HTMLVersion:   "Unknown",
+			HeadingCounts: map[string]int{},
+			AnchorIDs:     map[string]bool{},
+		},
+		pageURL:     pageURL,
+		baseURL:     pageURL,
+		boilerplate: -1,
+		main:        textCollector{root: -2},
+		article:     textCollector{root: -2},
+		document:    textCollector{root: -1},
+		anchorIndex: -1,
+		formIndex:   -1,
+	}
+
+	z := html.NewTokenizer(r)
+	doctypeSeen := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// io.EOF at the end of the page, a read error ends the scan the same way
+			for len(s.stack) > 0 {
+				s.pop()
+			}
+			s.finish()
+			return s.scan
+		case html.DoctypeToken:
+			if !doctypeSeen {
+				doctypeSeen = true
+				s.scan.HTMLVersion = htmlVersion(string(z.Text()))
+			}
+		case html.TextToken:
+			s.text(z.Text())
+		case html.StartTagToken:
+			s.start(z, false)
+		case html.SelfClosingTagToken:
+			s.start(z, true)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			s.end(tagName(name))
+		}
+	}
+}
+
+// HTML version from the doctype: <!DOCTYPE html> is HTML5, the XHTML 1.0 public identifiers are XHTML 1.0
+func htmlVersion(doctype string) string {
+	doctype = strings.TrimSpace(doctype)
+	switch {
+	case strings.Contains(doctype, "-//W3C//DTD XHTML 1.0"):
+		return "XHTML 1.0"
+	case strings.EqualFold(doctype, "html"), strings.HasPrefix(strings.ToLower(doctype), "html system"):
+		return "HTML5"
+	}
+	return "Unknown"
+}
+
+// Known tag names come from the atom table and do not allocate
+func tagName(name []byte) string {
+	if a := atom.Lookup(name); a != 0 {
+		return a.String()
+	}
+	return string(name)
+}
+
+func readAttrs(z *html.Tokenizer) scannedAttrs {
+	var attrs scannedAttrs
+	for {
+		key, val, more := z.TagAttr()
+		switch string(key) {
+		case "id":
+			attrs.id = string(val)
+		case "name":
+			attrs.name, attrs.hasName = string(val), true
+		case "href":
+			attrs.href, attrs.hasHref = string(val), true
+		case "src":
+			attrs.src, attrs.hasSrc = string(val), true
+		case "data":
+			attrs.data, attrs.hasData = string(val), true
+		case "rel":
+			attrs.rel = string(val)
+		case "as":
+			attrs.as = string(val)
+		case "content":
+			attrs.content = string(val)
+		case "role":
+			attrs.role = string(val)
+		case "type":
+			attrs.typ = string(val)
+		case "lang":
+			attrs.lang = string(val)
+		}
+		if !more {
+			return attrs
+		}
+	}
+}
+
+func (s *pageScanner) start(z *html.Tokenizer, selfClosing bool) {
+	name, hasAttr := z.TagName()
+	tag := tagName(name)
+	var attrs scannedAttrs
+	if hasAttr {
+		attrs = readAttrs(z)
+	}
+	scan := s.scan
+
+	if attrs.id != "" {
+		scan.AnchorIDs[attrs.id] = true
+	}
+	s.closeImplied(tag)
+
+	switch tag {
+	case "html":
+		if scan.Lang == "" {
+			scan.Lang = strings.ToLower(strings.TrimSpace(attrs.lang))
+		}
+	case "base":
+		if attrs.hasHref && s.baseURL == s.pageURL {
+			if base, err := s.pageURL.Parse(attrs.href); err == nil {
+				s.baseURL = base
+			}
+		}
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		scan.HeadingCounts[tag]++
+	case "a":
+		if attrs.hasName && attrs.name != "" {
+			scan.AnchorIDs[attrs.name] = true
+		}
+		// A link inside a link closes the first one, like the HTML parser does
+		s.closeAnchor()
+	case "area":
+		if attrs.hasHref {
+			scan.Links = append(scan.Links, scannedLink{Tag: tag, Href: attrs.href, AbsoluteURL: s.absoluteURL(attrs.href), Rel: attrs.rel})
+		}
+	case "input":
+		if s.formIndex >= 0 && attrs.typ == "password" {
+			s.formPassword = true
+		}
+	case "meta":
+		if attrs.hasName {
+			// The meta description is kept for exact-duplicate detection across analyses
+			if strings.EqualFold(attrs.name, "generator") {
+				scan.MetaGenerator = attrs.content
+			}
+			if strings.EqualFold(attrs.name, "description") {
+				scan.MetaDescription = strings.TrimSpace(attrs.content)
+			}
+		}
+	case "svg":
+		s.inSVG++
+	}
+	s.subresource(tag, attrs)
+
+	if selfClosing || voidElements[tag] {
+		// Void and self-closing elements still separate the text around them, like an empty block
+		if blockElements[tag] {
+			s.emptyBlock(len(s.stack))
+		}
+		if tag == "svg" {
+			s.inSVG--
+		}
+		return
+	}
+
+	// Push, then open what the element starts
+	s.stack = append(s.stack, openElement{tag: tag, block: blockElements[tag], boilerplate: boilerplateElements[tag]})
+	index := len(s.stack) - 1
+	if boilerplateElements[tag] {
+		s.boilerplate = index
+	}
+	if tag == "head" || tag == "title" {
+		s.headDepth++
+	}
+	if !s.main.done && s.main.root == -2 && (tag == "main" || attrs.role == "main") {
+		s.main.root = index
+	}
+	if tag == "article" {
+		s.articles++
+		if s.article.root == -2 && !s.article.done {
+			s.article.root = index
+		}
+	}
+	if tag == "title" && s.inSVG == 0 && !s.titleSeen {
+		s.titleOpen = true
+	}
+	if tag == "a" && attrs.hasHref {
+		s.anchorIndex = index
+		s.anchorHref = attrs.href
+		s.anchorRel = attrs.rel
+		s.anchorText.Reset()
+	}
+	if tag == "form" && s.formIndex < 0 {
+		s.formIndex = index
+		s.formText.Reset()
+		s.formPassword = false
+	}
+	if s.stack[index].block {
+		for _, collector := range s.collectors(index) {
+			if collector != nil {
+				collector.text.startBlock()
+			}
+		}
+	}
+}
+
+// Subresources: mixed content, script sources for technology fingerprinting and the resource inventory
+func (s *pageScanner) subresource(tag string, attrs scannedAttrs) {
+	scan := s.scan
+	ref, loads := "", false
+	switch tag {
+	case "img", "script", "iframe", "audio", "video", "source", "embed":
+		ref, loads = attrs.src, attrs.hasSrc
+	case "object":
+		ref, loads = attrs.data, attrs.hasData
+	case "link":
+		// Only links that load something count, canonical or alternate links are just references
+		rel := strings.ToLower(attrs.rel)
+		if attrs.hasHref && (strings.Contains(rel, "stylesheet") || strings.Contains(rel, "icon") || strings.Contains(rel, "preload") || strings.Contains(rel, "manifest")) {
+			ref, loads = attrs.href, true
+		}
+	}
+	if loads && isMixedContent(s.pageURL, ref) {
+		scan.MixedContent = append(scan.MixedContent, LinkDetail{URL: ref, Text: tag})
+	}
+
+	switch tag {
+	case "script":
+		if attrs.hasSrc {
+			scan.ScriptSrcs = append(scan.ScriptSrcs, s.absoluteURL(attrs.src))
+			scan.Resources = append(scan.Resources, Resource{URL: s.absoluteURL(attrs.src), Type: tag})
+		}
+	case "iframe":
+		if attrs.hasSrc {
+			scan.Resources = append(scan.Resources, Resource{URL: s.absoluteURL(attrs.src), Type: tag})
+		}
+	case "link":
+		if attrs.hasHref {
+			if kind := linkResourceType(attrs.rel, attrs.as, attrs.href); kind != "" {
+				scan.Resources = append(scan.Resources, Resource{URL: s.absoluteURL(attrs.href), Type: kind})
+			}
+		}
+	}
+}
+
+// Close the elements whose end tag is optional when the next one starts: a <p> before a block, the previous <li>, <dt> or <dd>,
+// the previous cell or row of a table. Only inline elements (and the cells a new row closes) may sit between the new tag and the element it closes
+func (s *pageScanner) closeImplied(tag string) {
+	var closes []string
+	var through map[string]bool
+	switch {
+	case tag == "li":
+		closes = []string{"li", "p"}
+	case tag == "dt" || tag == "dd":
+		closes = []string{"dt", "dd", "p"}
+	case tag == "td" || tag == "th":
+		closes = []string{"td", "th"}
+	case tag == "tr":
+		closes = []string{"tr"}
+		through = map[string]bool{"td": true, "th": true}
+	case closesParagraph[tag]:
+		closes = []string{"p"}
+	default:
+		return
+	}
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		open := s.stack[i].tag
+		for _, closed := range closes {
+			if open == closed {
+				for len(s.stack) > i {
+					s.pop()
+				}
+				return
+			}
+		}
+		if open != "p" && !through[open] && (s.stack[i].block || s.stack[i].boilerplate) {
+			return
+		}
+	}
+}
+
+// Close the innermost open element with this name and everything opened after it. End tags without an open element are ignored,
+// except </p>: the HTML parser inserts an empty paragraph for it
+func (s *pageScanner) end(tag string) {
+	for i := len(s.stack) - 1; i >= 0; i-- {
+		if s.stack[i].tag == tag {
+			for len(s.stack) > i {
+				s.pop()
+			}
+			return
+		}
+	}
+	if tag == "p" {
+		s.emptyBlock(len(s.stack))
+	}
+}
+
+func (s *pageScanner) pop() {
+	index := len(s.stack) - 1
+	element := s.stack[index]
+	if element.block {
+		for _, collector := range s.collectors(index) {
+			if collector != nil {
+				collector.text.endBlock()
+			}
+		}
+	}
+
+	switch {
+	case index == s.anchorIndex:
+		s.closeAnchor()
+	case index == s.formIndex:
+		if s.formPassword || strings.Contains(strings.ToLower(s.formText.String()), "login") {
+			s.scan.HasLoginForm = true
+		}
+		s.formIndex = -1
+	}
+	if index == s.main.root {
+		s.main.root, s.main.done = -2, true
+	}
+	if index == s.article.root {
+		s.article.root, s.article.done = -2, true
+	}
+	if element.tag == "head" || element.tag == "title" {
+		s.headDepth--
+	}
+	if element.tag == "title" && s.titleOpen {
+		s.titleOpen, s.titleSeen = false, true
+		s.scan.Title = s.titleText.String()
+	}
+	if element.tag == "svg" {
+		s.inSVG--
+	}
+
+	s.stack = s.stack[:index]
+	if index == s.boilerplate {
+		s.boilerplate = -1
+		for i := index - 1; i >= 0; i-- {
+			if s.stack[i].boilerplate {
+				s.boilerplate = i
+				break
+			}
+		}
+	}
+}
+
+func (s *pageScanner) closeAnchor() {
+	if s.anchorIndex < 0 {
+		return
+	}
+	s.scan.Links = append(s.scan.Links, scannedLink{Tag: "a", Href: s.anchorHref, AbsoluteURL: s.absoluteURL(s.anchorHref), Text: s.anchorText.String(), Rel: s.anchorRel})
+	s.anchorIndex = -1
+}
+
+func (s *pageScanner) text(text []byte) {
+	if s.titleOpen {
+		s.titleText.Write(text)
+	}
+	if s.anchorIndex >= 0 {
+		s.anchorText.Write(text)
+	}
+	if s.formIndex >= 0 {
+		s.formText.Write(text)
+	}
+	s.writeBytes(len(s.stack), text)
+}
+
+func (s *pageScanner) writeBytes(depth int, text []byte) {
+	for _, collector := range s.collectors(depth) {
+		if collector != nil {
+			collector.text.Write(text)
+		}
+	}
+}
+
+// A block element without content at the given depth, it still ends the sentence before it
+func (s *pageScanner) emptyBlock(depth int) {
+	for _, collector := range s.collectors(depth) {
+		if collector != nil {
+			collector.text.startBlock()
+			collector.text.endBlock()
+		}
+	}
+}
+
+// The main text candidates that take text found at the given stack depth, unless a boilerplate element below the candidate's root holds it
+func (s *pageScanner) collectors(depth int) [3]*textCollector {
+	var collectors [3]*textCollector
+	for i, collector := range [3]*textCollector{&s.main, &s.article, &s.document} {
+		if collector.root == -2 || depth < collector.root || s.boilerplate > collector.root {
+			continue
+		}
+		// The head (and a title outside it) never is part of the page text
+		if collector == &s.document && s.headDepth > 0 {
+			continue
+		}
+		collectors[i] = collector
+	}
+	return collectors
+}
+
+// Pick the main text: main or [role=main], a single article, otherwise the whole body
+func (s *pageScanner) finish() {
+	s.closeAnchor()
+	if s.titleOpen {
+		s.scan.Title = s.titleText.String()
+	}
+	text := &s.document.text
+	switch {
+	case s.main.done || s.main.root != -2:
+		text = &s.main.text
+	case s.articles == 1:
+		text = &s.article.text
+	}
+	s.scan.MainText = text.String()
+}
+
+// Same rules as colly's Request.AbsoluteURL: resolve against <base href> or the page, drop the fragment, empty for a bare fragment
+func (s *pageScanner) absoluteURL(ref string) string {
+	if strings.HasPrefix(ref, "#") {
+		return ""
+	}
+	absolute, err := s.baseURL.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	absolute.Fragment = ""
+	absolute.RawFragment = ""
+	return absolute.String()
+}
@@ -0,0 +1,249 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// Benchmarks of the markup pass, run with `go test -bench . ./utils`. They compare the streaming scan with the DOM walk it replaced
+// (goquery document plus one selector walk per callback, the way colly runs OnHTML callbacks) on generated pages of growing size.
+// Nothing is fetched, only the parsing of a body that is already in memory is measured
+
+// The main text both markup passes must produce, the DOM walk builds the tree the way a browser does
+func TestScanPageMainText(t *testing.T) {
+	pageURL, _ := url.Parse("https://example.com/")
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{"paragraphs", `<p>First paragraph</p><p>Second one</p>`, "First paragraph. Second one."},
+		{"implied table cells", `<table><tr><td>Cell one<td>Cell two</table>`, "Cell one. Cell two."},
+		{"implied table rows", `<table><tr><td>Row one<tr><td>Row two</table>`, "Row one. Row two."},
+		{"paragraph inside bold", `<b><p>Bold paragraph</p>after</b><p>next</p>`, "Bold paragraph. after next."},
+		{"block inside paragraph", `<p>Outer<div>inner block</div>tail</p>`, "Outer. inner block. tail."},
+		{"white space before the end tag", "<ul>\n<li>\n Item one \n</li><li>Item <b>two</b> </li></ul>", "Item one. Item two."},
+		{"line break", `<p>Hello<br>world</p>`, "Hello. world."},
+		{"empty blocks", `<div><div></div><p> </p>Text</div>`, "Text."},
+		{"boilerplate", `<header>Menu</header><main><h1>Title</h1><nav>Links</nav><p>Body text</p></main><footer>Legal</footer>`, "Title. Body text."},
+		{"single article", `<div>Sidebar</div><article><p>Story</p></article>`, "Story."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := "<html><body>" + tt.html + "</body></html>"
+			if got := scanPage(strings.NewReader(page), pageURL).MainText; got != tt.want {
+				t.Errorf("scanPage main text = %q, want %q", got, tt.want)
+			}
+			if got := domScan([]byte(page), pageURL).MainText; got != tt.want {
+				t.Errorf("domScan main text = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+var benchmarkPageSizes = []int{50 << 10, 500 << 10, 5 << 20}
+
+func BenchmarkScanPage(b *testing.B) {
+	benchmarkMarkupPass(b, func(body []byte, pageURL *url.URL) { scanPage(bytes.NewReader(body), pageURL) })
+}
+
+func BenchmarkDOMScan(b *testing.B) {
+	benchmarkMarkupPass(b, func(body []byte, pageURL *url.URL) { domScan(body, pageURL) })
+}
+
+// Run one implementation on every page size as a sub-benchmark, reporting throughput and allocations per page
+func benchmarkMarkupPass(b *testing.B, run func(body []byte, pageURL *url.URL)) {
+	pageURL, _ := url.Parse("https://example.com/articles/benchmark")
+	for _, size := range benchmarkPageSizes {
+		body := benchmarkPage(size)
+		b.Run(formatPageSize(len(body)), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(body)))
+			for i := 0; i < b.N; i++ {
+				run(body, pageURL)
+			}
+		})
+	}
+}
+
+func formatPageSize(size int) string {
+	if size >= 1<<20 {
+		return strconv.Itoa(size>>20) + "MB"
+	}
+	return strconv.Itoa(size>>10) + "KB"
+}
+
+// A page of roughly size bytes with the markup the analysis looks at: navigation, headings, paragraphs, links, images, scripts and forms
+func benchmarkPage(size int) []byte {
+	var sb strings.Builder
+	sb.WriteString(`<!DOCTYPE html><html lang="en"><head><meta charset="utf-8"><title>Benchmark page</title>`)
+	sb.WriteString(`<meta name="description" content="A generated page"><meta name="generator" content="WordPress 6.4">`)
+	sb.WriteString(`<link rel="stylesheet" href="/static/site.css"><link rel="preload" as="font" href="/static/font.woff2">`)
+	sb.WriteString(`<script src="https://cdn.example.net/jquery-3.7.1.min.js"></script></head><body>`)
+	sb.WriteString(`<header><nav><a href="/">Home</a> <a href="/about">About</a> <a href="#contact">Contact</a></nav></header><main>`)
+	for i := 0; sb.Len() < size; i++ {
+		fmt.Fprintf(&sb, `<section id="section-%d"><h2>Section %d</h2>`, i, i)
+		fmt.Fprintf(&sb, `<p>The quick brown fox jumps over the lazy dog in paragraph %d. It reads <a href="/articles/%d">the next article</a> `+
+			`and <a href="https://other.example.org/page?id=%d">an external page</a> before going back to <a href="#section-%d">the top</a>.</p>`, i, i, i, i/2)
+		fmt.Fprintf(&sb, `<ul><li>First item of list %d</li><li>Second item with <em>emphasis</em></li></ul>`, i)
+		fmt.Fprintf(&sb, `<img src="/images/%d.png" alt="Image %d"><script>window.track && track(%d);</script></section>`, i, i, i)
+		if i%50 == 0 {
+			sb.WriteString(`<form action="/login"><input name="user"><input type="password" name="pass"><button>Log in</button></form>`)
+		}
+	}
+	sb.WriteString(`</main><footer><p>Footer text</p></footer></body></html>`)
+	return []byte(sb.String())
+}
+
+// The markup pass as it was done before the streaming scan: a goquery document and one selector walk per OnHTML callback.
+// Kept as the baseline of the benchmarks and to check the streaming scan against
+func domScan(body []byte, pageURL *url.URL) *pageScan {
+	scan := &pageScan{HTMLVersion: "Unknown", HeadingCounts: map[string]int{}}
+
+	// The doctype was found in a copy of the whole body
+	page := string(body)
+	if strings.Contains(page, "<!DOCTYPE html>") {
+		scan.HTMLVersion = "HTML5"
+	} else if strings.Contains(page, "-//W3C//DTD XHTML 1.0") {
+		scan.HTMLVersion = "XHTML 1.0"
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return scan
+	}
+	base := pageURL
+	if href, found := doc.Find("base[href]").Attr("href"); found {
+		if parsed, err := pageURL.Parse(href); err == nil {
+			base = parsed
+		}
+	}
+	absolute := func(ref string) string {
+		if strings.HasPrefix(ref, "#") {
+			return ""
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ""
+		}
+		u.Fragment = ""
+		return u.String()
+	}
+
+	doc.Find("title").Each(func(_ int, s *goquery.Selection) {
+		scan.Title = s.Text()
+	})
+	for i := 1; i <= 6; i++ {
+		tag := "h" + strconv.Itoa(i)
+		if count := doc.Find(tag).Length(); count > 0 {
+			scan.HeadingCounts[tag] = count
+		}
+	}
+	doc.Find("a[href], area[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		scan.Links = append(scan.Links, scannedLink{Tag: goquery.NodeName(s), Href: href, AbsoluteURL: absolute(href), Text: s.Text(), Rel: s.AttrOr("rel", "")})
+	})
+	doc.Find("form").Each(func(_ int, s *goquery.Selection) {
+		if strings.Contains(strings.ToLower(s.Text()), "login") || s.Find("input[type='password']").Length() > 0 {
+			scan.HasLoginForm = true
+		}
+	})
+	doc.Find("img[src], script[src], iframe[src], audio[src], video[src], source[src], embed[src], object[data], link[href]").Each(func(_ int, s *goquery.Selection) {
+		name := goquery.NodeName(s)
+		ref := s.AttrOr("src", "")
+		switch name {
+		case "object":
+			ref = s.AttrOr("data", "")
+		case "link":
+			rel := strings.ToLower(s.AttrOr("rel", ""))
+			if !strings.Contains(rel, "stylesheet") && !strings.Contains(rel, "icon") && !strings.Contains(rel, "preload") && !strings.Contains(rel, "manifest") {
+				return
+			}
+			ref = s.AttrOr("href", "")
+		}
+		if isMixedContent(pageURL, ref) {
+			scan.MixedContent = append(scan.MixedContent, LinkDetail{URL: ref, Text: name})
+		}
+	})
+	doc.Find("script[src]").Each(func(_ int, s *goquery.Selection) {
+		scan.ScriptSrcs = append(scan.ScriptSrcs, absolute(s.AttrOr("src", "")))
+	})
+	doc.Find("script[src], iframe[src], link[href]").Each(func(_ int, s *goquery.Selection) {
+		switch name := goquery.NodeName(s); name {
+		case "script", "iframe":
+			scan.Resources = append(scan.Resources, Resource{URL: absolute(s.AttrOr("src", "")), Type: name})
+		case "link":
+			if kind := linkResourceType(s.AttrOr("rel", ""), s.AttrOr("as", ""), s.AttrOr("href", "")); kind != "" {
+				scan.Resources = append(scan.Resources, Resource{URL: absolute(s.AttrOr("href", "")), Type: kind})
+			}
+		}
+	})
+	doc.Find("meta[name]").Each(func(_ int, s *goquery.Selection) {
+		if strings.EqualFold(s.AttrOr("name", ""), "generator") {
+			scan.MetaGenerator = s.AttrOr("content", "")
+		}
+		if strings.EqualFold(s.AttrOr("name", ""), "description") {
+			scan.MetaDescription = strings.TrimSpace(s.AttrOr("content", ""))
+		}
+	})
+	root := doc.Find("html").First()
+	scan.Lang = strings.ToLower(strings.TrimSpace(root.AttrOr("lang", "")))
+	scan.MainText = extractMainText(root)
+	scan.AnchorIDs = collectAnchorIDs(root)
+	return scan
+}
+
+// Elements that never hold main content
+const boilerplateSelector = "script, style, noscript, template, svg, iframe, nav, header, footer, aside, form"
+
+// The main text the way the DOM walk took it: the main content container (main, article or role=main, falling back to body)
+// with the boilerplate removed
+func extractMainText(doc *goquery.Selection) string {
+	root := doc.Find("main, [role=main]").First()
+	if root.Length() == 0 {
+		// With several articles (a blog index) the body is a better summary than the first one
+		if articles := doc.Find("article"); articles.Length() == 1 {
+			root = articles
+		}
+	}
+	if root.Length() == 0 {
+		root = doc.Find("body").First()
+	}
+	if root.Length() == 0 {
+		root = doc
+	}
+
+	// Work on a copy so the other callbacks still see the full document
+	root = root.Clone()
+	root.Find(boilerplateSelector).Remove()
+
+	var text mainText
+	for _, node := range root.Nodes {
+		collectText(node, &text)
+	}
+	return text.String()
+}
+
+func collectText(node *html.Node, text *mainText) {
+	if node.Type == html.TextNode {
+		text.WriteString(node.Data)
+		return
+	}
+	block := node.Type == html.ElementNode && blockElements[node.Data]
+	if block {
+		text.startBlock()
+	}
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		collectText(child, text)
+	}
+	if block {
+		text.endBlock()
+	}
+}
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The rules shipped with the binary. A local file set in TECH_RULES_FILE can add rules or override these by name
+//
+//go:embed rules/technologies.json
+var defaultTechnologyRules []byte
+
+// Rules file format version this code understands
+const technologyRulesVersion = 1
+
+// Detected technology type structure
+type Technology struct {
+	Name     string   `json:"name"`
+	Category string   `json:"category"`
+	Version  string   `json:"version,omitempty"`
+	Evidence []string `json:"evidence"`
+}
+
+// A single rule as written in the JSON rules file. Every pattern is a regular expression, an empty header or cookie pattern only checks presence
+type technologyRule struct {
+	Name          string            `json:"name"`
+	Category      string            `json:"category"`
+	Headers       map[string]string `json:"headers"`
+	Cookies       map[string]string `json:"cookies"`
+	MetaGenerator string            `json:"meta_generator"`
+	ScriptSrc     []string          `json:"script_src"`
+	HTML          []string          `json:"html"`
+}
+
+type technologyRulesFile struct {
+	Version      int              `json:"version"`
+	Technologies []technologyRule `json:"technologies"`
+}
+
+// Rule with its patterns compiled once
+type compiledTechnology struct {
+	name          string
+	category      string
+	headers       map[string]*regexp.Regexp
+	cookies       map[string]*regexp.Regexp
+	metaGenerator *regexp.Regexp
+	scriptSrc     []*regexp.Regexp
+	html          []*regexp.Regexp
+}
+
+// What the page exposed for fingerprinting
+type technologyInput struct {
+	Headers       http.Header
+	Cookies       []*http.Cookie
+	MetaGenerator string
+	ScriptSrcs    []string
+	HTML          []byte
+}
+
+var (
+	technologyRulesOnce sync.Once
+	technologyRules     []compiledTechnology
+)
+
+// Load the embedded rules and the optional local rules file. Broken rules are logged and skipped so one bad pattern does not disable detection
+func loadTechnologyRules() []compiledTechnology {
+	technologyRulesOnce.Do(func() {
+		rules, err := parseTechnologyRules(defaultTechnologyRules)
+		if err != nil {
+			log.Printf("Failed to load built-in technology rules: %v", err)
+		}
+
+		if path := os.Getenv("TECH_RULES_FILE"); path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				log.Printf("Failed to read technology rules file %s: %v", path, err)
+			} else if local, err := parseTechnologyRules(data); err != nil {
+				log.Printf("Failed to load technology rules file %s: %v", path, err)
+			} else {
+				rules = mergeTechnologyRules(rules, local)
+			}
+		}
+
+		for _, rule := range rules {
+			compiled, err := compileTechnologyRule(rule)
+			if err != nil {
+				log.Printf("Skipping technology rule %q: %v", rule.Name, err)
+				continue
+			}
+			technologyRules = append(technologyRules, compiled)
+		}
+	})
+	return technologyRules
+}
+
+func parseTechnologyRules(data []byte) ([]technologyRule, error) {
+	var file technologyRulesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Version != technologyRulesVersion {
+		return nil, fmt.Errorf("unsupported rules version %d, expected %d", file.Version, technologyRulesVersion)
+	}
+	return file.Technologies, nil
+}
+
+// Local rules replace built-in rules with the same name and add the rest
+func mergeTechnologyRules(base, local []technologyRule) []technologyRule {
+	index := make(map[string]int, len(base))
+	for i, rule := range base {
+		index[strings.ToLower(rule.Name)] = i
+	}
+	for _, rule := range local {
+		if i, ok := index[strings.ToLower(rule.Name)]; ok {
+			base[i] = rule
+			continue
+		}
+		base = append(base, rule)
+	}
+	return base
+}
+
+func compileTechnologyRule(rule technologyRule) (compiledTechnology, error) {
+	compiled := compiledTechnology{
+		name:     rule.Name,
+		category: rule.Category,
+		headers:  map[string]*regexp.Regexp{},
+		cookies:  map[string]*regexp.Regexp{},
+	}
+	if rule.Name == "" {
+		return compiled, fmt.Errorf("name is required")
+	}
+
+	// Patterns are matched case-insensitively, like the header and tag names they apply to
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		return regexp.Compile("(?i)" + pattern)
+	}
+
+	var err error
+	for name, pattern := range rule.Headers {
+		if compiled.headers[name], err = compile(pattern); err != nil {
+			return compiled, err
+		}
+	}
+	for name, pattern := range rule.Cookies {
+		if compiled.cookies[name], err = compile(pattern); err != nil {
+			return compiled, err
+		}
+	}
+	if rule.MetaGenerator != "" {
+		if compiled.metaGenerator, err = compile(rule.MetaGenerator); err != nil {
+			return compiled, err
+		}
+	}
+	for _, pattern := range rule.ScriptSrc {
+		re, err := compile(pattern)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.scriptSrc = append(compiled.scriptSrc, re)
+	}
+	for _, pattern := range rule.HTML {
+		re, err := compile(pattern)
+		if err != nil {
+			return compiled, err
+		}
+		compiled.html = append(compiled.html, re)
+	}
+	return compiled, nil
+}
+
+// Run every rule against the page and return the technologies that matched, sorted by category and name
+func detectTechnologies(input technologyInput) []Technology {
+	detected := []Technology{}
+
+	for _, rule := range loadTechnologyRules() {
+		tech := Technology{Name: rule.name, Category: rule.category}
+		// Keep the first version any pattern captured
+		record := func(evidence string, version []byte) {
+			tech.Evidence = append(tech.Evidence, evidence)
+			if tech.Version == "" && len(version) > 0 {
+				tech.Version = string(version)
+			}
+		}
+		match := func(re *regexp.Regexp, value, evidence string) {
+			if m := re.FindStringSubmatch(value); m != nil {
+				version := ""
+				if len(m) > 1 {
+					version = m[1]
+				}
+				record(evidence, []byte(version))
+			}
+		}
+
+		for _, name := range sortedPatternNames(rule.headers) {
+			if values, ok := input.Headers[http.CanonicalHeaderKey(name)]; ok {
+				match(rule.headers[name], strings.Join(values, ", "), "header "+name)
+			}
+		}
+		for _, cookie := range input.Cookies {
+			for name, re := range rule.cookies {
+				if strings.EqualFold(cookie.Name, name) {
+					match(re, cookie.Value, "cookie "+cookie.Name)
+				}
+			}
+		}
+		if rule.metaGenerator != nil && input.MetaGenerator != "" {
+			match(rule.metaGenerator, input.MetaGenerator, "meta generator")
+		}
+		for _, re := range rule.scriptSrc {
+			for _, src := range input.ScriptSrcs {
+				if re.MatchString(src) {
+					match(re, src, "script "+src)
+					break
+				}
+			}
+		}
+		// The page source is matched as bytes, it can be megabytes and is not copied into a string
+		for _, re := range rule.html {
+			if m := re.FindSubmatch(input.HTML); m != nil {
+				var version []byte
+				if len(m) > 1 {
+					version = m[1]
+				}
+				record("html /"+strings.TrimPrefix(re.String(), "(?i)")+"/", version)
+			}
+		}
+
+		if len(tech.Evidence) > 0 {
+			detected = append(detected, tech)
+		}
+	}
+
+	sort.Slice(detected, func(i, j int) bool {
+		if detected[i].Category != detected[j].Category {
+			return detected[i].Category < detected[j].Category
+		}
+		return detected[i].Name < detected[j].Name
+	})
+	return detected
+}
+
+// Map keys in a stable order so the evidence and captured version do not change between runs
+func sortedPatternNames(patterns map[string]*regexp.Regexp) []string {
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
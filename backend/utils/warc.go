@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// WARC 1.1 (ISO 28500) writer. Every record is its own gzip member, which is the usual .warc.gz layout
+// that standard tools (warcio, pywb, the Internet Archive tooling) read and index record by record
+
+const warcVersion = "WARC/1.1"
+
+// Header fields of a WARC record in the order they are written
+type warcHeader [][2]string
+
+func (h *warcHeader) add(name, value string) {
+	*h = append(*h, [2]string{name, value})
+}
+
+// A request of an analysis and the response it got, as stored with the run. The body is kept apart, content-addressed
+// by BodyHash like the snapshot body, so the WARC of the run is written when it is asked for and stores nothing twice
+type Exchange struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	Host           string      `json:"host,omitempty"`
+	RequestHeader  http.Header `json:"request_headers,omitempty"`
+	Proto          string      `json:"proto,omitempty"`
+	StatusCode     int         `json:"status_code,omitempty"` // 0 when no response came back
+	ResponseHeader http.Header `json:"response_headers,omitempty"`
+	RemoteAddr     string      `json:"remote_addr,omitempty"`
+	// Body as read from the wire, still compressed when it was sent compressed
+	BodyHash      string    `json:"body_hash,omitempty"`
+	BodyTruncated bool      `json:"body_truncated,omitempty"`
+	Start         time.Time `json:"start"`
+	TotalMs       float64   `json:"total_ms"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Content address of a body, the SHA-256 snapshot_blobs is keyed by
+func BodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// The requests of the analysis (the page, its redirects, fetched resources and anchor targets) with their bodies by hash
+func (r *AnalysisResult) Exchanges() ([]Exchange, map[string][]byte) {
+	exchanges := []Exchange{}
+	bodies := map[string][]byte{}
+	for _, hop := range r.exchanges {
+		if hop.Request == nil {
+			continue
+		}
+		exchange := Exchange{
+			Method:        hop.Request.Method,
+			URL:           hop.Request.URL.String(),
+			Host:          hop.Request.Host,
+			RequestHeader: hop.Request.Header,
+			RemoteAddr:    hop.remoteAddr,
+			BodyTruncated: hop.bodyTruncated,
+			Start:         hop.start,
+			TotalMs:       hop.timing().TotalMs,
+		}
+		if hop.err != nil {
+			exchange.Error = hop.err.Error()
+		}
+		if hop.Response != nil {
+			exchange.Proto = hop.Response.Proto
+			exchange.StatusCode = hop.Response.StatusCode
+			exchange.ResponseHeader = hop.Response.Header
+			if hop.body.Len() > 0 {
+				body := append([]byte(nil), hop.body.Bytes()...)
+				exchange.BodyHash = BodyHash(body)
+				bodies[exchange.BodyHash] = body
+			}
+		}
+		exchanges = append(exchanges, exchange)
+	}
+	return exchanges, bodies
+}
+
+// Write the stored exchanges of a run as a gzipped WARC file: a warcinfo record, then a request, response and metadata record
+// for every exchange. bodies holds the response bodies by hash, the metadata records carry the analysis id
+func WriteWARC(w io.Writer, analysisID int, exchanges []Exchange, bodies map[string][]byte) error {
+	infoID := warcRecordID()
+	info := fmt.Sprintf("software: go-react-crawler\r\nformat: WARC File Format 1.1\r\nconformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\nanalysis-id: %d\r\n", analysisID)
+	header := warcHeader{}
+	header.add("WARC-Type", "warcinfo")
+	header.add("WARC-Record-ID", infoID)
+	header.add("WARC-Date", warcDate(time.Now()))
+	header.add("WARC-Filename", fmt.Sprintf("analysis-%d.warc.gz", analysisID))
+	header.add("Content-Type", "application/warc-fields")
+	if err := writeWARCRecord(w, header, []byte(info)); err != nil {
+		return err
+	}
+
+	for _, exchange := range exchanges {
+		date := warcDate(exchange.Start)
+		targetURI := exchange.URL
+		requestID := warcRecordID()
+		responseID := warcRecordID()
+		hasResponse := exchange.StatusCode > 0
+
+		// Request record, concurrent to the response it produced
+		header := warcHeader{}
+		header.add("WARC-Type", "request")
+		header.add("WARC-Record-ID", requestID)
+		header.add("WARC-Date", date)
+		header.add("WARC-Target-URI", targetURI)
+		header.add("WARC-Warcinfo-ID", infoID)
+		if hasResponse {
+			header.add("WARC-Concurrent-To", responseID)
+		}
+		header.add("Content-Type", "application/http;msgtype=request")
+		if err := writeWARCRecord(w, header, rawHTTPRequest(exchange)); err != nil {
+			return err
+		}
+
+		if hasResponse {
+			body := bodies[exchange.BodyHash]
+			block := rawHTTPResponse(exchange, body)
+			header := warcHeader{}
+			header.add("WARC-Type", "response")
+			header.add("WARC-Record-ID", responseID)
+			header.add("WARC-Date", date)
+			header.add("WARC-Target-URI", targetURI)
+			header.add("WARC-Warcinfo-ID", infoID)
+			header.add("WARC-Concurrent-To", requestID)
+			if host, _, err := net.SplitHostPort(exchange.RemoteAddr); err == nil {
+				header.add("WARC-IP-Address", host)
+			}
+			header.add("WARC-Payload-Digest", warcDigest(body))
+			if exchange.BodyTruncated {
+				header.add("WARC-Truncated", "length")
+			}
+			header.add("Content-Type", "application/http;msgtype=response")
+			if err := writeWARCRecord(w, header, block); err != nil {
+				return err
+			}
+		}
+
+		// Metadata about the exchange, refers to the response (or the request when the fetch failed)
+		refersTo := requestID
+		if hasResponse {
+			refersTo = responseID
+		}
+		fields := fmt.Sprintf("analysis-id: %d\r\nfetchTimeMs: %s\r\n", analysisID, strconv.FormatFloat(exchange.TotalMs, 'f', -1, 64))
+		if exchange.Error != "" {
+			fields += "error: " + exchange.Error + "\r\n"
+		}
+		header = warcHeader{}
+		header.add("WARC-Type", "metadata")
+		header.add("WARC-Record-ID", warcRecordID())
+		header.add("WARC-Date", date)
+		header.add("WARC-Target-URI", targetURI)
+		header.add("WARC-Warcinfo-ID", infoID)
+		header.add("WARC-Refers-To", refersTo)
+		header.add("Content-Type", "application/warc-fields")
+		if err := writeWARCRecord(w, header, []byte(fields)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// version line, header fields, blank line, block, and the two CRLFs that end every record
+func writeWARCRecord(w io.Writer, header warcHeader, block []byte) error {
+	var record bytes.Buffer
+	record.WriteString(warcVersion + "\r\n")
+	for _, field := range header {
+		record.WriteString(field[0] + ": " + field[1] + "\r\n")
+	}
+	record.WriteString("WARC-Block-Digest: " + warcDigest(block) + "\r\n")
+	record.WriteString("Content-Length: " + strconv.Itoa(len(block)) + "\r\n")
+	record.WriteString("\r\n")
+	record.Write(block)
+	record.WriteString("\r\n\r\n")
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(record.Bytes()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// The request as it went out: request line, Host and the header fields
+func rawHTTPRequest(exchange Exchange) []byte {
+	var buf bytes.Buffer
+	requestURI, host := "/", exchange.Host
+	if target, err := url.Parse(exchange.URL); err == nil {
+		requestURI = target.RequestURI()
+		if host == "" {
+			host = target.Host
+		}
+	}
+	fmt.Fprintf(&buf, "%s %s HTTP/1.1\r\n", exchange.Method, requestURI)
+	fmt.Fprintf(&buf, "Host: %s\r\n", host)
+	writeSortedHeader(&buf, exchange.RequestHeader)
+	buf.WriteString("\r\n")
+	return buf.Bytes()
+}
+
+// The response as it came in: status line, header fields and the body as read from the wire (still compressed when it was sent compressed)
+func rawHTTPResponse(exchange Exchange, body []byte) []byte {
+	var buf bytes.Buffer
+	proto := exchange.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	fmt.Fprintf(&buf, "%s %d %s\r\n", proto, exchange.StatusCode, http.StatusText(exchange.StatusCode))
+	writeSortedHeader(&buf, exchange.ResponseHeader)
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func writeSortedHeader(buf *bytes.Buffer, header http.Header) {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			fmt.Fprintf(buf, "%s: %s\r\n", name, value)
+		}
+	}
+}
+
+// sha1 in base32, the digest format every WARC tool expects
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// Random (version 4) UUID as a URN
+func warcRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,59 @@
+// Shown instead of the HTML version when the analyzed URL returned a PDF, image, feed, JSON or XML document
+import type { DocumentInfo, ResultKind } from "../types/urlData";
+
+// Human readable labels of the result kinds
+const kindLabels: Record<ResultKind, string> = {
+  html: "HTML page",
+  pdf: "PDF document",
+  image: "Image",
+  feed: "Feed",
+  json: "JSON document",
+  xml: "XML document",
+  other: "Other file",
+};
+
+const DocumentDetails = ({
+  kind,
+  info,
+}: {
+  kind: ResultKind;
+  info?: DocumentInfo | null;
+}) => {
+  return (
+    <div className="flex flex-col gap-1">
+      <p>
+        <strong>Type:</strong> {kindLabels[kind] ?? kind}
+        {info?.content_type ? ` (${info.content_type})` : ""}
+      </p>
+      {info && <p><strong>Size:</strong> {info.size.toLocaleString()} bytes</p>}
+
+      {/* Only the fields of the document kind are filled by the backend */}
+      {kind === "pdf" && info && (
+        <>
+          <p><strong>Pages:</strong> {info.page_count ?? 0}</p>
+          <p><strong>Links:</strong> {info.links?.length ?? 0}</p>
+        </>
+      )}
+      {kind === "image" && info?.format && (
+        <p>
+          <strong>Image:</strong> {info.format.toUpperCase()}
+          {info.width && info.height ? `, ${info.width} × ${info.height} px` : ""}
+        </p>
+      )}
+      {kind === "feed" && info && (
+        <p>
+          <strong>Feed:</strong> {info.feed_format?.toUpperCase() ?? "Unknown"}, {info.item_count ?? 0} items
+        </p>
+      )}
+      {kind === "xml" && info?.root_element && (
+        <p><strong>Root element:</strong> &lt;{info.root_element}&gt;</p>
+      )}
+      {kind === "json" && info?.json_type && (
+        <p><strong>JSON value:</strong> {info.json_type}</p>
+      )}
+      {info?.error && <p className="text-red-600">{info.error}</p>}
+    </div>
+  );
+};
+
+export default DocumentDetails;
@@ -20,6 +20,7 @@ import { Button } from "../components/ui/button";
 import { ArrowLeft } from "lucide-react";
 import { useNavigate } from "react-router-dom";
 import LoadingSpinner from "../components/LoadingSpinner";
+import DocumentDetails from "../components/DocumentDetails";
 
 // Register required Chart.js components
 ChartJS.register(
@@ -140,9 +141,16 @@ const Details: React.FC = () => {
         <div className="flex gap-3">
           <strong>Status:</strong> <StatusBadge status={analysis.status} />
         </div>
-        <p>
-          <strong>HTML Version:</strong> {analysis.html_version || "Unknown"}
-        </p>
+        {!analysis.result_kind || analysis.result_kind === "html" ? (
+          <p>
+            <strong>HTML Version:</strong> {analysis.html_version || "Unknown"}
+          </p>
+        ) : (
+          <DocumentDetails
+            kind={analysis.result_kind}
+            info={analysis.document_info}
+          />
+        )}
         <p>
           <strong>Last Updated:</strong>{" "}
           {analysis.updated_at ? formatDateEU(analysis.updated_at) : "Unknown"}
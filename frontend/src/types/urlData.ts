@@ -3,6 +3,26 @@ export type UrlStatus = "all" | "queued" | "running" | "done" | "error";
 
 // UrlData interface defines the structure of the URL data used in the app
 // This data is to be used throughout the app to avoid repeating ourselves
+// ResultKind tells which kind of document the analyzed URL returned
+export type ResultKind = "html" | "pdf" | "image" | "feed" | "json" | "xml" | "other";
+
+// DocumentInfo holds the metadata of non-HTML results, only the fields of its kind are set
+export interface DocumentInfo {
+  content_type: string;
+  size: number;
+  title?: string;
+  page_count?: number;
+  links?: string[];
+  format?: string;
+  width?: number;
+  height?: number;
+  feed_format?: string;
+  item_count?: number;
+  root_element?: string;
+  json_type?: string;
+  error?: string;
+}
+
 export interface UrlData {
   id: number;
   user_id: number;
@@ -11,6 +31,7 @@ export interface UrlData {
   should_pause: boolean;
   title: string;
   html_version: string;
+  result_kind?: ResultKind;
   heading_counts: any | null;
   internal_links_count: number;
   external_links_count: number;
@@ -19,6 +40,34 @@ export interface UrlData {
   inaccessible_links: any | null;
   internal_links: any | null;
   external_links: any | null;
+  response_meta?: any | null;
+  security_audit?: any | null;
+  technologies?: any | null;
+  resources?: any | null;
+  content_analysis?: any | null;
+  meta_description?: string;
+  content_simhash?: string;
+  extracted_data?: Record<string, string[]> | null;
+  charset_report?: any | null;
+  broken_anchors_count?: number;
+  broken_anchors?: {
+    url: string;
+    text?: string;
+    fragment: string;
+    target_url: string;
+    same_page: boolean;
+    reason: string;
+    detail?: string;
+  }[] | null;
+  document_info?: DocumentInfo | null;
+  rendered_result?: {
+    renderer: string;
+    final_url?: string;
+    result?: any;
+    differences: { field: string; static: any; rendered: any }[];
+    differs: boolean;
+    error?: string;
+  } | null;
   created_at: string;
   updated_at: string;
 }